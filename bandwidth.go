@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"sync/atomic"
+
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/track"
+)
+
+// BandwidthEvent 预估的出口带宽接近预算时发出的事件，Target 为预估的出口带宽（字节/秒）
+type BandwidthEvent struct {
+	Event[int]
+	Limit int // 出口带宽预算（字节/秒）
+}
+
+var bandwidthWarned atomic.Bool
+
+// egressBPS 预估当前的出口带宽，即所有轨道的码率乘以读取者数量
+func egressBPS() (bps int) {
+	Streams.Range(func(_ string, s *Stream) {
+		s.Tracks.Range(func(_ string, t common.Track) {
+			bps += t.GetBPS() * int(t.GetReaderCount())
+		})
+	})
+	return
+}
+
+// bps 预估订阅者需要的码率，只统计已经存在的轨道，同类轨道取码率最大的
+func (w *waitTracks) bps(tracks *Tracks) int {
+	var audio, video int
+	tracks.Range(func(name string, t common.Track) {
+		switch t.(type) {
+		case *track.Audio:
+			if w.audio.Match(name) && t.GetBPS() > audio {
+				audio = t.GetBPS()
+			}
+		case *track.Video:
+			if w.video.Match(name) && t.GetBPS() > video {
+				video = t.GetBPS()
+			}
+		}
+	})
+	return audio + video
+}
+
+// admitBandwidth 检查增加 request 的码率后是否超过出口带宽预算，接近预算时发出 BandwidthEvent
+func admitBandwidth(request int) bool {
+	limit := EngineConfig.EgressLimit
+	if limit <= 0 {
+		return true
+	}
+	egress := egressBPS() + request
+	if float64(egress) >= float64(limit)*EngineConfig.EgressWarnRatio {
+		if bandwidthWarned.CompareAndSwap(false, true) {
+			EventBus <- BandwidthEvent{CreateEvent(egress), limit}
+		}
+	} else {
+		bandwidthWarned.Store(false)
+	}
+	return egress <= limit
+}
@@ -0,0 +1,176 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/q191201771/naza/pkg/nazabits"
+)
+
+var ErrAC3SyncFrame = errors.New("invalid ac3 syncframe")
+
+var (
+	ac3SampleRates  = [3]int{48000, 44100, 32000}
+	eac3SampleRates = [3]int{24000, 22050, 16000} // fscod 为3时由 fscod2 决定
+	ac3Bitrates     = [19]int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+	ac3Channels     = [8]byte{2, 1, 2, 3, 3, 4, 4, 5}
+	eac3Blocks      = [4]int{1, 2, 3, 6}
+)
+
+// AC3SyncFrame AC-3（ATSC A/52 5.4）和 E-AC-3（ATSC A/52 E.1.2）的同步帧头
+type AC3SyncFrame struct {
+	EAC3            bool
+	Dependent       bool // E-AC-3 的从属子流，需要和前面的独立子流一起解码
+	Fscod           byte
+	Frmsizecod      byte // 仅 AC-3
+	Bsid            byte
+	Bsmod           byte // E-AC-3 中没有解析，固定为0
+	Acmod           byte
+	Lfeon           byte
+	SampleRate      int
+	Channels        byte
+	Bitrate         int // kbps
+	FrameLength     int
+	SamplesPerFrame int
+	ChanMap         uint16 // 仅 E-AC-3 从属子流，chanmape 为0时为0
+}
+
+func ParseAC3SyncFrame(b []byte) (f AC3SyncFrame, err error) {
+	if len(b) < 7 || b[0] != 0x0B || b[1] != 0x77 {
+		return f, ErrAC3SyncFrame
+	}
+	f.Bsid = b[5] >> 3
+	if f.Bsid > 16 {
+		return f, ErrAC3SyncFrame
+	}
+	br := nazabits.NewBitReader(b[2:])
+	if f.EAC3 = f.Bsid > 10; f.EAC3 {
+		strmtyp, _ := br.ReadBits8(2)
+		f.Dependent = strmtyp == 1
+		br.ReadBits8(3) // substreamid
+		frmsiz, _ := br.ReadBits16(11)
+		f.FrameLength = (int(frmsiz) + 1) * 2
+		f.Fscod, _ = br.ReadBits8(2)
+		blocks := 6
+		if f.Fscod == 3 {
+			fscod2, _ := br.ReadBits8(2)
+			if fscod2 == 3 {
+				return f, ErrAC3SyncFrame
+			}
+			f.SampleRate = eac3SampleRates[fscod2]
+		} else {
+			numblkscod, _ := br.ReadBits8(2)
+			blocks = eac3Blocks[numblkscod]
+			f.SampleRate = ac3SampleRates[f.Fscod]
+		}
+		f.Acmod, _ = br.ReadBits8(3)
+		f.Lfeon, _ = br.ReadBit()
+		f.SamplesPerFrame = blocks * 256
+		if f.Dependent {
+			br.ReadBits8(5) // bsid
+			br.ReadBits8(5) // dialnorm
+			if compre, _ := br.ReadBit(); compre == 1 {
+				br.ReadBits8(8) // compr
+			}
+			if f.Acmod == 0 {
+				br.ReadBits8(5) // dialnorm2
+				if compr2e, _ := br.ReadBit(); compr2e == 1 {
+					br.ReadBits8(8) // compr2
+				}
+			}
+			if chanmape, _ := br.ReadBit(); chanmape == 1 {
+				f.ChanMap, _ = br.ReadBits16(16)
+			}
+		}
+		f.Bitrate = f.FrameLength * 8 * f.SampleRate / f.SamplesPerFrame / 1000
+	} else {
+		br.ReadBits16(16) // crc1
+		f.Fscod, _ = br.ReadBits8(2)
+		f.Frmsizecod, _ = br.ReadBits8(6)
+		if f.Fscod == 3 || f.Frmsizecod > 37 {
+			return f, ErrAC3SyncFrame
+		}
+		f.SampleRate = ac3SampleRates[f.Fscod]
+		f.Bitrate = ac3Bitrates[f.Frmsizecod>>1]
+		words := f.Bitrate * 96000 / f.SampleRate
+		if f.Fscod == 1 {
+			words += int(f.Frmsizecod & 1)
+		}
+		f.FrameLength = words * 2
+		br.ReadBits8(5) // bsid
+		f.Bsmod, _ = br.ReadBits8(3)
+		f.Acmod, _ = br.ReadBits8(3)
+		if f.Acmod&1 != 0 && f.Acmod != 1 {
+			br.ReadBits8(2) // cmixlev
+		}
+		if f.Acmod&4 != 0 {
+			br.ReadBits8(2) // surmixlev
+		}
+		if f.Acmod == 2 {
+			br.ReadBits8(2) // dsurmod
+		}
+		f.Lfeon, _ = br.ReadBit()
+		f.SamplesPerFrame = 1536
+	}
+	f.Channels = ac3Channels[f.Acmod] + f.Lfeon
+	return
+}
+
+// SplitAC3Frames 按照帧头中的长度切分连续的同步帧，无法识别的数据作为最后一帧
+func SplitAC3Frames(b []byte) (frames [][]byte) {
+	for len(b) > 0 {
+		f, err := ParseAC3SyncFrame(b)
+		if err != nil || f.FrameLength >= len(b) {
+			return append(frames, b)
+		}
+		frames = append(frames, b[:f.FrameLength])
+		b = b[f.FrameLength:]
+	}
+	return
+}
+
+// DAC3 生成 mp4 中 dac3 box 的内容（ETSI TS 102 366 F.4）
+func (f *AC3SyncFrame) DAC3() []byte {
+	b := make([]byte, 3)
+	bw := nazabits.NewBitWriter(b)
+	bw.WriteBits8(2, f.Fscod)
+	bw.WriteBits8(5, f.Bsid)
+	bw.WriteBits8(3, f.Bsmod)
+	bw.WriteBits8(3, f.Acmod)
+	bw.WriteBit(f.Lfeon)
+	bw.WriteBits8(5, f.Frmsizecod>>1)
+	return b
+}
+
+// chanLoc 将从属子流的 chanmap（ATSC A/52 表 E.1.4）转换为 dec3 中的 chan_loc（ETSI TS 102 366 表 F.6.1）
+func (f *AC3SyncFrame) chanLoc() uint16 {
+	return f.ChanMap>>2&0x1FE | f.ChanMap>>1&1
+}
+
+// DEC3 生成 mp4 中 dec3 box 的内容（ETSI TS 102 366 F.6），只描述一个独立子流，dependents 为和它一起解码的从属子流
+func (f *AC3SyncFrame) DEC3(dependents ...AC3SyncFrame) []byte {
+	dataRate := f.Bitrate
+	var chanLoc uint16
+	for i := range dependents {
+		dataRate += dependents[i].Bitrate
+		chanLoc |= dependents[i].chanLoc()
+	}
+	b := make([]byte, 5)
+	if len(dependents) > 0 {
+		b = make([]byte, 6)
+	}
+	bw := nazabits.NewBitWriter(b)
+	bw.WriteBits16(13, uint16(dataRate))
+	bw.WriteBits8(3, 0) // num_ind_sub - 1
+	bw.WriteBits8(2, f.Fscod)
+	bw.WriteBits8(5, f.Bsid)
+	bw.WriteBits8(2, 0) // reserved + asvc
+	bw.WriteBits8(3, f.Bsmod)
+	bw.WriteBits8(3, f.Acmod)
+	bw.WriteBit(f.Lfeon)
+	bw.WriteBits8(3, 0) // reserved
+	bw.WriteBits8(4, byte(len(dependents)))
+	if len(dependents) > 0 {
+		bw.WriteBits16(9, chanLoc)
+	}
+	return b
+}
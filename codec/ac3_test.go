@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+var (
+	// AC-3 48kHz 384kbps 3/2+LFE
+	testAC3 = []byte{0x0B, 0x77, 0, 0, 0x1C, 0x40, 0xE1}
+	// E-AC-3 独立子流 48kHz 6块 3/2+LFE，frmsiz 383
+	testEAC3 = []byte{0x0B, 0x77, 0x01, 0x7F, 0x3F, 0x80, 0x00}
+	// E-AC-3 从属子流 2/0，chanmap 为 Lrs/Rrs
+	testEAC3Dependent = []byte{0x0B, 0x77, 0x41, 0x7F, 0x34, 0x80, 0x10, 0x20, 0x00}
+)
+
+func TestParseAC3SyncFrame(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want AC3SyncFrame
+	}{
+		{"ac3", testAC3, AC3SyncFrame{Frmsizecod: 0x1C, Bsid: 8, Acmod: 7, Lfeon: 1, SampleRate: 48000, Channels: 6, Bitrate: 384, FrameLength: 1536, SamplesPerFrame: 1536}},
+		{"eac3", testEAC3, AC3SyncFrame{EAC3: true, Bsid: 16, Acmod: 7, Lfeon: 1, SampleRate: 48000, Channels: 6, Bitrate: 192, FrameLength: 768, SamplesPerFrame: 1536}},
+		{"eac3 dependent", testEAC3Dependent, AC3SyncFrame{EAC3: true, Dependent: true, Bsid: 16, Acmod: 2, SampleRate: 48000, Channels: 2, Bitrate: 192, FrameLength: 768, SamplesPerFrame: 1536, ChanMap: 0x0200}},
+	} {
+		got, err := ParseAC3SyncFrame(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	for _, data := range [][]byte{
+		{0x0B, 0x77, 0, 0},                   // 长度不足
+		{0x0B, 0x78, 0, 0, 0x1C, 0x40, 0xE1}, // 同步字错误
+		{0x0B, 0x77, 0, 0, 0xDC, 0x40, 0xE1}, // fscod 为3
+		{0x0B, 0x77, 0, 0, 0x26, 0x40, 0xE1}, // frmsizecod 超出范围
+		{0x0B, 0x77, 0, 0, 0x1C, 0x88, 0xE1}, // bsid 为17
+	} {
+		if _, err := ParseAC3SyncFrame(data); err != ErrAC3SyncFrame {
+			t.Errorf("%x: got %v", data, err)
+		}
+	}
+}
+
+func TestSplitAC3Frames(t *testing.T) {
+	frame := make([]byte, 768)
+	copy(frame, testEAC3)
+	dependent := make([]byte, 768)
+	copy(dependent, testEAC3Dependent)
+	data := append(append(append([]byte(nil), frame...), dependent...), 1, 2)
+	frames := SplitAC3Frames(data)
+	if len(frames) != 3 || !bytes.Equal(frames[0], frame) || !bytes.Equal(frames[1], dependent) || !bytes.Equal(frames[2], []byte{1, 2}) {
+		t.Fatalf("frames %d", len(frames))
+	}
+}
+
+func TestDAC3(t *testing.T) {
+	f, _ := ParseAC3SyncFrame(testAC3)
+	// fscod 0, bsid 8, bsmod 0, acmod 7, lfeon 1, bit_rate_code 14
+	if got, want := f.DAC3(), []byte{0x10, 0x3D, 0xC0}; !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
+
+func TestDEC3(t *testing.T) {
+	f, _ := ParseAC3SyncFrame(testEAC3)
+	dep, _ := ParseAC3SyncFrame(testEAC3Dependent)
+	// data_rate 192, num_ind_sub 0, fscod 0, bsid 16, acmod 7, lfeon 1, num_dep_sub 0
+	if got, want := f.DEC3(), []byte{0x06, 0x00, 0x20, 0x0F, 0x00}; !bytes.Equal(got, want) {
+		t.Fatalf("independent: got %x, want %x", got, want)
+	}
+	// data_rate 包含从属子流，num_dep_sub 1，chan_loc 为 Lrs/Rrs
+	if got, want := f.DEC3(dep), []byte{0x0C, 0x00, 0x20, 0x0F, 0x02, 0x80}; !bytes.Equal(got, want) {
+		t.Fatalf("dependent: got %x, want %x", got, want)
+	}
+}
@@ -9,6 +9,8 @@ type VideoCodecID byte
 
 const (
 	ADTS_HEADER_SIZE              = 7
+	CodecID_MP3      AudioCodecID = 2
+	CodecID_L16      AudioCodecID = 3 // FLV 中为小端，其他场景下为大端（RFC 3551）
 	CodecID_AAC      AudioCodecID = 0xA
 	CodecID_PCMA     AudioCodecID = 7
 	CodecID_PCMU     AudioCodecID = 8
@@ -16,6 +18,14 @@ const (
 	CodecID_H264     VideoCodecID = 7
 	CodecID_H265     VideoCodecID = 0xC
 	CodecID_AV1      VideoCodecID = 0xD
+	CodecID_VP8      VideoCodecID = 0xE
+	CodecID_VP9      VideoCodecID = 0xF
+	CodecID_H266     VideoCodecID = 0x10
+	CodecID_MP2      AudioCodecID = 0x10 // FLV 中没有对应的格式
+	CodecID_L24      AudioCodecID = 0x11 // FLV 中没有对应的格式
+	CodecID_G722     AudioCodecID = 0x12 // FLV 中没有对应的格式
+	CodecID_AC3      AudioCodecID = 0x13 // FLV 中没有对应的格式
+	CodecID_EAC3     AudioCodecID = 0x14 // FLV 中没有对应的格式
 )
 
 func (codecId AudioCodecID) String() string {
@@ -28,6 +38,20 @@ func (codecId AudioCodecID) String() string {
 		return "pcmu"
 	case CodecID_OPUS:
 		return "opus"
+	case CodecID_MP3:
+		return "mp3"
+	case CodecID_MP2:
+		return "mp2"
+	case CodecID_L16:
+		return "l16"
+	case CodecID_L24:
+		return "l24"
+	case CodecID_G722:
+		return "g722"
+	case CodecID_AC3:
+		return "ac3"
+	case CodecID_EAC3:
+		return "eac3"
 	}
 	return "unknow"
 }
@@ -40,6 +64,12 @@ func (codecId VideoCodecID) String() string {
 		return "h265"
 	case CodecID_AV1:
 		return "av1"
+	case CodecID_VP8:
+		return "vp8"
+	case CodecID_VP9:
+		return "vp9"
+	case CodecID_H266:
+		return "h266"
 	}
 	return "unknow"
 }
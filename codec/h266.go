@@ -0,0 +1,356 @@
+package codec
+
+import (
+	"errors"
+
+	"github.com/q191201771/naza/pkg/nazabits"
+	"m7s.live/engine/v4/util"
+)
+
+type H266NALUType byte
+
+// Parse H266 的 NALU 头为两个字节，类型在第二个字节的高5位
+func (H266NALUType) Parse(b byte) H266NALUType {
+	return H266NALUType(b >> 3)
+}
+
+func ParseH266NALUType(b byte) H266NALUType {
+	return H266NALUType(b >> 3)
+}
+
+// ITU-T H.266 Table 5
+const (
+	H266_NAL_TRAIL      H266NALUType = 0
+	H266_NAL_STSA       H266NALUType = 1
+	H266_NAL_RADL       H266NALUType = 2
+	H266_NAL_RASL       H266NALUType = 3
+	H266_NAL_IDR_W_RADL H266NALUType = 7
+	H266_NAL_IDR_N_LP   H266NALUType = 8
+	H266_NAL_CRA        H266NALUType = 9
+	H266_NAL_GDR        H266NALUType = 10
+	H266_NAL_OPI        H266NALUType = 12
+	H266_NAL_DCI        H266NALUType = 13
+	H266_NAL_VPS        H266NALUType = 14
+	H266_NAL_SPS        H266NALUType = 15
+	H266_NAL_PPS        H266NALUType = 16
+	H266_NAL_PREFIX_APS H266NALUType = 17
+	H266_NAL_SUFFIX_APS H266NALUType = 18
+	H266_NAL_PH         H266NALUType = 19
+	H266_NAL_AUD        H266NALUType = 20
+	H266_NAL_EOS        H266NALUType = 21
+	H266_NAL_EOB        H266NALUType = 22
+	H266_NAL_PREFIX_SEI H266NALUType = 23
+	H266_NAL_SUFFIX_SEI H266NALUType = 24
+	H266_NAL_FD         H266NALUType = 25
+	// RFC 9328
+	H266_NAL_RTP_AP H266NALUType = 28
+	H266_NAL_RTP_FU H266NALUType = 29
+)
+
+var ErrVvc = errors.New("vvc parse config error")
+var FourCC_H266_32 = util.BigEndian.Uint32([]byte{'v', 'v', 'c', '1'})
+
+// H266AudNalu 用于 mpegts 的 AUD，aud_pic_type 为2（I、P、B）
+var H266AudNalu = []byte{0x00, 0x00, 0x00, 0x01, 0x00, byte(H266_NAL_AUD)<<3 | 1, 0x28}
+
+// VVCPTLRecord ISO/IEC 14496-15 11.2.4.2 中的 VvcPTLRecord
+type VVCPTLRecord struct {
+	GeneralProfileIdc          uint8 // 7 bits
+	GeneralTierFlag            uint8 // 1 bit
+	GeneralLevelIdc            uint8
+	PtlFrameOnlyConstraintFlag uint8 // 1 bit
+	PtlMultiLayerEnabledFlag   uint8 // 1 bit
+	GeneralSubProfileIdc       []uint32
+	gci                        []uint8 // general_constraint_info，每个元素为一位
+}
+
+// VVCDecoderConfigurationRecord vvcC，不包含子层的 level
+type VVCDecoderConfigurationRecord struct {
+	LengthSizeMinusOne uint8 // 2 bits
+	PtlPresentFlag     bool
+	NumSublayers       uint8 // 3 bits
+	ChromaFormatIdc    uint8 // 2 bits
+	BitDepthMinus8     uint8 // 3 bits
+	NativePTL          VVCPTLRecord
+	MaxPictureWidth    uint16
+	MaxPictureHeight   uint16
+	NALUs              [][]byte // 按出现的顺序排列的 VPS、SPS、PPS 等
+}
+
+func (r *VVCDecoderConfigurationRecord) Unmarshal(b []byte) (err error) {
+	br := nazabits.NewBitReader(b)
+	if _, err = br.ReadBits8(5); err != nil {
+		return ErrVvc
+	}
+	r.LengthSizeMinusOne, _ = br.ReadBits8(2)
+	ptl, _ := br.ReadBit()
+	if r.PtlPresentFlag = ptl == 1; r.PtlPresentFlag {
+		br.ReadBits16(9) // ols_idx
+		r.NumSublayers, _ = br.ReadBits8(3)
+		br.ReadBits8(2) // constant_frame_rate
+		r.ChromaFormatIdc, _ = br.ReadBits8(2)
+		r.BitDepthMinus8, _ = br.ReadBits8(3)
+		br.ReadBits8(5)
+		if err = r.NativePTL.unmarshal(&br, r.NumSublayers); err != nil {
+			return
+		}
+		r.MaxPictureWidth, _ = br.ReadBits16(16)
+		r.MaxPictureHeight, _ = br.ReadBits16(16)
+		br.ReadBits16(16) // avg_frame_rate
+	}
+	numOfArrays, err := br.ReadBits8(8)
+	if err != nil {
+		return ErrVvc
+	}
+	avail, _ := br.AvailBits()
+	offset := len(b) - int(avail/8)
+	r.NALUs = r.NALUs[:0]
+	for i := 0; i < int(numOfArrays); i++ {
+		if offset >= len(b) {
+			return ErrVvc
+		}
+		naluType := H266NALUType(b[offset] & 0x1F)
+		offset++
+		numNalus := 1
+		if naluType != H266_NAL_DCI && naluType != H266_NAL_OPI {
+			if offset+2 > len(b) {
+				return ErrVvc
+			}
+			numNalus = util.ReadBE[int](b[offset : offset+2])
+			offset += 2
+		}
+		for j := 0; j < numNalus; j++ {
+			if offset+2 > len(b) {
+				return ErrVvc
+			}
+			l := util.ReadBE[int](b[offset : offset+2])
+			offset += 2
+			if offset+l > len(b) {
+				return ErrVvc
+			}
+			r.NALUs = append(r.NALUs, b[offset:offset+l])
+			offset += l
+		}
+	}
+	return nil
+}
+
+func (p *VVCPTLRecord) unmarshal(br *nazabits.BitReader, numSublayers uint8) error {
+	br.ReadBits8(2)
+	numBytesConstraintInfo, _ := br.ReadBits8(6)
+	p.GeneralProfileIdc, _ = br.ReadBits8(7)
+	p.GeneralTierFlag, _ = br.ReadBit()
+	p.GeneralLevelIdc, _ = br.ReadBits8(8)
+	p.PtlFrameOnlyConstraintFlag, _ = br.ReadBit()
+	p.PtlMultiLayerEnabledFlag, _ = br.ReadBit()
+	p.gci = p.gci[:0]
+	for i := 0; i < int(numBytesConstraintInfo)*8-2; i++ {
+		bit, _ := br.ReadBit()
+		p.gci = append(p.gci, bit)
+	}
+	var levelPresent uint8
+	if numSublayers > 1 {
+		// ptl_sublayer_level_present_flag 与 ptl_reserved_zero_bit 共8位
+		levelPresent, _ = br.ReadBits8(8)
+	}
+	for i := int(numSublayers) - 2; i >= 0; i-- {
+		if levelPresent>>(7-(int(numSublayers)-2-i))&1 == 1 {
+			br.ReadBits8(8) // sublayer_level_idc
+		}
+	}
+	numSubProfiles, _ := br.ReadBits8(8)
+	p.GeneralSubProfileIdc = p.GeneralSubProfileIdc[:0]
+	for i := 0; i < int(numSubProfiles); i++ {
+		v, _ := br.ReadBits32(32)
+		p.GeneralSubProfileIdc = append(p.GeneralSubProfileIdc, v)
+	}
+	if br.Err() != nil {
+		return ErrVvc
+	}
+	return nil
+}
+
+func (p *VVCPTLRecord) marshal(numSublayers uint8) []byte {
+	numBytesConstraintInfo := (len(p.gci) + 2 + 7) / 8
+	b := make([]byte, 3+numBytesConstraintInfo)
+	b[0] = byte(numBytesConstraintInfo) & 0x3F
+	b[1] = p.GeneralProfileIdc<<1 | p.GeneralTierFlag&1
+	b[2] = p.GeneralLevelIdc
+	bw := nazabits.NewBitWriter(b[3:])
+	bw.WriteBit(p.PtlFrameOnlyConstraintFlag)
+	bw.WriteBit(p.PtlMultiLayerEnabledFlag)
+	for _, bit := range p.gci {
+		bw.WriteBit(bit)
+	}
+	if numSublayers > 1 {
+		// 不携带子层的 level
+		b = append(b, 0)
+	}
+	b = append(b, byte(len(p.GeneralSubProfileIdc)))
+	for _, v := range p.GeneralSubProfileIdc {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func (r *VVCDecoderConfigurationRecord) Marshal() (b []byte) {
+	ptl := byte(0)
+	if r.PtlPresentFlag {
+		ptl = 1
+	}
+	b = append(b, 0xF8|(r.LengthSizeMinusOne&0x03)<<1|ptl)
+	if r.PtlPresentFlag {
+		// ols_idx(9) num_sublayers(3) constant_frame_rate(2) chroma_format_idc(2)
+		v := uint16(r.NumSublayers&0x07)<<4 | uint16(r.ChromaFormatIdc&0x03)
+		b = append(b, byte(v>>8), byte(v), r.BitDepthMinus8<<5|0x1F)
+		b = append(b, r.NativePTL.marshal(r.NumSublayers)...)
+		b = append(b, byte(r.MaxPictureWidth>>8), byte(r.MaxPictureWidth), byte(r.MaxPictureHeight>>8), byte(r.MaxPictureHeight), 0, 0)
+	}
+	// 相同类型的 NALU 放在同一个数组中
+	var types []H266NALUType
+	arrays := make(map[H266NALUType][][]byte)
+	for _, nalu := range r.NALUs {
+		if len(nalu) < 2 {
+			continue
+		}
+		t := ParseH266NALUType(nalu[1])
+		if _, ok := arrays[t]; !ok {
+			types = append(types, t)
+		}
+		arrays[t] = append(arrays[t], nalu)
+	}
+	b = append(b, byte(len(types)))
+	for _, t := range types {
+		b = append(b, 0x80|byte(t))
+		if t != H266_NAL_DCI && t != H266_NAL_OPI {
+			b = append(b, byte(len(arrays[t])>>8), byte(len(arrays[t])))
+		}
+		for _, nalu := range arrays[t] {
+			b = append(b, byte(len(nalu)>>8), byte(len(nalu)))
+			b = append(b, nalu...)
+		}
+	}
+	return
+}
+
+// ParseSps 从 SPS 中解析 profile、分辨率等信息，NALU 长度固定为4字节
+func (r *VVCDecoderConfigurationRecord) ParseSps(sps []byte) (info SPSInfo, err error) {
+	if len(sps) < 3 {
+		return info, ErrVvc
+	}
+	rbsp := nal2rbsp(sps[2:])
+	br := nazabits.NewBitReader(rbsp)
+	br.ReadBits8(8) // sps_seq_parameter_set_id, sps_video_parameter_set_id
+	maxSublayersMinus1, _ := br.ReadBits8(3)
+	r.LengthSizeMinusOne = 3
+	r.NumSublayers = maxSublayersMinus1 + 1
+	r.ChromaFormatIdc, _ = br.ReadBits8(2)
+	br.ReadBits8(2) // sps_log2_ctu_size_minus5
+	ptlPresent, _ := br.ReadBit()
+	if r.PtlPresentFlag = ptlPresent == 1; r.PtlPresentFlag {
+		if err = r.NativePTL.parseProfileTierLevel(&br, maxSublayersMinus1); err != nil {
+			return
+		}
+	}
+	br.ReadBit() // sps_gdr_enabled_flag
+	if resampling, _ := br.ReadBit(); resampling == 1 {
+		br.ReadBit() // sps_res_change_in_clvs_allowed_flag
+	}
+	width, _ := br.ReadUeGolomb()
+	height, _ := br.ReadUeGolomb()
+	if conformanceWindow, _ := br.ReadBit(); conformanceWindow == 1 {
+		subWidthC, subHeightC := uint32(1), uint32(1)
+		switch r.ChromaFormatIdc {
+		case 1:
+			subWidthC, subHeightC = 2, 2
+		case 2:
+			subWidthC = 2
+		}
+		left, _ := br.ReadUeGolomb()
+		right, _ := br.ReadUeGolomb()
+		top, _ := br.ReadUeGolomb()
+		bottom, _ := br.ReadUeGolomb()
+		info.CropLeft, info.CropRight = uint(left*subWidthC), uint(right*subWidthC)
+		info.CropTop, info.CropBottom = uint(top*subHeightC), uint(bottom*subHeightC)
+	}
+	// 有子图信息时不再继续解析位深
+	if subpic, _ := br.ReadBit(); subpic == 0 {
+		bitDepthMinus8, _ := br.ReadUeGolomb()
+		r.BitDepthMinus8 = uint8(bitDepthMinus8)
+	}
+	if br.Err() != nil {
+		return info, ErrVvc
+	}
+	r.MaxPictureWidth, r.MaxPictureHeight = uint16(width), uint16(height)
+	info.ProfileIdc, info.LevelIdc = uint(r.NativePTL.GeneralProfileIdc), uint(r.NativePTL.GeneralLevelIdc)
+	info.Width = uint(width) - info.CropLeft - info.CropRight
+	info.Height = uint(height) - info.CropTop - info.CropBottom
+	return
+}
+
+// parseProfileTierLevel 解析 profile_tier_level(1, maxSublayersMinus1)
+func (p *VVCPTLRecord) parseProfileTierLevel(br *nazabits.BitReader, maxSublayersMinus1 uint8) error {
+	p.GeneralProfileIdc, _ = br.ReadBits8(7)
+	p.GeneralTierFlag, _ = br.ReadBit()
+	p.GeneralLevelIdc, _ = br.ReadBits8(8)
+	p.PtlFrameOnlyConstraintFlag, _ = br.ReadBit()
+	p.PtlMultiLayerEnabledFlag, _ = br.ReadBit()
+	// general_constraints_info()
+	p.gci = p.gci[:0]
+	readGci := func(n int) {
+		for i := 0; i < n; i++ {
+			bit, _ := br.ReadBit()
+			p.gci = append(p.gci, bit)
+		}
+	}
+	readGci(1)
+	if p.gci[0] == 1 {
+		readGci(71)
+		numAdditionalBits, _ := br.ReadBits8(8)
+		for i := 7; i >= 0; i-- {
+			p.gci = append(p.gci, numAdditionalBits>>i&1)
+		}
+		readGci(int(numAdditionalBits))
+	}
+	alignBits := func() {
+		if avail, _ := br.AvailBits(); avail%8 != 0 {
+			br.SkipBits(avail % 8)
+		}
+	}
+	alignBits()
+	levelPresent := make([]uint8, maxSublayersMinus1)
+	for i := int(maxSublayersMinus1) - 1; i >= 0; i-- {
+		levelPresent[i], _ = br.ReadBit()
+	}
+	alignBits()
+	for i := int(maxSublayersMinus1) - 1; i >= 0; i-- {
+		if levelPresent[i] == 1 {
+			br.ReadBits8(8) // sublayer_level_idc
+		}
+	}
+	numSubProfiles, _ := br.ReadBits8(8)
+	p.GeneralSubProfileIdc = p.GeneralSubProfileIdc[:0]
+	for i := 0; i < int(numSubProfiles); i++ {
+		v, _ := br.ReadBits32(32)
+		p.GeneralSubProfileIdc = append(p.GeneralSubProfileIdc, v)
+	}
+	if br.Err() != nil {
+		return ErrVvc
+	}
+	return nil
+}
+
+// BuildH266SeqHeaderFromVpsSpsPps 生成 enhanced-rtmp 格式的序列头，vps 可以为空
+func BuildH266SeqHeaderFromVpsSpsPps(vps, sps, pps []byte) ([]byte, error) {
+	var record VVCDecoderConfigurationRecord
+	if _, err := record.ParseSps(sps); err != nil {
+		return nil, err
+	}
+	if vps != nil {
+		record.NALUs = append(record.NALUs, vps)
+	}
+	record.NALUs = append(record.NALUs, sps, pps)
+	sh := []byte{0b1001_0000 | byte(PacketTypeSequenceStart), 0, 0, 0, 0}
+	util.BigEndian.PutUint32(sh[1:], FourCC_H266_32)
+	return append(sh, record.Marshal()...), nil
+}
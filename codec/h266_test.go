@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var (
+	// 截断的 SPS，只包含 ParseSps 用到的字段：Main 10，level 3.1，4:2:0，1920x1088，下方裁剪8行，10 bit
+	testVVCSPS = []byte{0x00, 0x79, 0x00, 0x0d, 0x02, 0x33, 0x80, 0x00, 0x00, 0x0f, 0x02, 0x00, 0x44, 0x1f, 0x29, 0xc0}
+	testVVCVPS = []byte{0x00, 0x71, 0x01, 0x02}
+	testVVCPPS = []byte{0x00, 0x81, 0x03, 0x04}
+)
+
+func TestVVCParseSps(t *testing.T) {
+	var r VVCDecoderConfigurationRecord
+	info, err := r.ParseSps(testVVCSPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 1920 || info.Height != 1080 || info.CropBottom != 8 {
+		t.Errorf("size %dx%d crop bottom %d", info.Width, info.Height, info.CropBottom)
+	}
+	if info.ProfileIdc != 1 || info.LevelIdc != 51 {
+		t.Errorf("profile %d level %d", info.ProfileIdc, info.LevelIdc)
+	}
+	if r.MaxPictureWidth != 1920 || r.MaxPictureHeight != 1088 || r.ChromaFormatIdc != 1 || r.BitDepthMinus8 != 2 || r.NumSublayers != 1 || !r.PtlPresentFlag || r.NativePTL.PtlFrameOnlyConstraintFlag != 1 {
+		t.Errorf("record %+v", r)
+	}
+	if _, err = r.ParseSps(testVVCSPS[:6]); err != ErrVvc {
+		t.Errorf("truncated sps: %v", err)
+	}
+}
+
+func TestVVCDecoderConfigurationRecord(t *testing.T) {
+	for _, numSublayers := range []uint8{1, 3} {
+		want := VVCDecoderConfigurationRecord{
+			LengthSizeMinusOne: 3,
+			PtlPresentFlag:     true,
+			NumSublayers:       numSublayers,
+			ChromaFormatIdc:    1,
+			BitDepthMinus8:     2,
+			NativePTL: VVCPTLRecord{
+				GeneralProfileIdc:          1,
+				GeneralTierFlag:            1,
+				GeneralLevelIdc:            83,
+				PtlFrameOnlyConstraintFlag: 1,
+				GeneralSubProfileIdc:       []uint32{0x01020304},
+				gci:                        []uint8{1, 0, 1, 1, 0, 1},
+			},
+			MaxPictureWidth:  3840,
+			MaxPictureHeight: 2160,
+			NALUs:            [][]byte{testVVCVPS, testVVCSPS, testVVCPPS},
+		}
+		b := want.Marshal()
+		if b[0] != 0xFF {
+			t.Errorf("sublayers %d: first byte %x", numSublayers, b[0])
+		}
+		var got VVCDecoderConfigurationRecord
+		if err := got.Unmarshal(b); err != nil {
+			t.Fatalf("sublayers %d: %v", numSublayers, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sublayers %d: got %+v, want %+v", numSublayers, got, want)
+		}
+		if err := got.Unmarshal(b[:len(b)-1]); err != ErrVvc {
+			t.Errorf("sublayers %d: truncated record: %v", numSublayers, err)
+		}
+	}
+}
+
+func TestBuildH266SeqHeaderFromVpsSpsPps(t *testing.T) {
+	sh, err := BuildH266SeqHeaderFromVpsSpsPps(nil, testVVCSPS, testVVCPPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh[0] != 0b1001_0000|byte(PacketTypeSequenceStart) || string(sh[1:5]) != "vvc1" {
+		t.Fatalf("header %x", sh[:5])
+	}
+	var r VVCDecoderConfigurationRecord
+	if err = r.Unmarshal(sh[5:]); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.NALUs) != 2 || !bytes.Equal(r.NALUs[0], testVVCSPS) || !bytes.Equal(r.NALUs[1], testVVCPPS) {
+		t.Fatalf("nalus %x", r.NALUs)
+	}
+	if r.MaxPictureWidth != 1920 || r.MaxPictureHeight != 1088 || r.NativePTL.GeneralLevelIdc != 51 {
+		t.Fatalf("record %+v", r)
+	}
+	// 再次编码结果不变
+	if b := r.Marshal(); !bytes.Equal(b, sh[5:]) {
+		t.Fatalf("remarshal %x, want %x", b, sh[5:])
+	}
+}
@@ -0,0 +1,347 @@
+package codec
+
+import (
+	"m7s.live/engine/v4/util"
+)
+
+// MP4 box 写入辅助函数，供 fMP4 以及普通 MP4 的封装共用
+
+const (
+	MP4_SAMPLE_FLAG_SYNC     = 0x02000000 // sample_depends_on=2，关键帧
+	MP4_SAMPLE_FLAG_NON_SYNC = 0x01010000 // sample_depends_on=1，sample_is_non_sync_sample=1
+
+	MP4_ESDS_OBJECT_TYPE_AAC         = 0x40 // ISO/IEC 14496-3
+	MP4_ESDS_OBJECT_TYPE_MPEG2_AUDIO = 0x69 // ISO/IEC 13818-3
+	MP4_ESDS_OBJECT_TYPE_MPEG1_AUDIO = 0x6B // ISO/IEC 11172-3
+)
+
+// MP4SampleEntry 描述 stsd 中的一个采样条目
+type MP4SampleEntry struct {
+	Type       string // 采样条目类型，如 avc1、hvc1、av01、mp4a、Opus
+	ConfigType string // 解码器配置 box 类型，如 avcC、hvcC、av1C、esds、dOps
+	Config     []byte // 解码器配置 box 的内容（不含 box 头）
+	IsVideo    bool
+	Width      uint16
+	Height     uint16
+	Channels   uint16
+	SampleSize uint16
+	SampleRate uint32
+}
+
+// WriteMP4Box 写入一个 box，box 内容由 body 写入，结束后回填 box 大小
+func WriteMP4Box(b *util.Buffer, boxType string, body func()) {
+	offset := b.Len()
+	b.WriteUint32(0)
+	b.WriteString(boxType)
+	if body != nil {
+		body()
+	}
+	util.BigEndian.PutUint32((*b)[offset:], uint32(b.Len()-offset))
+}
+
+// WriteMP4FullBox 写入一个带有 version 和 flags 的 box
+func WriteMP4FullBox(b *util.Buffer, boxType string, version byte, flags uint32, body func()) {
+	WriteMP4Box(b, boxType, func() {
+		b.WriteByte(version)
+		b.WriteUint24(flags)
+		if body != nil {
+			body()
+		}
+	})
+}
+
+// WriteMP4Uint64 写入 64 位大端整数
+func WriteMP4Uint64(b *util.Buffer, v uint64) {
+	util.PutBE(b.Malloc(8), v)
+}
+
+// WriteMP4Matrix 写入单位变换矩阵
+func WriteMP4Matrix(b *util.Buffer) {
+	for _, v := range [9]uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b.WriteUint32(v)
+	}
+}
+
+// WriteMP4SampleEntry 写入 stsd 中的 VisualSampleEntry 或 AudioSampleEntry
+func WriteMP4SampleEntry(b *util.Buffer, entry *MP4SampleEntry) {
+	WriteMP4Box(b, entry.Type, func() {
+		b.Write(make([]byte, 6)) // reserved
+		b.WriteUint16(1)         // data_reference_index
+		if entry.IsVideo {
+			b.Write(make([]byte, 16)) // pre_defined + reserved
+			b.WriteUint16(entry.Width)
+			b.WriteUint16(entry.Height)
+			b.WriteUint32(0x00480000) // horizresolution 72 dpi
+			b.WriteUint32(0x00480000) // vertresolution 72 dpi
+			b.WriteUint32(0)          // reserved
+			b.WriteUint16(1)          // frame_count
+			b.Write(make([]byte, 32)) // compressorname
+			b.WriteUint16(0x0018)     // depth
+			b.WriteUint16(0xFFFF)     // pre_defined
+		} else {
+			b.Write(make([]byte, 8)) // reserved
+			b.WriteUint16(entry.Channels)
+			b.WriteUint16(entry.SampleSize)
+			b.WriteUint32(0) // pre_defined + reserved
+			if entry.SampleRate > 0xFFFF {
+				b.WriteUint32(0)
+			} else {
+				b.WriteUint32(entry.SampleRate << 16)
+			}
+		}
+		if entry.ConfigType != "" {
+			WriteMP4Box(b, entry.ConfigType, func() {
+				b.Write(entry.Config)
+			})
+		}
+	})
+}
+
+// 写入 MPEG-4 描述符的 tag 和长度（固定使用 4 字节的长度编码）
+func writeDescriptorHead(b *util.Buffer, tag byte, size int) {
+	b.WriteByte(tag)
+	b.WriteByte(0x80 | byte(size>>21)&0x7F)
+	b.WriteByte(0x80 | byte(size>>14)&0x7F)
+	b.WriteByte(0x80 | byte(size>>7)&0x7F)
+	b.WriteByte(byte(size) & 0x7F)
+}
+
+// MakeESDS 生成 esds box 的内容（含 version 和 flags），objectType 参见 ISO/IEC 14496-1 Table 5
+func MakeESDS(objectType byte, decoderSpecificInfo []byte) []byte {
+	var b util.Buffer
+	b.WriteUint32(0) // version + flags
+	decSpecificLen := 0
+	if len(decoderSpecificInfo) > 0 {
+		decSpecificLen = 5 + len(decoderSpecificInfo)
+	}
+	decConfigLen := 13 + decSpecificLen
+	writeDescriptorHead(&b, 0x03, 3+5+decConfigLen+5+1) // ES_Descriptor
+	b.WriteUint16(1)                                    // ES_ID
+	b.WriteByte(0)                                      // flags
+	writeDescriptorHead(&b, 0x04, decConfigLen)         // DecoderConfigDescriptor
+	b.WriteByte(objectType)
+	b.WriteByte(0x15) // streamType audio(5)<<2 | upStream(0)<<1 | reserved(1)
+	b.WriteUint24(0)  // bufferSizeDB
+	b.WriteUint32(0)  // maxBitrate
+	b.WriteUint32(0)  // avgBitrate
+	if decSpecificLen > 0 {
+		writeDescriptorHead(&b, 0x05, len(decoderSpecificInfo)) // DecoderSpecificInfo
+		b.Write(decoderSpecificInfo)
+	}
+	writeDescriptorHead(&b, 0x06, 1) // SLConfigDescriptor
+	b.WriteByte(0x02)
+	return b
+}
+
+// MakeDOps 生成 Opus 的 dOps box 内容
+// https://opus-codec.org/docs/opus_in_isobmff.html
+func MakeDOps(channels byte, preSkip uint16, sampleRate uint32) []byte {
+	var b util.Buffer
+	b.WriteByte(0) // Version
+	b.WriteByte(channels)
+	b.WriteUint16(preSkip)
+	b.WriteUint32(sampleRate)
+	b.WriteUint16(0) // OutputGain
+	b.WriteByte(0)   // ChannelMappingFamily
+	return b
+}
+
+// WriteMP4Ftyp 写入 ftyp box
+func WriteMP4Ftyp(b *util.Buffer, majorBrand string, minorVersion uint32, compatibleBrands ...string) {
+	WriteMP4Box(b, "ftyp", func() {
+		b.WriteString(majorBrand)
+		b.WriteUint32(minorVersion)
+		for _, brand := range compatibleBrands {
+			b.WriteString(brand)
+		}
+	})
+}
+
+// WriteMP4Mvhd 写入 mvhd box，duration 超出32位时使用 version 1
+func WriteMP4Mvhd(b *util.Buffer, timescale uint32, duration uint64, nextTrackID uint32) {
+	version := byte(0)
+	if duration > 0xFFFFFFFF {
+		version = 1
+	}
+	WriteMP4FullBox(b, "mvhd", version, 0, func() {
+		if version == 1 {
+			WriteMP4Uint64(b, 0) // creation_time
+			WriteMP4Uint64(b, 0) // modification_time
+			b.WriteUint32(timescale)
+			WriteMP4Uint64(b, duration)
+		} else {
+			b.WriteUint32(0)
+			b.WriteUint32(0)
+			b.WriteUint32(timescale)
+			b.WriteUint32(uint32(duration))
+		}
+		b.WriteUint32(0x00010000) // rate 1.0
+		b.WriteUint16(0x0100)     // volume 1.0
+		b.Write(make([]byte, 10)) // reserved
+		WriteMP4Matrix(b)
+		b.Write(make([]byte, 24)) // pre_defined
+		b.WriteUint32(nextTrackID)
+	})
+}
+
+// MP4TrakInfo 写入 trak box 所需的轨道信息
+type MP4TrakInfo struct {
+	*MP4SampleEntry
+	Entries       []*MP4SampleEntry // stsd 中的全部采样条目，解码器配置变化时有多个，为空时只写入 MP4SampleEntry
+	TrackID       uint32
+	Timescale     uint32
+	MediaDuration uint64 // 媒体时长，以 Timescale 为单位
+	MovieDuration uint64 // 轨道总时长（含 EmptyDuration），以 mvhd 的 timescale 为单位
+	EmptyDuration uint64 // 轨道开始前的空白时长，以 mvhd 的 timescale 为单位，不为0时写入 edts
+}
+
+// WriteMP4Trak 写入 trak box，stbl 中除 stsd 以外的采样表由 sampleTables 写入
+func WriteMP4Trak(b *util.Buffer, info *MP4TrakInfo, sampleTables func()) {
+	entry := info.MP4SampleEntry
+	trackID, timescale, mediaDuration, movieDuration := info.TrackID, info.Timescale, info.MediaDuration, info.MovieDuration
+	WriteMP4Box(b, "trak", func() {
+		version := byte(0)
+		if movieDuration > 0xFFFFFFFF {
+			version = 1
+		}
+		WriteMP4FullBox(b, "tkhd", version, 0x000003, func() { // track_enabled | track_in_movie
+			if version == 1 {
+				WriteMP4Uint64(b, 0)
+				WriteMP4Uint64(b, 0)
+				b.WriteUint32(trackID)
+				b.WriteUint32(0)
+				WriteMP4Uint64(b, movieDuration)
+			} else {
+				b.WriteUint32(0)
+				b.WriteUint32(0)
+				b.WriteUint32(trackID)
+				b.WriteUint32(0)
+				b.WriteUint32(uint32(movieDuration))
+			}
+			b.Write(make([]byte, 8)) // reserved
+			b.WriteUint16(0)         // layer
+			b.WriteUint16(0)         // alternate_group
+			if entry.IsVideo {
+				b.WriteUint16(0)
+			} else {
+				b.WriteUint16(0x0100)
+			}
+			b.WriteUint16(0) // reserved
+			WriteMP4Matrix(b)
+			b.WriteUint32(uint32(entry.Width) << 16)
+			b.WriteUint32(uint32(entry.Height) << 16)
+		})
+		if info.EmptyDuration > 0 {
+			WriteMP4Edts(b, info.EmptyDuration, movieDuration-info.EmptyDuration)
+		}
+		WriteMP4Box(b, "mdia", func() {
+			version := byte(0)
+			if mediaDuration > 0xFFFFFFFF {
+				version = 1
+			}
+			WriteMP4FullBox(b, "mdhd", version, 0, func() {
+				if version == 1 {
+					WriteMP4Uint64(b, 0)
+					WriteMP4Uint64(b, 0)
+					b.WriteUint32(timescale)
+					WriteMP4Uint64(b, mediaDuration)
+				} else {
+					b.WriteUint32(0)
+					b.WriteUint32(0)
+					b.WriteUint32(timescale)
+					b.WriteUint32(uint32(mediaDuration))
+				}
+				b.WriteUint16(0x55C4) // language und
+				b.WriteUint16(0)      // pre_defined
+			})
+			WriteMP4FullBox(b, "hdlr", 0, 0, func() {
+				b.WriteUint32(0) // pre_defined
+				if entry.IsVideo {
+					b.WriteString("vide")
+					b.Write(make([]byte, 12))
+					b.WriteString("VideoHandler")
+				} else {
+					b.WriteString("soun")
+					b.Write(make([]byte, 12))
+					b.WriteString("SoundHandler")
+				}
+				b.WriteByte(0)
+			})
+			WriteMP4Box(b, "minf", func() {
+				if entry.IsVideo {
+					WriteMP4FullBox(b, "vmhd", 0, 1, func() {
+						b.Write(make([]byte, 8)) // graphicsmode + opcolor
+					})
+				} else {
+					WriteMP4FullBox(b, "smhd", 0, 0, func() {
+						b.WriteUint32(0) // balance + reserved
+					})
+				}
+				WriteMP4Box(b, "dinf", func() {
+					WriteMP4FullBox(b, "dref", 0, 0, func() {
+						b.WriteUint32(1)
+						WriteMP4FullBox(b, "url ", 0, 1, nil) // 媒体数据在同一个文件中
+					})
+				})
+				WriteMP4Box(b, "stbl", func() {
+					WriteMP4FullBox(b, "stsd", 0, 0, func() {
+						entries := info.Entries
+						if len(entries) == 0 {
+							entries = []*MP4SampleEntry{entry}
+						}
+						b.WriteUint32(uint32(len(entries)))
+						for _, e := range entries {
+							WriteMP4SampleEntry(b, e)
+						}
+					})
+					if sampleTables != nil {
+						sampleTables()
+					}
+				})
+			})
+		})
+	})
+}
+
+// WriteMP4Edts 写入带有一个空编辑的 edts box，用于表示轨道相对于影片的起始延迟
+func WriteMP4Edts(b *util.Buffer, emptyDuration uint64, segmentDuration uint64) {
+	WriteMP4Box(b, "edts", func() {
+		version := byte(0)
+		if emptyDuration > 0xFFFFFFFF || segmentDuration > 0xFFFFFFFF {
+			version = 1
+		}
+		WriteMP4FullBox(b, "elst", version, 0, func() {
+			b.WriteUint32(2)
+			if version == 1 {
+				WriteMP4Uint64(b, emptyDuration)
+				WriteMP4Uint64(b, 0xFFFFFFFFFFFFFFFF) // media_time -1
+				b.WriteUint32(0x00010000)
+				WriteMP4Uint64(b, segmentDuration)
+				WriteMP4Uint64(b, 0)
+				b.WriteUint32(0x00010000)
+			} else {
+				b.WriteUint32(uint32(emptyDuration))
+				b.WriteUint32(0xFFFFFFFF)
+				b.WriteUint32(0x00010000) // media_rate 1.0
+				b.WriteUint32(uint32(segmentDuration))
+				b.WriteUint32(0)
+				b.WriteUint32(0x00010000)
+			}
+		})
+	})
+}
+
+// WriteMP4Mvex 写入 fMP4 所需的 mvex box
+func WriteMP4Mvex(b *util.Buffer, trackIDs ...uint32) {
+	WriteMP4Box(b, "mvex", func() {
+		for _, id := range trackIDs {
+			WriteMP4FullBox(b, "trex", 0, 0, func() {
+				b.WriteUint32(id)
+				b.WriteUint32(1) // default_sample_description_index
+				b.WriteUint32(0) // default_sample_duration
+				b.WriteUint32(0) // default_sample_size
+				b.WriteUint32(0) // default_sample_flags
+			})
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"m7s.live/engine/v4/util"
+)
+
+func TestWriteMP4Box(t *testing.T) {
+	var b util.Buffer
+	WriteMP4Box(&b, "moov", func() {
+		WriteMP4FullBox(&b, "mvex", 1, 0x020001, func() {
+			b.WriteUint32(0xAABBCCDD)
+		})
+		WriteMP4Box(&b, "free", nil)
+	})
+	want := []byte{
+		0, 0, 0, 36, 'm', 'o', 'o', 'v',
+		0, 0, 0, 16, 'm', 'v', 'e', 'x', 1, 0x02, 0x00, 0x01, 0xAA, 0xBB, 0xCC, 0xDD,
+		0, 0, 0, 8, 'f', 'r', 'e', 'e',
+	}
+	// 外层 box 大小包含内层 box
+	want[3] = byte(len(want))
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", []byte(b), want)
+	}
+}
+
+func TestWriteMP4Ftyp(t *testing.T) {
+	var b util.Buffer
+	WriteMP4Ftyp(&b, "iso5", 512, "iso5", "cmfc")
+	want := []byte{0, 0, 0, 24, 'f', 't', 'y', 'p', 'i', 's', 'o', '5', 0, 0, 2, 0, 'i', 's', 'o', '5', 'c', 'm', 'f', 'c'}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", []byte(b), want)
+	}
+}
+
+func TestMakeESDS(t *testing.T) {
+	// AAC LC 44100Hz 双声道
+	got := MakeESDS(MP4_ESDS_OBJECT_TYPE_AAC, []byte{0x12, 0x10})
+	want := []byte{
+		0, 0, 0, 0, // version + flags
+		0x03, 0x80, 0x80, 0x80, 34, 0, 1, 0, // ES_Descriptor
+		0x04, 0x80, 0x80, 0x80, 20, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // DecoderConfigDescriptor
+		0x05, 0x80, 0x80, 0x80, 2, 0x12, 0x10, // DecoderSpecificInfo
+		0x06, 0x80, 0x80, 0x80, 1, 0x02, // SLConfigDescriptor
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("aac: got %x, want %x", got, want)
+	}
+	// MP3 没有 DecoderSpecificInfo
+	got = MakeESDS(MP4_ESDS_OBJECT_TYPE_MPEG1_AUDIO, nil)
+	want = []byte{
+		0, 0, 0, 0,
+		0x03, 0x80, 0x80, 0x80, 27, 0, 1, 0,
+		0x04, 0x80, 0x80, 0x80, 13, 0x6B, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x06, 0x80, 0x80, 0x80, 1, 0x02,
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("mp3: got %x, want %x", got, want)
+	}
+}
+
+func TestMakeDOps(t *testing.T) {
+	got := MakeDOps(2, 312, 48000)
+	want := []byte{0, 2, 0x01, 0x38, 0, 0, 0xBB, 0x80, 0, 0, 0}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
+
+func TestWriteMP4SampleEntry(t *testing.T) {
+	var b util.Buffer
+	WriteMP4SampleEntry(&b, &MP4SampleEntry{Type: "mp4a", ConfigType: "esds", Config: []byte{1, 2}, Channels: 2, SampleSize: 16, SampleRate: 44100})
+	want := []byte{
+		0, 0, 0, 46, 'm', 'p', '4', 'a',
+		0, 0, 0, 0, 0, 0, 0, 1, // reserved + data_reference_index
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 16, 0, 0, 0, 0, 0xAC, 0x44, 0, 0, // AudioSampleEntry
+		0, 0, 0, 10, 'e', 's', 'd', 's', 1, 2,
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("audio: got %x, want %x", []byte(b), want)
+	}
+	b = nil
+	WriteMP4SampleEntry(&b, &MP4SampleEntry{Type: "avc1", ConfigType: "avcC", Config: []byte{1}, IsVideo: true, Width: 1280, Height: 720})
+	// VisualSampleEntry 固定部分为 78 字节
+	if len(b) != 8+78+9 || string(b[4:8]) != "avc1" || string(b[8+78+4:8+78+8]) != "avcC" {
+		t.Fatalf("video: %x", []byte(b))
+	}
+	if w, h := util.ReadBE[uint16](b[32:34]), util.ReadBE[uint16](b[34:36]); w != 1280 || h != 720 {
+		t.Fatalf("video size %dx%d", w, h)
+	}
+}
@@ -0,0 +1,97 @@
+package codec
+
+import "errors"
+
+var ErrMPAHeader = errors.New("invalid mpeg audio header")
+
+const (
+	MPA_VERSION_2_5 = 0
+	MPA_VERSION_2   = 2
+	MPA_VERSION_1   = 3
+)
+
+var mpaBitrates = [2][3][15]int{
+	{ // MPEG-1 Layer I, II, III
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{ // MPEG-2/2.5 Layer I, II, III
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mpaSampleRates = [4][3]int{
+	MPA_VERSION_2_5: {11025, 12000, 8000},
+	MPA_VERSION_2:   {22050, 24000, 16000},
+	MPA_VERSION_1:   {44100, 48000, 32000},
+}
+
+// MPEGAudioHeader MPEG-1/2/2.5 Layer I、II、III 的帧头（ISO/IEC 11172-3 2.4.1.3）
+type MPEGAudioHeader struct {
+	Version         byte // MPA_VERSION_1、MPA_VERSION_2、MPA_VERSION_2_5
+	Layer           byte // 1、2、3
+	Bitrate         int  // kbps，0 表示 free format
+	SampleRate      int
+	Channels        byte
+	Padding         byte
+	FrameLength     int // 包含帧头的帧长度，free format 时为0
+	SamplesPerFrame int
+}
+
+func ParseMPEGAudioHeader(b []byte) (h MPEGAudioHeader, err error) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, ErrMPAHeader
+	}
+	h.Version = (b[1] >> 3) & 0x03
+	layer := (b[1] >> 1) & 0x03
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	if h.Version == 1 || layer == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return h, ErrMPAHeader
+	}
+	h.Layer = 4 - layer
+	h.Padding = (b[2] >> 1) & 0x01
+	if b[3]>>6 == 3 {
+		h.Channels = 1
+	} else {
+		h.Channels = 2
+	}
+	lsf := 0
+	if h.Version != MPA_VERSION_1 {
+		lsf = 1
+	}
+	h.Bitrate = mpaBitrates[lsf][h.Layer-1][bitrateIndex]
+	h.SampleRate = mpaSampleRates[h.Version][sampleRateIndex]
+	switch {
+	case h.Layer == 1:
+		h.SamplesPerFrame = 384
+	case h.Layer == 3 && lsf == 1:
+		h.SamplesPerFrame = 576
+	default:
+		h.SamplesPerFrame = 1152
+	}
+	if h.Bitrate > 0 {
+		if h.Layer == 1 {
+			h.FrameLength = (12*h.Bitrate*1000/h.SampleRate + int(h.Padding)) * 4
+		} else {
+			h.FrameLength = h.SamplesPerFrame/8*h.Bitrate*1000/h.SampleRate + int(h.Padding)
+		}
+	}
+	return
+}
+
+// SplitMPEGAudioFrames 按照帧头中的长度切分连续的帧，无法识别的数据作为最后一帧
+func SplitMPEGAudioFrames(b []byte) (frames [][]byte) {
+	for len(b) > 0 {
+		h, err := ParseMPEGAudioHeader(b)
+		if err != nil || h.FrameLength == 0 || h.FrameLength >= len(b) {
+			return append(frames, b)
+		}
+		frames = append(frames, b[:h.FrameLength])
+		b = b[h.FrameLength:]
+	}
+	return
+}
@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseMPEGAudioHeader(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		header []byte
+		want   MPEGAudioHeader
+	}{
+		{"mpeg1 layer3", []byte{0xFF, 0xFB, 0x90, 0x00}, MPEGAudioHeader{Version: MPA_VERSION_1, Layer: 3, Bitrate: 128, SampleRate: 44100, Channels: 2, FrameLength: 417, SamplesPerFrame: 1152}},
+		{"mpeg1 layer3 padding", []byte{0xFF, 0xFB, 0x92, 0x00}, MPEGAudioHeader{Version: MPA_VERSION_1, Layer: 3, Bitrate: 128, SampleRate: 44100, Channels: 2, Padding: 1, FrameLength: 418, SamplesPerFrame: 1152}},
+		{"mpeg2 lsf layer3", []byte{0xFF, 0xF3, 0x80, 0xC0}, MPEGAudioHeader{Version: MPA_VERSION_2, Layer: 3, Bitrate: 64, SampleRate: 22050, Channels: 1, FrameLength: 208, SamplesPerFrame: 576}},
+		{"mpeg1 layer2", []byte{0xFF, 0xFD, 0xA4, 0x00}, MPEGAudioHeader{Version: MPA_VERSION_1, Layer: 2, Bitrate: 192, SampleRate: 48000, Channels: 2, FrameLength: 576, SamplesPerFrame: 1152}},
+		{"mpeg1 layer1", []byte{0xFF, 0xFF, 0xC2, 0x00}, MPEGAudioHeader{Version: MPA_VERSION_1, Layer: 1, Bitrate: 384, SampleRate: 44100, Channels: 2, Padding: 1, FrameLength: 420, SamplesPerFrame: 384}},
+		{"free format", []byte{0xFF, 0xFB, 0x00, 0x00}, MPEGAudioHeader{Version: MPA_VERSION_1, Layer: 3, SampleRate: 44100, Channels: 2, SamplesPerFrame: 1152}},
+	} {
+		got, err := ParseMPEGAudioHeader(tt.header)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	for _, header := range [][]byte{
+		{0xFF, 0xFB, 0x90},       // 长度不足
+		{0xFF, 0x1B, 0x90, 0x00}, // 同步字错误
+		{0xFF, 0xEB, 0x90, 0x00}, // 保留的版本
+		{0xFF, 0xF9, 0x90, 0x00}, // 保留的层
+		{0xFF, 0xFB, 0xF0, 0x00}, // 码率索引为15
+		{0xFF, 0xFB, 0x9C, 0x00}, // 采样率索引为3
+	} {
+		if _, err := ParseMPEGAudioHeader(header); err != ErrMPAHeader {
+			t.Errorf("%x: got %v", header, err)
+		}
+	}
+}
+
+func TestSplitMPEGAudioFrames(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	padded := make([]byte, 418)
+	copy(padded, []byte{0xFF, 0xFB, 0x92, 0x00})
+	data := append(append(append([]byte(nil), frame...), padded...), frame[:100]...)
+	frames := SplitMPEGAudioFrames(data)
+	// 不完整的最后一帧原样保留
+	if len(frames) != 3 || !bytes.Equal(frames[0], frame) || !bytes.Equal(frames[1], padded) || len(frames[2]) != 100 {
+		t.Fatalf("frames %d", len(frames))
+	}
+	// free format 无法确定帧长度，整体作为一帧
+	free := []byte{0xFF, 0xFB, 0x00, 0x00, 1, 2, 3}
+	if frames = SplitMPEGAudioFrames(free); len(frames) != 1 || !bytes.Equal(frames[0], free) {
+		t.Fatalf("free format frames %d", len(frames))
+	}
+}
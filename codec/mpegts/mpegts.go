@@ -73,6 +73,7 @@ const (
 
 	STREAM_TYPE_H264   = 0x1B
 	STREAM_TYPE_H265   = 0x24
+	STREAM_TYPE_H266   = 0x33
 	STREAM_TYPE_AAC    = 0x0F
 	STREAM_TYPE_G711A  = 0x90
 	STREAM_TYPE_G711U  = 0x91
@@ -84,12 +85,14 @@ const (
 	STREAM_TYPE_ADPCM = 0x11
 	STREAM_TYPE_PCM   = 0x0A
 	STREAM_TYPE_AC3   = 0x81
+	STREAM_TYPE_EAC3  = 0x87 // ATSC A/53
 	STREAM_TYPE_DTS   = 0x8A
 	STREAM_TYPE_LPCM  = 0x8B
 	// 1110 xxxx
 	// 110x xxxx
-	STREAM_ID_VIDEO = 0xE0 // ITU-T Rec. H.262 | ISO/IEC 13818-2 or ISO/IEC 11172-2 or ISO/IEC14496-2 video stream number xxxx
-	STREAM_ID_AUDIO = 0xC0 // ISO/IEC 13818-3 or ISO/IEC 11172-3 or ISO/IEC 13818-7 or ISO/IEC14496-3 audio stream number x xxxx
+	STREAM_ID_VIDEO     = 0xE0 // ITU-T Rec. H.262 | ISO/IEC 13818-2 or ISO/IEC 11172-2 or ISO/IEC14496-2 video stream number xxxx
+	STREAM_ID_AUDIO     = 0xC0 // ISO/IEC 13818-3 or ISO/IEC 11172-3 or ISO/IEC 13818-7 or ISO/IEC14496-3 audio stream number x xxxx
+	STREAM_ID_PRIVATE_1 = 0xBD // private_stream_1，AC-3 和 E-AC-3 使用
 
 	PAT_PKT_TYPE = 0
 	PMT_PKT_TYPE = 1
@@ -19,9 +19,15 @@ var (
 	PMT      = []byte{0xe0 | (PID_VIDEO >> 8), PID_VIDEO & 0xff, 0xf0, 0x00} //PcrPID:0x101
 	h264     = []byte{STREAM_TYPE_H264, 0xe0 | (PID_VIDEO >> 8), PID_VIDEO & 0xff, 0xf0, 0x00}
 	h265     = []byte{STREAM_TYPE_H265, 0xe0 | (PID_VIDEO >> 8), PID_VIDEO & 0xff, 0xf0, 0x00}
+	h266     = []byte{STREAM_TYPE_H266, 0xe0 | (PID_VIDEO >> 8), PID_VIDEO & 0xff, 0xf0, 0x00}
 	aac      = []byte{STREAM_TYPE_AAC, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x00}
 	pcma     = []byte{STREAM_TYPE_G711A, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x00}
 	pcmu     = []byte{STREAM_TYPE_G711U, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x00}
+	mpa      = []byte{STREAM_TYPE_AUDIO_MPEG1, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x00}
+	mpa2     = []byte{STREAM_TYPE_AUDIO_MPEG2, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x00}
+	// AC-3 和 E-AC-3 带有 registration descriptor，和 ResolveStreamType 对应
+	ac3      = []byte{STREAM_TYPE_AC3, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x06, DESCRIPTOR_TAG_REGISTRATION, 0x04, 'A', 'C', '-', '3'}
+	eac3     = []byte{STREAM_TYPE_EAC3, 0xe0 | (PID_AUDIO >> 8), PID_AUDIO & 0xff, 0xf0, 0x06, DESCRIPTOR_TAG_REGISTRATION, 0x04, 'E', 'A', 'C', '3'}
 	Stuffing []byte
 )
 
@@ -203,6 +209,35 @@ func ReadPMTDescriptor(lr *io.LimitedReader) (Desc []MpegTsDescriptor, err error
 	return
 }
 
+const (
+	DESCRIPTOR_TAG_REGISTRATION = 0x05
+	DESCRIPTOR_TAG_AC3          = 0x6A // ETSI EN 300 468 AC-3_descriptor
+	DESCRIPTOR_TAG_EAC3         = 0x7A // ETSI EN 300 468 enhanced_AC-3_descriptor
+)
+
+// ResolveStreamType DVB 中 AC-3/E-AC-3 使用 PES private data（0x06），需要根据描述符确定实际的流类型
+func (s *MpegTsPmtStream) ResolveStreamType() byte {
+	if s.StreamType != STREAM_TYPE_PRIVATE_DATA {
+		return s.StreamType
+	}
+	for _, desc := range s.Descriptor {
+		switch desc.Tag {
+		case DESCRIPTOR_TAG_AC3:
+			return STREAM_TYPE_AC3
+		case DESCRIPTOR_TAG_EAC3:
+			return STREAM_TYPE_EAC3
+		case DESCRIPTOR_TAG_REGISTRATION:
+			switch string(desc.Data) {
+			case "AC-3":
+				return STREAM_TYPE_AC3
+			case "EAC3":
+				return STREAM_TYPE_EAC3
+			}
+		}
+	}
+	return s.StreamType
+}
+
 func WritePMTDescriptor(w io.Writer, descs []MpegTsDescriptor) (err error) {
 	for _, desc := range descs {
 		// tag(8)
@@ -339,18 +374,19 @@ func WritePMT(w io.Writer, pmt MpegTsPMT) (err error) {
 // 	return
 // }
 
-func WritePMTPacket(w io.Writer, videoCodec codec.VideoCodecID, audioCodec codec.AudioCodecID) {
+// WritePMTPacket 写入 PMT，audioSampleRate 为 MP2/MP3 的实际采样率，低于32000时为 MPEG-2 LSF（ISO/IEC 13818-3），流类型为0x04
+func WritePMTPacket(w io.Writer, videoCodec codec.VideoCodecID, audioCodec codec.AudioCodecID, audioSampleRate ...uint32) {
 	w.Write(TSHeader)
 	crc := make([]byte, 4)
-	paddingSize := TS_PACKET_SIZE - len(crc) - len(PSI) - len(PMT) - len(TSHeader) - 10
-	pmt := net.Buffers{PSI, PMT}
+	psi := append([]byte(nil), PSI...)
+	pmt := net.Buffers{psi, PMT}
 	switch videoCodec {
 	case codec.CodecID_H264:
 		pmt = append(pmt, h264)
 	case codec.CodecID_H265:
 		pmt = append(pmt, h265)
-	default:
-		paddingSize += 5
+	case codec.CodecID_H266:
+		pmt = append(pmt, h266)
 	}
 	switch audioCodec {
 	case codec.CodecID_AAC:
@@ -359,9 +395,21 @@ func WritePMTPacket(w io.Writer, videoCodec codec.VideoCodecID, audioCodec codec
 		pmt = append(pmt, pcma)
 	case codec.CodecID_PCMU:
 		pmt = append(pmt, pcmu)
-	default:
-		paddingSize += 5
+	case codec.CodecID_MP3, codec.CodecID_MP2:
+		if len(audioSampleRate) > 0 && audioSampleRate[0] > 0 && audioSampleRate[0] < 32000 {
+			pmt = append(pmt, mpa2)
+		} else {
+			pmt = append(pmt, mpa)
+		}
+	case codec.CodecID_AC3:
+		pmt = append(pmt, ac3)
+	case codec.CodecID_EAC3:
+		pmt = append(pmt, eac3)
 	}
+	// section_length 从 program_number 开始计算，包含 CRC，流信息的长度随编码和描述符变化
+	size := util.SizeOfBuffers(pmt)
+	util.PutBE(psi[1:3], uint16(0xb000|(size-3+len(crc))))
+	paddingSize := TS_PACKET_SIZE - len(TSHeader) - size - len(crc)
 	util.PutBE(crc, GetCRC32_2(pmt))
 	pmt = append(pmt, crc, Stuffing[:paddingSize])
 	pmt.WriteTo(w)
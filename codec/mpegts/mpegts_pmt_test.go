@@ -0,0 +1,55 @@
+package mpegts
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"m7s.live/engine/v4/codec"
+)
+
+func TestWritePMTPacket(t *testing.T) {
+	for _, tt := range []struct {
+		video      codec.VideoCodecID
+		audio      codec.AudioCodecID
+		sampleRate uint32
+		streamType []byte // ResolveStreamType 的结果
+		descriptor string
+	}{
+		{codec.CodecID_H264, codec.CodecID_AAC, 0, []byte{STREAM_TYPE_H264, STREAM_TYPE_AAC}, ""},
+		{codec.CodecID_H265, codec.CodecID_AC3, 0, []byte{STREAM_TYPE_H265, STREAM_TYPE_AC3}, "AC-3"},
+		{codec.CodecID_H264, codec.CodecID_EAC3, 0, []byte{STREAM_TYPE_H264, STREAM_TYPE_EAC3}, "EAC3"},
+		{0, codec.CodecID_EAC3, 0, []byte{STREAM_TYPE_EAC3}, "EAC3"},
+		{codec.CodecID_H264, codec.CodecID_MP3, 0, []byte{STREAM_TYPE_H264, STREAM_TYPE_AUDIO_MPEG1}, ""},
+		{codec.CodecID_H264, codec.CodecID_MP3, 44100, []byte{STREAM_TYPE_H264, STREAM_TYPE_AUDIO_MPEG1}, ""},
+		{codec.CodecID_H264, codec.CodecID_MP2, 22050, []byte{STREAM_TYPE_H264, STREAM_TYPE_AUDIO_MPEG2}, ""},
+	} {
+		var b bytes.Buffer
+		WritePMTPacket(&b, tt.video, tt.audio, tt.sampleRate)
+		packet := b.Bytes()
+		if len(packet) != TS_PACKET_SIZE {
+			t.Fatalf("%v %v: packet size %d", tt.video, tt.audio, len(packet))
+		}
+		pmt, err := ReadPMT(bytes.NewReader(packet[4:]))
+		if err != nil {
+			t.Fatalf("%v %v: %v", tt.video, tt.audio, err)
+		}
+		if len(pmt.Stream) != len(tt.streamType) {
+			t.Fatalf("%v %v: streams %d", tt.video, tt.audio, len(pmt.Stream))
+		}
+		for i := range pmt.Stream {
+			if st := pmt.Stream[i].ResolveStreamType(); st != tt.streamType[i] {
+				t.Errorf("%v %v: stream %d type %x", tt.video, tt.audio, i, st)
+			}
+		}
+		audio := pmt.Stream[len(pmt.Stream)-1]
+		if tt.descriptor == "" && len(audio.Descriptor) != 0 || tt.descriptor != "" && (len(audio.Descriptor) != 1 || audio.Descriptor[0].Tag != DESCRIPTOR_TAG_REGISTRATION || string(audio.Descriptor[0].Data) != tt.descriptor) {
+			t.Errorf("%v %v: descriptor %v", tt.video, tt.audio, audio.Descriptor)
+		}
+		// section_length 之后的数据（含 CRC）整体校验结果为0
+		section := packet[5 : 5+3+int(pmt.SectionLength)]
+		if crc := GetCRC32_2(net.Buffers{section}); crc != 0 {
+			t.Errorf("%v %v: crc %x", tt.video, tt.audio, crc)
+		}
+	}
+}
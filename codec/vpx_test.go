@@ -0,0 +1,53 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseVP8Frame(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		frame         []byte
+		keyFrame      bool
+		width, height uint
+		err           error
+	}{
+		// 宽高的高两位是缩放参数，需要去掉
+		{"key frame", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x42, 0xe0, 0x01}, true, 640, 480, nil},
+		{"inter frame", []byte{0x31, 0x02, 0x00}, false, 0, 0, nil},
+		{"short", []byte{0x10, 0x02}, false, 0, 0, ErrVP8FrameShort},
+		{"short key frame", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02}, false, 0, 0, ErrVP8FrameShort},
+		{"bad start code", []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2b, 0x80, 0x02, 0xe0, 0x01}, false, 0, 0, ErrVP8FrameShort},
+	} {
+		keyFrame, width, height, err := ParseVP8Frame(tt.frame)
+		if err != tt.err || keyFrame != tt.keyFrame || width != tt.width || height != tt.height {
+			t.Errorf("%s: got %v %dx%d %v", tt.name, keyFrame, width, height, err)
+		}
+	}
+}
+
+func TestVPCodecConfigurationRecord(t *testing.T) {
+	record := NewVPCodecConfigurationRecord()
+	record.Profile, record.Level, record.BitDepth, record.VideoFullRangeFlag = 2, 31, 10, 1
+	b := record.Marshal()
+	want := []byte{1, 0, 0, 0, 2, 31, 0xa3, 1, 1, 1, 0, 0}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x, want %x", b, want)
+	}
+	var got VPCodecConfigurationRecord
+	if err := got.Unmarshal(b); err != nil || got != record {
+		t.Fatalf("unmarshal %+v %v", got, err)
+	}
+	if err := got.Unmarshal(b[:9]); err != ErrVPCCTooShort {
+		t.Fatalf("short record %v", err)
+	}
+}
+
+func TestVPSequenceHead(t *testing.T) {
+	record := NewVPCodecConfigurationRecord()
+	sh := VPSequenceHead(FourCC_VP9_32, &record)
+	if sh[0] != 0b1001_0000|byte(PacketTypeSequenceStart) || string(sh[1:5]) != "vp09" || !bytes.Equal(sh[5:], record.Marshal()) {
+		t.Fatalf("sequence head %x", sh)
+	}
+}
@@ -20,4 +20,5 @@ type IStream interface {
 	GetPublisherConfig() *config.Publish
 	GetStartTime() time.Time
 	GetType() string
+	GetPath() string
 }
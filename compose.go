@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+// composeResync 来源的时间戳与写入时间偏差超过该值时重新对齐，例如来源重新发布
+const composeResync = 5 * time.Second
+
+// Composer 从不同的流中分别订阅视频和音频，合成为一个流发布
+type Composer struct {
+	Publisher
+	start time.Time // 公共时钟的起点
+}
+
+// composeSource 合成流的一路来源，只订阅视频或者音频
+type composeSource struct {
+	Subscriber
+	composer *Composer
+	isVideo  bool
+	pool     util.BytesPool
+	offset   time.Duration // 来源的时间戳加上 offset 即为公共时钟上的时间
+	synced   bool
+}
+
+// Compose 创建合成流，videoPath 和 audioPath 为视频和音频来源的流路径，可以只指定其中一个
+func (opt *Plugin) Compose(streamPath, videoPath, audioPath string) (*Composer, error) {
+	c := &Composer{start: time.Now()}
+	opt.AssignPubConfig(&c.Publisher)
+	// 只有一路来源时不等待另一种轨道
+	c.Config.PubVideo, c.Config.PubAudio = videoPath != "", audioPath != ""
+	if err := opt.Publish(streamPath, c); err != nil {
+		return nil, err
+	}
+	if videoPath != "" {
+		go c.subscribe(videoPath, true)
+	}
+	if audioPath != "" {
+		go c.subscribe(audioPath, false)
+	}
+	return c, nil
+}
+
+// subscribe 订阅来源，来源断开后重新订阅，直到合成流关闭
+func (c *Composer) subscribe(streamPath string, isVideo bool) {
+	zpath := zap.String("source", streamPath)
+	for c.Err() == nil {
+		src := &composeSource{composer: c, isVideo: isVideo, pool: make(util.BytesPool, 17)}
+		conf := *EngineConfig.GetSubscribeConfig()
+		conf.Internal = true
+		conf.SubVideo, conf.SubAudio = isVideo, !isVideo
+		src.Config = &conf
+		src.SetParentCtx(c.Context)
+		if err := Engine.Subscribe(streamPath, src); err != nil {
+			c.Warn("compose subscribe", zpath, zap.Error(err))
+		} else {
+			c.Info("compose source", zpath, zap.Bool("video", isVideo))
+			src.PlayRaw()
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// rebase 把来源的时间戳换算到公共时钟上，第一帧按照写入时间对齐
+func (s *composeSource) rebase(frame *common.AVFrame) uint32 {
+	wall := frame.WriteTime.Sub(s.composer.start)
+	ts := frame.Timestamp + s.offset
+	if delta := ts - wall; !s.synced || delta > composeResync || delta < -composeResync {
+		s.offset, s.synced = wall-frame.Timestamp, true
+		ts = wall
+	}
+	if ts < 0 {
+		return 0
+	}
+	return uint32(ts / time.Millisecond)
+}
+
+// copyAVCC 复制来源的数据，来源的内存会被回收
+func (s *composeSource) copyAVCC(buffers ...[]byte) (frame util.BLL) {
+	item := s.pool.Get(util.SizeOfBuffers(buffers))
+	n := 0
+	for _, b := range buffers {
+		n += copy(item.Value[n:], b)
+	}
+	frame.Push(item)
+	return
+}
+
+func (s *composeSource) OnEvent(event any) {
+	c := s.composer
+	switch v := event.(type) {
+	case VideoDeConf:
+		frame := s.copyAVCC(v)
+		c.WriteAVCCVideo(0, &frame, s.pool)
+	case AudioDeConf:
+		frame := s.copyAVCC(v)
+		c.WriteAVCCAudio(0, &frame, s.pool)
+	case VideoFrame:
+		frame := s.copyAVCC(v.AVCC.ToBuffers()...)
+		c.WriteAVCCVideo(s.rebase(v.AVFrame), &frame, s.pool)
+	case AudioFrame:
+		frame := s.copyAVCC(v.AVCC.ToBuffers()...)
+		c.WriteAVCCAudio(s.rebase(v.AVFrame), &frame, s.pool)
+	default:
+		s.Subscriber.OnEvent(event)
+	}
+}
+
+// startCompose 创建配置中的合成流
+func startCompose() {
+	for streamPath, source := range EngineConfig.Compose {
+		if _, err := Engine.Compose(streamPath, source.Video, source.Audio); err != nil {
+			Engine.Error("compose", zap.String("stream", streamPath), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/common"
+)
+
+func TestComposeRebase(t *testing.T) {
+	type step struct {
+		timestamp time.Duration // 来源的时间戳
+		write     time.Duration // 写入时间相对于合成流启动的时间
+		want      uint32
+	}
+	for _, tt := range []struct {
+		name  string
+		steps []step
+	}{
+		{"first frame aligned to write time", []step{
+			{10 * time.Second, 2 * time.Second, 2000},
+			{10*time.Second + 40*time.Millisecond, 2*time.Second + 40*time.Millisecond, 2040},
+		}},
+		{"jitter within resync keeps source timing", []step{
+			{10 * time.Second, 2 * time.Second, 2000},
+			{10*time.Second + 40*time.Millisecond, 6 * time.Second, 2040},
+			{10*time.Second + 80*time.Millisecond, 2 * time.Second, 2080},
+		}},
+		{"timestamp reset resyncs", []step{
+			{10 * time.Second, 2 * time.Second, 2000},
+			{0, 8 * time.Second, 8000},
+			{40 * time.Millisecond, 8*time.Second + 40*time.Millisecond, 8040},
+		}},
+		{"timestamp jump ahead resyncs", []step{
+			{10 * time.Second, 2 * time.Second, 2000},
+			{time.Hour, 3 * time.Second, 3000},
+			{time.Hour + 40*time.Millisecond, 3 * time.Second, 3040},
+		}},
+		{"before compose start clamps to zero", []step{
+			{10 * time.Second, -time.Second, 0},
+			{11 * time.Second, 0, 0},
+			{12 * time.Second, time.Second, 1000},
+		}},
+	} {
+		start := time.Now()
+		s := &composeSource{composer: &Composer{start: start}}
+		for i, st := range tt.steps {
+			frame := &common.AVFrame{}
+			frame.Timestamp = st.timestamp
+			frame.WriteTime = start.Add(st.write)
+			if got := s.rebase(frame); got != st.want {
+				t.Errorf("%s: step %d got %d, want %d", tt.name, i, got, st.want)
+			}
+		}
+	}
+}
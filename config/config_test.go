@@ -51,3 +51,59 @@ func TestGlobal(t *testing.T) {
 		}
 	})
 }
+
+// TestStreamAlias 测试别名解析，包括正则分组替换
+func TestStreamAlias(t *testing.T) {
+	var alias StreamAlias
+	alias.Set("legacy/foo", "live/foo")
+	if got := alias.Resolve("legacy/foo"); got != "live/foo" {
+		t.Fatal(got)
+	}
+	alias.Set(`old/(\w+)`, "live/$1")
+	if got := alias.Resolve("old/bar"); got != "old/bar" {
+		t.Fatal("regexp disabled", got)
+	}
+	alias.EnableRegexp = true
+	if got := alias.Resolve("old/bar"); got != "live/bar" {
+		t.Fatal(got)
+	}
+	if got := alias.Resolve("old/bar/baz"); got != "old/bar/baz" {
+		t.Fatal("partial match", got)
+	}
+	if !alias.Delete("legacy/foo") || alias.Resolve("legacy/foo") != "legacy/foo" {
+		t.Fatal("delete")
+	}
+	// 多个正则都能匹配时使用更具体的别名，结果与 map 的遍历顺序无关
+	alias.Set(`old/(.+)`, "vod/$1")
+	alias.Set(`old/cam(\d+)`, "camera/$1")
+	for i := 0; i < 20; i++ {
+		if got := alias.Resolve("old/cam1"); got != "camera/1" {
+			t.Fatal("most specific", got)
+		}
+		if got := alias.Resolve("old/bar"); got != "live/bar" {
+			t.Fatal("longest", got)
+		}
+		if got := alias.Resolve("old/a/b"); got != "vod/a/b" {
+			t.Fatal("fallback", got)
+		}
+	}
+	alias.Set("legacy/a", "live/a")
+	alias.Set("legacy/b", "live/a")
+	if got := alias.Aliases("live/a"); len(got) != 2 || got[0] != "legacy/a" || got[1] != "legacy/b" {
+		t.Fatal("aliases", got)
+	}
+	// 正则只编译一次，重新加载配置替换整个 Paths 后重新编译
+	alias.Resolve("old/bar")
+	rules := alias.rules
+	alias.Resolve("old/cam1")
+	if len(rules) == 0 || &alias.rules[0] != &rules[0] {
+		t.Fatal("rules recompiled")
+	}
+	alias.Paths = map[string]string{`new/(\w+)`: "live/$1"}
+	if got := alias.Resolve("new/bar"); got != "live/bar" {
+		t.Fatal("reload", got)
+	}
+	if got := alias.Resolve("old/bar"); got != "old/bar" {
+		t.Fatal("reload removed", got)
+	}
+}
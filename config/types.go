@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -34,16 +36,24 @@ type Publish struct {
 	PubAudio          bool          `default:"true" desc:"是否发布音频"`
 	PubVideo          bool          `default:"true" desc:"是否发布视频"`
 	KickExist         bool          `desc:"是否踢掉已经存在的发布者"`                     // 是否踢掉已经存在的发布者
+	DuplicatePolicy   string        `desc:"重复发布策略" enum:"reject:拒绝,kick:踢掉老的发布者,standby:热备,priority:优先级高的踢掉老的发布者"` // 为空则按照 KickExist 决定
+	PriorityArgName   string        `default:"priority" desc:"发布优先级参数名"`      // 发布优先级参数名，用于 priority 策略
 	PublishTimeout    time.Duration `default:"10s" desc:"发布无数据超时"`            // 发布无数据超时
 	WaitCloseTimeout  time.Duration `desc:"延迟自动关闭（等待重连）"`                     // 延迟自动关闭（等待重连）
 	DelayCloseTimeout time.Duration `desc:"延迟自动关闭（无订阅时）"`                     // 延迟自动关闭（无订阅时）
 	IdleTimeout       time.Duration `desc:"空闲(无订阅)超时"`                        // 空闲(无订阅)超时
 	PauseTimeout      time.Duration `default:"30s" desc:"暂停超时时间"`             // 暂停超时
 	BufferTime        time.Duration `desc:"缓冲长度(单位：秒)，0代表取最近关键帧"`             // 缓冲长度(单位：秒)，0代表取最近关键帧
+	DVRPath           string        `desc:"时光回溯落盘目录，为空则不落盘"`                 // 超出缓冲长度的GOP写入该目录，为空则不落盘
+	DVRTime           time.Duration `default:"1h" desc:"时光回溯落盘保留时长"`            // 时光回溯落盘保留时长
 	SpeedLimit        time.Duration `default:"500ms" desc:"速度限制最大等待时间,0则不等待"` //速度限制最大等待时间
 	Key               string        `desc:"发布鉴权key"`                          // 发布鉴权key
 	SecretArgName     string        `default:"secret" desc:"发布鉴权参数名"`         // 发布鉴权参数名
 	ExpireArgName     string        `default:"expire" desc:"发布鉴权失效时间参数名"`     // 发布鉴权失效时间参数名
+	TokenArgName      string        `default:"token" desc:"发布JWT鉴权参数名"`       // 发布JWT鉴权参数名
+	JWTSecret         string        `desc:"发布JWT鉴权HS256密钥"`                  // 发布JWT鉴权HS256密钥
+	JWTPublicKey      string        `desc:"发布JWT鉴权RS256/ES256公钥文件"`          // PEM 格式的公钥或证书文件
+	JWKSFile          string        `desc:"发布JWT鉴权JWKS文件"`                   // 本地 JWKS 文件，按 kid 选择公钥
 	RingSize          string        `default:"256-1024" desc:"缓冲范围"`          // 初始缓冲区大小
 }
 
@@ -51,6 +61,17 @@ func (c Publish) GetPublishConfig() Publish {
 	return c
 }
 
+// GetDuplicatePolicy 重复发布策略，没有配置时按照 KickExist 决定
+func (c *Publish) GetDuplicatePolicy() string {
+	if c.DuplicatePolicy != "" {
+		return c.DuplicatePolicy
+	}
+	if c.KickExist {
+		return "kick"
+	}
+	return "reject"
+}
+
 type Subscribe struct {
 	SubAudio        bool          `default:"true" desc:"是否订阅音频"`
 	SubVideo        bool          `default:"true" desc:"是否订阅视频"`
@@ -58,6 +79,8 @@ type Subscribe struct {
 	SubAudioArgName string        `default:"ats" desc:"指定订阅的音频轨道参数名"`                    // 指定订阅的音频轨道参数名
 	SubDataArgName  string        `default:"dts" desc:"指定订阅的数据轨道参数名"`                    // 指定订阅的数据轨道参数名
 	SubModeArgName  string        `desc:"指定订阅的模式参数名"`                                    // 指定订阅的模式参数名
+	SeekArgName     string        `default:"seek" desc:"时光回溯相对时间参数名"`                   // 时光回溯相对时间参数名，如 seek=-37s
+	AtArgName       string        `default:"at" desc:"时光回溯绝对时间参数名"`                     // 时光回溯绝对时间参数名，RFC3339 格式
 	SubAudioTracks  []string      `desc:"指定订阅的音频轨道"`                                     // 指定订阅的音频轨道
 	SubVideoTracks  []string      `desc:"指定订阅的视频轨道"`                                     // 指定订阅的视频轨道
 	SubDataTracks   []string      `desc:"指定订阅的数据轨道"`                                     // 指定订阅的数据轨道
@@ -69,6 +92,10 @@ type Subscribe struct {
 	Key             string        `desc:"订阅鉴权key"`                                       // 订阅鉴权key
 	SecretArgName   string        `default:"secret" desc:"订阅鉴权参数名"`                      // 订阅鉴权参数名
 	ExpireArgName   string        `default:"expire" desc:"订阅鉴权失效时间参数名"`                  // 订阅鉴权失效时间参数名
+	TokenArgName    string        `default:"token" desc:"订阅JWT鉴权参数名"`                    // 订阅JWT鉴权参数名
+	JWTSecret       string        `desc:"订阅JWT鉴权HS256密钥"`                               // 订阅JWT鉴权HS256密钥
+	JWTPublicKey    string        `desc:"订阅JWT鉴权RS256/ES256公钥文件"`                       // PEM 格式的公钥或证书文件
+	JWKSFile        string        `desc:"订阅JWT鉴权JWKS文件"`                                // 本地 JWKS 文件，按 kid 选择公钥
 	Internal        bool          `default:"false" desc:"是否内部订阅"`                        // 是否内部订阅
 }
 
@@ -197,11 +224,202 @@ type Console struct {
 	PublicAddrTLS string `desc:"远程控制台公网TLS地址"`
 }
 
+// Webhook 流生命周期事件回调
+type Webhook struct {
+	URLs          map[string]string `desc:"事件回调地址，key为事件类型，*代表所有事件"` // key 为 create、publish、republish、trackavailable、waitpublish、waitclose、close、unsubscribe、invitepublish 或 *
+	Secret        string            `desc:"回调签名密钥"`                   // 不为空时使用 HMAC-SHA256 对请求体签名
+	Retry         int               `default:"3" desc:"回调失败重试次数"`      // 回调失败重试次数
+	RetryInterval time.Duration     `default:"1s" desc:"回调重试间隔"`       // 首次重试间隔，之后每次翻倍，最小100ms
+	Timeout       time.Duration     `default:"5s" desc:"回调请求超时"`       // 回调请求超时
+	QueueSize     int               `default:"1024" desc:"回调队列长度"`     // 队列满时丢弃新的事件，修改后需要重启才能生效
+}
+
+// GetURL 获取事件对应的回调地址
+func (w *Webhook) GetURL(event string) string {
+	if url, ok := w.URLs[event]; ok {
+		return url
+	}
+	return w.URLs["*"]
+}
+
+// Origin 边缘节点回源，订阅者创建流时从源站拉流
+type Origin struct {
+	Nodes             []string      `desc:"源站地址列表"`                                                    // 如 rtmp://10.0.0.1:1935，拉流地址为源站地址加上流路径
+	Policy            string        `default:"hash" desc:"源站选择策略" enum:"hash:按流路径哈希,roundrobin:轮询,failover:按顺序故障转移"` // 选中的源站失败后依次尝试后面的源站
+	DelayCloseTimeout time.Duration `default:"10s" desc:"无订阅者后停止回源的延迟"`                                     // 无订阅者后停止回源的延迟
+	PullTimeout       time.Duration `default:"10s" desc:"插件按需拉流时等待发布的超时"`                                 // 没有注册回源拉流者时邀请插件拉流，超时后尝试下一个源站
+}
+
+// StreamAlias 流路径别名，订阅别名时订阅实际的流
+type StreamAlias struct {
+	Paths        map[string]string `desc:"别名列表"`     // key 为别名，value 为实际的流路径，启用正则时可用 $1 引用分组
+	EnableRegexp bool              `desc:"是否启用正则表达式"` // 是否启用正则表达式
+	locker       sync.RWMutex
+	rules        []aliasRule // 排好序并编译好的正则别名
+	rulesOf      uintptr     // 生成 rules 时的 Paths，重新加载配置会替换整个 Paths，Set 和 Delete 会清零
+}
+
+type aliasRule struct {
+	re     *regexp.Regexp
+	target string
+}
+
+// compile 按具体程度排序并编译正则别名，需要持有写锁
+// 多个别名都能匹配的情况下，优先使用更长（更具体）的别名，长度相同时按字典序
+func (a *StreamAlias) compile() {
+	keys := make([]string, 0, len(a.Paths))
+	for k := range a.Paths {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	a.rules = nil
+	for _, k := range keys {
+		if r, err := regexp.Compile("^" + k + "$"); err == nil {
+			a.rules = append(a.rules, aliasRule{r, a.Paths[k]})
+		}
+	}
+	a.rulesOf = reflect.ValueOf(a.Paths).Pointer()
+}
+
+// Resolve 返回别名对应的流路径，不是别名则原样返回，正则别名只在别名变化后重新编译
+func (a *StreamAlias) Resolve(streamPath string) string {
+	a.locker.RLock()
+	target, ok := a.Paths[streamPath]
+	enableRegexp, rules, compiled := a.EnableRegexp && len(a.Paths) > 0, a.rules, a.rulesOf != 0 && a.rulesOf == reflect.ValueOf(a.Paths).Pointer()
+	a.locker.RUnlock()
+	if ok {
+		return target
+	}
+	if !enableRegexp {
+		return streamPath
+	}
+	if !compiled {
+		a.locker.Lock()
+		a.compile()
+		rules = a.rules
+		a.locker.Unlock()
+	}
+	for _, rule := range rules {
+		if group := rule.re.FindStringSubmatch(streamPath); group != nil {
+			target = rule.target
+			for i := len(group) - 1; i >= 0; i-- {
+				target = strings.ReplaceAll(target, fmt.Sprintf("$%d", i), group[i])
+			}
+			return target
+		}
+	}
+	return streamPath
+}
+
+// Set 添加或修改别名
+func (a *StreamAlias) Set(alias, streamPath string) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+	if a.Paths == nil {
+		a.Paths = make(map[string]string)
+	}
+	a.Paths[alias] = streamPath
+	a.rulesOf = 0
+}
+
+// Delete 删除别名
+func (a *StreamAlias) Delete(alias string) bool {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+	_, ok := a.Paths[alias]
+	delete(a.Paths, alias)
+	a.rulesOf = 0
+	return ok
+}
+
+// Aliases 返回指向 streamPath 的别名，正则别名无法列举，只返回和流路径完全相同的目标
+func (a *StreamAlias) Aliases(streamPath string) (aliases []string) {
+	a.locker.RLock()
+	defer a.locker.RUnlock()
+	for k, v := range a.Paths {
+		if v == streamPath {
+			aliases = append(aliases, k)
+		}
+	}
+	sort.Strings(aliases)
+	return
+}
+
+// List 复制一份别名列表
+func (a *StreamAlias) List() map[string]string {
+	a.locker.RLock()
+	defer a.locker.RUnlock()
+	list := make(map[string]string, len(a.Paths))
+	for k, v := range a.Paths {
+		list[k] = v
+	}
+	return list
+}
+
+// Compose 合成流的来源，分别从两个流中订阅视频和音频
+type Compose struct {
+	Video string `desc:"视频来源流路径"`
+	Audio string `desc:"音频来源流路径"`
+}
+
+// Failover 主备源，当前源卡住时按顺序切换到下一个源
+type Failover struct {
+	Sources      map[string][]string `desc:"主备源列表"`                       // key 为流路径，value 为按顺序排列的拉流地址
+	StallTimeout time.Duration       `default:"3s" desc:"源卡住的判定时间"` // 应小于 PublishTimeout，轨道超过该时间没有写入则切换
+}
+
+// Cluster 集群流注册表，用于查找流所在的节点以及防止多个节点同时发布同一个流
+type Cluster struct {
+	NodeID    string        `desc:"节点标识，为空则使用主机名"`
+	Registry  string        `default:"local" desc:"注册表类型" enum:"local:单机,gossip:UDP广播"`
+	ListenUDP string        `desc:"gossip 监听的 UDP 地址"`  // 如 :4400
+	Peers     []string      `desc:"其他节点的 gossip 地址"` // 如 10.0.0.2:4400，只接受这些地址发来的消息
+	Secret    string        `desc:"gossip 消息签名密钥"`    // 各节点必须相同，为空则不启用 gossip
+	Advertise string        `desc:"本节点对外的 HTTP 地址"`  // 如 http://10.0.0.1:8080，其他节点通过该地址踢掉本节点的发布者
+	Interval  time.Duration `default:"1s" desc:"广播间隔"`
+	TTL       time.Duration `default:"5s" desc:"节点超时时间"` // 超过该时间没有收到广播则认为节点已经下线
+}
+
+// IOLimit 发布者或订阅者的数量限制，0为不限制
+type IOLimit struct {
+	Total     int            `desc:"全局最大数量"`     // 全局最大数量
+	PerApp    int            `desc:"每个应用最大数量"`   // 每个应用最大数量
+	PerStream int            `desc:"每个流最大数量"`    // 每个流最大数量，对发布者无效
+	PerIP     int            `desc:"每个IP最大数量"`   // 每个IP最大数量
+	Apps      map[string]int `desc:"指定应用的最大数量"` // key 为应用名，优先于 PerApp
+}
+
+// RemoteAuth 通过 HTTP 回调进行发布和订阅鉴权
+type RemoteAuth struct {
+	PublishURL   string        `desc:"发布鉴权回调地址"`              // 为空则不进行远程发布鉴权
+	SubscribeURL string        `desc:"订阅鉴权回调地址"`              // 为空则不进行远程订阅鉴权
+	Timeout      time.Duration `default:"3s" desc:"鉴权请求超时"`     // 鉴权请求超时
+	CacheTTL     time.Duration `default:"1m" desc:"鉴权结果缓存时长"`   // 鉴权结果缓存时长，0则不缓存
+	FailOpen     bool          `desc:"鉴权服务不可用时是否放行"`           // 鉴权服务不可用时放行，否则拒绝
+}
+
 type Engine struct {
 	Publish
 	Subscribe
 	HTTP
 	Console
+	Webhook             Webhook       `desc:"事件回调"`
+	RemoteAuth          RemoteAuth    `desc:"远程鉴权"`
+	Origin              Origin        `desc:"回源"`
+	Cluster             Cluster       `desc:"集群"`
+	Failover            Failover      `desc:"主备源"`
+	Alias               StreamAlias   `desc:"流路径别名"`
+	Compose             map[string]Compose `desc:"合成流"` // key 为合成流的流路径
+	StreamGroups        map[string][]string `desc:"多码率流组"` // key 为组名，value 为按顺序排列的成员，形如 live/test 或 live/test?vts=h264_1
+	SubscribeLimit      IOLimit       `desc:"订阅者数量限制"`
+	PublishLimit        IOLimit       `desc:"发布者数量限制"`
+	EgressLimit         int           `desc:"出口带宽预算(字节/秒)，0为不限制"`                              // 超过预算时拒绝新的订阅者
+	EgressWarnRatio     float64       `default:"0.9" desc:"出口带宽达到预算的比例时发出事件"`                   // 出口带宽达到预算的该比例时发出 BandwidthEvent
 	EnableAVCC          bool          `default:"true" desc:"启用AVCC格式，rtmp、http-flv协议使用"`                 //启用AVCC格式，rtmp、http-flv协议使用
 	EnableRTP           bool          `default:"true" desc:"启用RTP格式，rtsp、webrtc等协议使用"`                   //启用RTP格式，rtsp、webrtc等协议使用
 	EnableSubEvent      bool          `default:"true" desc:"启用订阅事件,禁用可以提高性能"`                            //启用订阅事件,禁用可以提高性能
@@ -96,6 +96,12 @@ func TryInvitePublish(streamPath string) {
 	}
 }
 
+// InviteOrigin 回源邀请事件，没有注册回源拉流者时发给插件，Remote 为源站拉流地址
+type InviteOrigin struct {
+	Event[string]
+	Remote string
+}
+
 // InviteTrackEvent 邀请推送指定 Track 事件(转码需要)
 type InviteTrackEvent struct {
 	Event[string]
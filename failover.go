@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/track"
+)
+
+// failoverStream 按顺序排列的多个源，同一时间只从一个源拉流
+type failoverStream struct {
+	*log.Logger
+	streamPath string
+	urls       []string
+	active     int
+	puller     IPuller
+	switchTime time.Time
+}
+
+// startFailover 为配置了主备源的流启动拉流
+func startFailover(ctx context.Context) {
+	if len(EngineConfig.Failover.Sources) > 0 && EngineConfig.Failover.StallTimeout <= 0 {
+		Engine.Error("failover stallTimeout must be positive", zap.Duration("stallTimeout", EngineConfig.Failover.StallTimeout))
+		return
+	}
+	for streamPath, urls := range EngineConfig.Failover.Sources {
+		if len(urls) > 0 {
+			f := &failoverStream{Logger: Engine.With(zap.String("stream", streamPath)), streamPath: streamPath, urls: urls}
+			go f.run(ctx)
+		}
+	}
+}
+
+func (f *failoverStream) run(ctx context.Context) {
+	stallTimeout := EngineConfig.Failover.StallTimeout
+	f.switchTo(ctx, 0, stallTimeout)
+	ticker := time.NewTicker(stallTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if f.puller != nil {
+				f.puller.Stop(zap.String("reason", "shutdown"))
+			}
+			return
+		case <-ticker.C:
+			if f.stalled(stallTimeout) {
+				f.switchTo(ctx, f.active+1, stallTimeout)
+			}
+		}
+	}
+}
+
+// stalled 当前源断开或者所有音视频轨道超过 stallTimeout 没有写入
+func (f *failoverStream) stalled(stallTimeout time.Duration) bool {
+	if f.puller == nil || f.puller.IsClosed() {
+		return time.Since(f.switchTime) > stallTimeout
+	}
+	s := Streams.Get(f.streamPath)
+	if s == nil {
+		return true
+	}
+	lastWriteTime := f.switchTime
+	s.Tracks.Range(func(_ string, t common.Track) {
+		switch t.(type) {
+		case *track.Audio, *track.Video:
+			if t.LastWriteTime().After(lastWriteTime) {
+				lastWriteTime = t.LastWriteTime()
+			}
+		}
+	})
+	if stalled := time.Since(lastWriteTime) > stallTimeout; stalled {
+		f.Warn("source stalled", zap.String("url", f.urls[f.active]), zap.Time("last writetime", lastWriteTime))
+		return true
+	}
+	return false
+}
+
+// connect 在单独的协程中连接，超过 timeout 仍未连上则放弃，避免阻塞卡顿检测
+func (f *failoverStream) connect(ctx context.Context, puller IPuller, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- puller.Connect()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	// 放弃的连接在连上之后断开
+	go func() {
+		if <-done == nil {
+			puller.Disconnect()
+		}
+	}()
+	return ErrConnectTimeout
+}
+
+// switchTo 从第 start 个源开始依次尝试，新的发布者踢掉老的发布者并接管轨道，订阅者不会收到 SEwaitPublish
+func (f *failoverStream) switchTo(ctx context.Context, start int, timeout time.Duration) {
+	f.switchTime = time.Now()
+	for i := range f.urls {
+		if ctx.Err() != nil {
+			return
+		}
+		index := (start + i) % len(f.urls)
+		url := f.urls[index]
+		puller, err := newOriginPuller(f.streamPath, url)
+		if err != nil {
+			f.Error("failover source", zap.String("url", url), zap.Error(err))
+			continue
+		}
+		puber := puller.GetPublisher()
+		puber.Config.DuplicatePolicy = "kick"
+		if err = f.connect(ctx, puller, timeout); err != nil {
+			puller.Error("failover connect", zap.Error(err))
+			continue
+		}
+		if err = puller.Publish(f.streamPath, puller); err != nil {
+			puller.Error("failover publish", zap.Error(err))
+			puller.Disconnect()
+			continue
+		}
+		if old := f.puller; old != nil && !old.IsClosed() {
+			old.Stop(zap.String("reason", "failover"))
+		}
+		f.Info("switch source", zap.String("url", url))
+		f.puller, f.active, f.switchTime = puller, index, time.Now()
+		go func() {
+			if err := puller.Pull(); err != nil && !puller.IsClosed() {
+				puller.Error("failover pull", zap.Error(err))
+			}
+			puller.Disconnect()
+		}()
+		return
+	}
+	f.Warn("all sources failed")
+}
@@ -24,6 +24,12 @@ type GlobalConfig struct {
 	config.Engine
 }
 
+func (conf *GlobalConfig) OnEvent(event any) {
+	conf.Engine.OnEvent(event)
+	webhook.OnEvent(&conf.Webhook, event)
+	onRegistryEvent(event)
+}
+
 func (conf *GlobalConfig) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/favicon.ico" {
 		http.ServeFile(rw, r, "favicon.ico")
@@ -42,14 +48,29 @@ func (conf *GlobalConfig) API_summary(rw http.ResponseWriter, r *http.Request) {
 	util.ReturnValue(&summary, rw, r)
 }
 
+// API_metrics 以 Prometheus 文本格式输出流、轨道和订阅者的指标
+func (conf *GlobalConfig) API_metrics(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	collectMetrics().WriteTo(rw)
+}
+
 func (conf *GlobalConfig) API_plugins(rw http.ResponseWriter, r *http.Request) {
 	util.ReturnValue(Plugins, rw, r)
 }
 
+// streamWithAlias 流的详细信息以及指向该流的别名
+type streamWithAlias struct {
+	*Stream
+	Aliases []string `json:",omitempty"`
+}
+
 func (conf *GlobalConfig) API_stream(rw http.ResponseWriter, r *http.Request) {
 	if streamPath := r.URL.Query().Get("streamPath"); streamPath != "" {
+		streamPath = conf.Alias.Resolve(streamPath)
 		if s := Streams.Get(streamPath); s != nil {
-			util.ReturnValue(s, rw, r)
+			util.ReturnValue(streamWithAlias{s, conf.Alias.Aliases(s.Path)}, rw, r)
+		} else if loc := remoteStream(streamPath); loc != nil {
+			util.ReturnValue(loc, rw, r) // 流在其他节点上
 		} else {
 			util.ReturnError(util.APIErrorNoStream, NO_SUCH_STREAM, rw, r)
 		}
@@ -58,6 +79,112 @@ func (conf *GlobalConfig) API_stream(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// API_stream_alias 列出所有的流路径别名
+func (conf *GlobalConfig) API_stream_alias(rw http.ResponseWriter, r *http.Request) {
+	util.ReturnFetchValue(conf.Alias.List, rw, r)
+}
+
+// API_stream_alias_add 添加或修改别名，之后的订阅生效
+func (conf *GlobalConfig) API_stream_alias_add(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	alias, streamPath := q.Get("alias"), q.Get("streamPath")
+	if alias == "" || streamPath == "" {
+		util.ReturnError(util.APIErrorQueryParse, "alias and streamPath required", rw, r)
+		return
+	}
+	conf.Alias.Set(alias, streamPath)
+	util.ReturnOK(rw, r)
+}
+
+// API_stream_alias_remove 删除别名
+func (conf *GlobalConfig) API_stream_alias_remove(rw http.ResponseWriter, r *http.Request) {
+	if conf.Alias.Delete(r.URL.Query().Get("alias")) {
+		util.ReturnOK(rw, r)
+	} else {
+		util.ReturnError(util.APIErrorNotFound, "no such alias", rw, r)
+	}
+}
+
+// API_compose 创建合成流，参数 video 和 audio 为视频和音频来源的流路径
+func (conf *GlobalConfig) API_compose(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	streamPath, video, audio := q.Get("streamPath"), q.Get("video"), q.Get("audio")
+	if streamPath == "" || video == "" && audio == "" {
+		util.ReturnError(util.APIErrorQueryParse, "streamPath and video or audio required", rw, r)
+		return
+	}
+	if _, err := Engine.Compose(streamPath, video, audio); err != nil {
+		util.ReturnError(util.APIErrorPublish, err.Error(), rw, r)
+	} else {
+		util.ReturnOK(rw, r)
+	}
+}
+
+// API_subscribe_switch 把订阅者切换到流中的另一个轨道，视频等待关键帧，并重新发送序列头
+func (conf *GlobalConfig) API_subscribe_switch(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s := Streams.Get(q.Get("streamPath"))
+	if s == nil {
+		util.ReturnError(util.APIErrorNoStream, NO_SUCH_STREAM, rw, r)
+		return
+	}
+	suber := s.Subscribers.Find(q.Get("id"))
+	if suber == nil {
+		util.ReturnError(util.APIErrorNoSubscriber, "no such subscriber", rw, r)
+		return
+	}
+	if err := suber.SwitchTrack(q.Get("track")); err == ErrTrackNotSupport {
+		util.ReturnError(util.APIErrorQueryParse, err.Error(), rw, r)
+	} else if err != nil {
+		util.ReturnError(util.APIErrorNotFound, err.Error(), rw, r)
+	} else {
+		util.ReturnOK(rw, r)
+	}
+}
+
+// API_stream_group 查看多码率流组，不指定 name 时返回所有的流组
+func (conf *GlobalConfig) API_stream_group(rw http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("name"); name != "" {
+		if group := findGroup(name); group != nil {
+			util.ReturnValue(group, rw, r)
+		} else {
+			util.ReturnError(util.APIErrorNotFound, "no such group", rw, r)
+		}
+	} else {
+		util.ReturnFetchValue(groups, rw, r)
+	}
+}
+
+// API_stream_group_switch 把订阅者切换到流组中的另一路视频，rendition 为成员序号
+func (conf *GlobalConfig) API_stream_group_switch(rw http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	group := findGroup(q.Get("name"))
+	if group == nil {
+		util.ReturnError(util.APIErrorNotFound, "no such group", rw, r)
+		return
+	}
+	i, err := strconv.Atoi(q.Get("rendition"))
+	if err != nil || i < 0 || i >= len(group.Renditions) || group.Renditions[i].video == nil {
+		util.ReturnError(util.APIErrorNotFound, "no such rendition", rw, r)
+		return
+	}
+	s := Streams.Get(q.Get("streamPath"))
+	if s == nil {
+		util.ReturnError(util.APIErrorNoStream, NO_SUCH_STREAM, rw, r)
+		return
+	}
+	suber := s.Subscribers.Find(q.Get("id"))
+	if suber == nil {
+		util.ReturnError(util.APIErrorNoSubscriber, "no such subscriber", rw, r)
+		return
+	}
+	if err := suber.SwitchVideo(group.Renditions[i].video); err != nil {
+		util.ReturnError(util.APIErrorInternal, err.Error(), rw, r)
+	} else {
+		util.ReturnOK(rw, r)
+	}
+}
+
 func (conf *GlobalConfig) API_sysInfo(rw http.ResponseWriter, r *http.Request) {
 	util.ReturnValue(&SysInfo, rw, r)
 }
@@ -215,6 +342,28 @@ func (conf *GlobalConfig) API_stop_push(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// API_stop_publish 踢掉发布者，用于其他节点发布同一个流时踢掉本节点的发布者，请求必须带有 gossip 签名
+func (conf *GlobalConfig) API_stop_publish(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	streamPath := q.Get("streamPath")
+	gossip, ok := Registry.(*GossipRegistry)
+	if !ok {
+		util.ReturnError(util.APIErrorQueryParse, ErrGossipSecret.Error(), w, r)
+		return
+	}
+	if err := gossip.VerifyKick(streamPath, q.Get("ts"), q.Get("sign")); err != nil {
+		util.ReturnError(util.APIErrorQueryParse, err.Error(), w, r)
+		return
+	}
+	s := Streams.Get(streamPath)
+	if s == nil || s.Publisher == nil {
+		util.ReturnError(util.APIErrorNoStream, NO_SUCH_STREAM, w, r)
+		return
+	}
+	s.Publisher.GetPublisher().Stop(zap.String("reason", "stop by api"))
+	util.ReturnOK(w, r)
+}
+
 func (conf *GlobalConfig) API_stop_subscribe(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	streamPath := q.Get("streamPath")
@@ -265,9 +414,18 @@ func (conf *GlobalConfig) API_replay_rtpdump(w http.ResponseWriter, r *http.Requ
 		pub.ACodec = codec.CodecID_PCMA
 	case "pcmu":
 		pub.ACodec = codec.CodecID_PCMU
+	case "g722":
+		pub.ACodec = codec.CodecID_G722
 	}
 	ss := strings.Split(dumpFile, ",")
 	if len(ss) > 1 {
+		// 多个文件同时写入，无法统一控制回放
+		for _, key := range []string{"loop", "start", "end", "speed"} {
+			if q.Has(key) {
+				util.ReturnError(util.APIErrorQueryParse, key+" not supported with multiple dump files", w, r)
+				return
+			}
+		}
 		if err := Engine.Publish(streamPath, &pub); err != nil {
 			util.ReturnError(util.APIErrorPublish, err.Error(), w, r)
 		} else {
@@ -282,6 +440,10 @@ func (conf *GlobalConfig) API_replay_rtpdump(w http.ResponseWriter, r *http.Requ
 			util.ReturnOK(w, r)
 		}
 	} else {
+		if err := pub.Replay.ParseQuery(q); err != nil {
+			util.ReturnError(util.APIErrorQueryParse, err.Error(), w, r)
+			return
+		}
 		f, err := os.Open(dumpFile)
 		if err != nil {
 			util.ReturnError(util.APIErrorOpen, err.Error(), w, r)
@@ -292,7 +454,7 @@ func (conf *GlobalConfig) API_replay_rtpdump(w http.ResponseWriter, r *http.Requ
 		} else {
 			pub.SetIO(f)
 			util.ReturnOK(w, r)
-			go pub.Feed(f)
+			go pub.ReplayRTPDump(f)
 		}
 	}
 }
@@ -307,22 +469,22 @@ func (conf *GlobalConfig) API_replay_ts(w http.ResponseWriter, r *http.Request)
 	if dumpFile == "" {
 		dumpFile = streamPath + ".ts"
 	}
+	var pub TSPublisher
+	if err := pub.Replay.ParseQuery(q); err != nil {
+		util.ReturnError(util.APIErrorQueryParse, err.Error(), w, r)
+		return
+	}
 	f, err := os.Open(dumpFile)
 	if err != nil {
 		util.ReturnError(util.APIErrorOpen, err.Error(), w, r)
 		return
 	}
-	var pub TSPublisher
 	if err := Engine.Publish(streamPath, &pub); err != nil {
 		util.ReturnError(util.APIErrorPublish, err.Error(), w, r)
 	} else {
-		tsReader := NewTSReader(&pub)
 		pub.SetIO(f)
-		go func() {
-			tsReader.Feed(f)
-			tsReader.Close()
-		}()
 		util.ReturnOK(w, r)
+		go pub.ReplayTS(f)
 	}
 }
 
@@ -337,6 +499,10 @@ func (conf *GlobalConfig) API_replay_mp4(w http.ResponseWriter, r *http.Request)
 		dumpFile = streamPath + ".mp4"
 	}
 	var pub MP4Publisher
+	if err := pub.Replay.ParseQuery(q); err != nil {
+		util.ReturnError(util.APIErrorQueryParse, err.Error(), w, r)
+		return
+	}
 	f, err := os.Open(dumpFile)
 	if err != nil {
 		util.ReturnError(util.APIErrorOpen, err.Error(), w, r)
@@ -350,3 +516,86 @@ func (conf *GlobalConfig) API_replay_mp4(w http.ResponseWriter, r *http.Request)
 		go pub.ReadMP4Data(f)
 	}
 }
+
+func (conf *GlobalConfig) API_replay_flv(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	streamPath := q.Get("streamPath")
+	if streamPath == "" {
+		streamPath = "dump/flv"
+	}
+	dumpFile := q.Get("dump")
+	if dumpFile == "" {
+		dumpFile = streamPath + ".flv"
+	}
+	var pub FLVPublisher
+	if err := pub.Replay.ParseQuery(q); err != nil {
+		util.ReturnError(util.APIErrorQueryParse, err.Error(), w, r)
+		return
+	}
+	f, err := os.Open(dumpFile)
+	if err != nil {
+		util.ReturnError(util.APIErrorOpen, err.Error(), w, r)
+		return
+	}
+	if err := Engine.Publish(streamPath, &pub); err != nil {
+		util.ReturnError(util.APIErrorPublish, err.Error(), w, r)
+	} else {
+		pub.SetIO(f)
+		util.ReturnOK(w, r)
+		go pub.ReadFLVData(f)
+	}
+}
+
+func (conf *GlobalConfig) API_replay_list(w http.ResponseWriter, r *http.Request) {
+	util.ReturnFetchList(func() (list []ReplayState) {
+		Replays.Range(func(_ string, replayer *Replayer) {
+			list = append(list, replayer.State())
+		})
+		return
+	}, w, r)
+}
+
+func findReplayer(w http.ResponseWriter, r *http.Request) *Replayer {
+	replayer := Replays.Get(r.URL.Query().Get("streamPath"))
+	if replayer == nil {
+		util.ReturnError(util.APIErrorNoStream, "no such replay", w, r)
+	}
+	return replayer
+}
+
+// API_replay_pause 暂停文件回放
+func (conf *GlobalConfig) API_replay_pause(w http.ResponseWriter, r *http.Request) {
+	if replayer := findReplayer(w, r); replayer != nil {
+		replayer.Pause()
+		util.ReturnOK(w, r)
+	}
+}
+
+// API_replay_resume 恢复文件回放
+func (conf *GlobalConfig) API_replay_resume(w http.ResponseWriter, r *http.Request) {
+	if replayer := findReplayer(w, r); replayer != nil {
+		replayer.Resume()
+		util.ReturnOK(w, r)
+	}
+}
+
+// API_replay_seek 跳转到 position 指定的位置，支持 1m30s 或者秒数
+func (conf *GlobalConfig) API_replay_seek(w http.ResponseWriter, r *http.Request) {
+	position, err := parseReplayDuration(r.URL.Query().Get("position"))
+	if err != nil || position < 0 {
+		util.ReturnError(util.APIErrorQueryParse, "invalid position", w, r)
+		return
+	}
+	if replayer := findReplayer(w, r); replayer != nil {
+		replayer.Seek(position)
+		util.ReturnOK(w, r)
+	}
+}
+
+// API_replay_stop 结束文件回放
+func (conf *GlobalConfig) API_replay_stop(w http.ResponseWriter, r *http.Request) {
+	if replayer := findReplayer(w, r); replayer != nil {
+		replayer.Stop()
+		util.ReturnOK(w, r)
+	}
+}
@@ -132,6 +132,16 @@ var (
 	ErrStreamIsClosed   = errors.New("Stream Is Closed")
 	ErrPublisherLost    = errors.New("Publisher Lost")
 	ErrAuth             = errors.New("Auth Failed")
+	ErrAuthUnavailable  = errors.New("Auth Service Unavailable")
+	ErrLimitExceeded    = errors.New("Limit Exceeded")
+	ErrBandwidthLimit   = errors.New("Bandwidth Limit Exceeded")
+	ErrNoOriginPuller   = errors.New("No Puller For Scheme")
+	ErrTrackNotExist    = errors.New("Track Not Exist")
+	ErrTrackNotSupport  = errors.New("Track Not Support")
+	ErrGossipSecret     = errors.New("Gossip Secret Required")
+	ErrGossipPeer       = errors.New("Gossip Unknown Peer")
+	ErrGossipSign       = errors.New("Gossip Bad Signature")
+	ErrConnectTimeout   = errors.New("Connect Timeout")
 	OnAuthSub           func(p *util.Promise[ISubscriber]) error
 	OnAuthPub           func(p *util.Promise[IPublisher]) error
 )
@@ -190,7 +200,15 @@ func (io *IO) receive(streamPath string, specific common.IIO) error {
 	} else {
 		iPub = specific.(IPublisher)
 	}
-	s, create := findOrCreateStream(u.Path, wt)
+	streamPath = u.Path
+	if isSubscribe {
+		// 订阅别名时订阅实际的流
+		if target := EngineConfig.Alias.Resolve(streamPath); target != streamPath {
+			log.Debug("alias ", streamPath, " -> ", target)
+			streamPath = target
+		}
+	}
+	s, create := findOrCreateStream(streamPath, wt)
 	if s == nil {
 		return ErrBadStreamName
 	}
@@ -234,12 +252,20 @@ func (io *IO) receive(streamPath string, specific common.IIO) error {
 		}
 		io.Info("publish", zap.String("ptr", fmt.Sprintf("%p", iPub)))
 		s.pubLocker.Lock()
-		defer s.pubLocker.Unlock()
+		locked := true
+		defer func() {
+			if locked {
+				s.pubLocker.Unlock()
+			}
+		}()
 		if _, isPuller := specific.(IPuller); config.Global.EnableAuth && !isPuller {
 			onAuthPub := OnAuthPub
 			if auth, ok := specific.(AuthPub); ok {
 				onAuthPub = auth.OnAuth
 			}
+			if onAuthPub == nil && config.Global.RemoteAuth.PublishURL != "" {
+				onAuthPub = remoteAuthPub
+			}
 			if onAuthPub != nil {
 				authPromise := util.NewPromise(iPub)
 				if err = onAuthPub(authPromise); err == nil {
@@ -248,13 +274,37 @@ func (io *IO) receive(streamPath string, specific common.IIO) error {
 				if err != nil {
 					return err
 				}
+			} else if token := io.Args.Get(conf.TokenArgName); token != "" && jwtEnabled(conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile) {
+				if err = io.authPubJWT(conf, token); err != nil {
+					return err
+				}
 			} else if conf.Key != "" {
 				if !io.auth(conf.Key, io.Args.Get(conf.SecretArgName), io.Args.Get(conf.ExpireArgName)) {
 					return ErrAuth
 				}
+			} else if jwtEnabled(conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile) {
+				return ErrAuth
+			}
+		}
+		if _, isPuller := specific.(IPuller); !isPuller {
+			// 其他节点已经在发布该流
+			if loc := remoteStream(s.Path); loc != nil {
+				if conf.GetDuplicatePolicy() != "kick" {
+					io.Warn("stream published on other node", zap.String("node", loc.Node))
+					return ErrDuplicatePublish
+				}
+				io.Warn("kick publisher on other node", zap.String("node", loc.Node))
+				if err = Registry.Kick(s.Path, loc); err != nil {
+					return err
+				}
 			}
 		}
 		if promise := util.NewPromise(iPub); s.Receive(promise) {
+			if conf.GetDuplicatePolicy() == "standby" {
+				// 热备的发布者会一直等待到切换，等待时不占用锁
+				s.pubLocker.Unlock()
+				locked = false
+			}
 			err = promise.Await()
 			return err
 		}
@@ -269,6 +319,9 @@ func (io *IO) receive(streamPath string, specific common.IIO) error {
 			if auth, ok := specific.(AuthSub); ok {
 				onAuthSub = auth.OnAuth
 			}
+			if onAuthSub == nil && config.Global.RemoteAuth.SubscribeURL != "" {
+				onAuthSub = remoteAuthSub
+			}
 			if onAuthSub != nil {
 				authPromise := util.NewPromise(iSub)
 				if err = onAuthSub(authPromise); err == nil {
@@ -277,10 +330,16 @@ func (io *IO) receive(streamPath string, specific common.IIO) error {
 				if err != nil {
 					return err
 				}
+			} else if token := io.Args.Get(conf.TokenArgName); token != "" && jwtEnabled(conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile) {
+				if err = iSub.GetSubscriber().authSubJWT(token); err != nil {
+					return err
+				}
 			} else if conf.Key != "" {
 				if !io.auth(conf.Key, io.Args.Get(conf.SecretArgName), io.Args.Get(conf.ExpireArgName)) {
 					return ErrAuth
 				}
+			} else if jwtEnabled(conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile) {
+				return ErrAuth
 			}
 		}
 		if promise := util.NewPromise(iSub); s.Receive(promise) {
@@ -299,6 +358,11 @@ type ClientIO[C ClientConfig] struct {
 	ReConnectCount int    //重连次数
 }
 
+// GetReConnectCount 获取重连次数
+func (c *ClientIO[C]) GetReConnectCount() int {
+	return c.ReConnectCount
+}
+
 func (c *ClientIO[C]) init(streamPath string, url string, conf *C) {
 	c.Config = conf
 	c.StreamPath = streamPath
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/util"
+)
+
+// StreamClaims JWT 中与流相关的声明
+type StreamClaims struct {
+	ID          string   `json:"jti"`
+	Path        string   `json:"path"`        // 允许的流路径，支持 path.Match 通配符，为空则不限制
+	Action      string   `json:"action"`      // publish 或 subscribe，为空则不限制
+	MaxSessions int      `json:"maxSessions"` // 使用同一个 token 同时订阅的最大数量，0 为不限制
+	VideoTracks []string `json:"videoTracks"` // 允许订阅的视频轨道名称，为空则不限制
+	AudioTracks []string `json:"audioTracks"` // 允许订阅的音频轨道名称，为空则不限制
+}
+
+type jwtKeysEntry struct {
+	keys     *util.JWTKeys
+	modTimes [2]time.Time
+}
+
+var (
+	jwtKeys      util.Map[[3]string, *jwtKeysEntry]
+	jwtSessions  = make(map[string]int)
+	jwtSessionMu sync.Mutex
+)
+
+func jwtEnabled(secret, publicKey, jwks string) bool {
+	return secret != "" || publicKey != "" || jwks != ""
+}
+
+// loadJWTKeys 读取密钥并缓存，公钥文件修改后重新读取
+func loadJWTKeys(secret, publicKey, jwks string) (keys *util.JWTKeys, err error) {
+	var modTimes [2]time.Time
+	for i, file := range [...]string{publicKey, jwks} {
+		if file != "" {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			modTimes[i] = info.ModTime()
+		}
+	}
+	id := [3]string{secret, publicKey, jwks}
+	if entry := jwtKeys.Get(id); entry != nil && entry.modTimes == modTimes {
+		return entry.keys, nil
+	}
+	keys = &util.JWTKeys{Secret: []byte(secret)}
+	if publicKey != "" {
+		if err = keys.LoadPEM(publicKey); err != nil {
+			return
+		}
+	}
+	if jwks != "" {
+		if err = keys.LoadJWKS(jwks); err != nil {
+			return
+		}
+	}
+	jwtKeys.Set(id, &jwtKeysEntry{keys, modTimes})
+	return
+}
+
+// verifyJWT 校验 token 的签名、有效期以及允许的流路径和操作
+func (io *IO) verifyJWT(action, token, secret, publicKey, jwks string) (claims *StreamClaims, err error) {
+	keys, err := loadJWTKeys(secret, publicKey, jwks)
+	if err != nil {
+		io.Error("load jwt keys", zap.Error(err))
+		return nil, ErrAuth
+	}
+	claims = &StreamClaims{}
+	if err = keys.Verify(token, claims); err != nil {
+		io.Warn("jwt auth failed", zap.Error(err))
+		return nil, ErrAuth
+	}
+	if claims.Action != "" && claims.Action != action {
+		io.Warn("jwt auth failed", zap.String("action", action), zap.String("allow", claims.Action))
+		return nil, ErrAuth
+	}
+	if claims.Path != "" {
+		if ok, _ := path.Match(claims.Path, io.Stream.Path); !ok {
+			io.Warn("jwt auth failed", zap.String("allow", claims.Path))
+			return nil, ErrAuth
+		}
+	}
+	return
+}
+
+func (io *IO) authPubJWT(conf *config.Publish, token string) error {
+	_, err := io.verifyJWT("publish", token, conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile)
+	return err
+}
+
+// authSubJWT 订阅时还需要检查轨道，同时订阅的数量在加入流时由 acquireJWTSession 计数
+func (s *Subscriber) authSubJWT(token string) error {
+	conf := s.Config
+	claims, err := s.verifyJWT("subscribe", token, conf.JWTSecret, conf.JWTPublicKey, conf.JWKSFile)
+	if err != nil {
+		return err
+	}
+	for argName, tracks := range map[string][]string{conf.SubVideoArgName: claims.VideoTracks, conf.SubAudioArgName: claims.AudioTracks} {
+		if len(tracks) == 0 {
+			continue
+		}
+		allow := strings.Join(tracks, ",")
+		selected := s.Args.Get(argName)
+		if selected == "" {
+			// 没有指定轨道时只订阅允许的轨道
+			s.Args.Set(argName, allow)
+			continue
+		}
+		for _, name := range strings.Split(selected, ",") {
+			if !strings.Contains(","+allow+",", ","+name+",") {
+				s.Warn("jwt auth failed", zap.String("track", name), zap.Strings("allow", tracks))
+				return ErrAuth
+			}
+		}
+	}
+	if claims.MaxSessions > 0 {
+		s.jwtSession = claims.ID
+		if s.jwtSession == "" {
+			s.jwtSession = token
+		}
+		s.jwtMaxSessions = claims.MaxSessions
+		// 提前拒绝，避免已满的 token 还去等待流
+		jwtSessionMu.Lock()
+		defer jwtSessionMu.Unlock()
+		if jwtSessions[s.jwtSession] >= s.jwtMaxSessions {
+			s.Warn("jwt auth failed", zap.Int("maxSessions", claims.MaxSessions))
+			return ErrAuth
+		}
+	}
+	return nil
+}
+
+// acquireJWTSession 订阅者加入流时占用一个会话，超过 token 允许的数量则返回 false
+func (s *Subscriber) acquireJWTSession() bool {
+	if s.jwtMaxSessions <= 0 {
+		return true
+	}
+	jwtSessionMu.Lock()
+	defer jwtSessionMu.Unlock()
+	if jwtSessions[s.jwtSession] >= s.jwtMaxSessions {
+		return false
+	}
+	jwtSessions[s.jwtSession]++
+	return true
+}
+
+// releaseJWTSession 订阅者离开流时释放会话
+func (s *Subscriber) releaseJWTSession() {
+	if s.jwtMaxSessions <= 0 {
+		return
+	}
+	jwtSessionMu.Lock()
+	defer jwtSessionMu.Unlock()
+	if jwtSessions[s.jwtSession]--; jwtSessions[s.jwtSession] <= 0 {
+		delete(jwtSessions, s.jwtSession)
+	}
+}
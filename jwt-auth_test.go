@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"m7s.live/engine/v4/config"
+)
+
+func signTestJWT(secret, payload string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthSubJWTTracks(t *testing.T) {
+	setupTestEngine()
+	token := signTestJWT("secret", `{"videoTracks":["h264"],"audioTracks":["aac","opus"]}`)
+	for _, tt := range []struct {
+		args     string
+		err      error
+		vts, ats string
+	}{
+		{"", nil, "h264", "aac,opus"},
+		{"vts=h264&ats=opus", nil, "h264", "opus"},
+		// 音频轨道名不能用于视频
+		{"vts=aac", ErrAuth, "", ""},
+		{"ats=h264", ErrAuth, "", ""},
+	} {
+		var s Subscriber
+		s.Logger = Engine.Logger
+		s.Config = &config.Subscribe{SubVideoArgName: "vts", SubAudioArgName: "ats", JWTSecret: "secret"}
+		s.Args, _ = url.ParseQuery(tt.args)
+		if err := s.authSubJWT(token); err != tt.err {
+			t.Errorf("%q: got %v, want %v", tt.args, err, tt.err)
+		} else if err == nil && (s.Args.Get("vts") != tt.vts || s.Args.Get("ats") != tt.ats) {
+			t.Errorf("%q: vts %q ats %q", tt.args, s.Args.Get("vts"), s.Args.Get("ats"))
+		}
+	}
+	// 只限制视频时不影响音频
+	token = signTestJWT("secret", `{"videoTracks":["h264"]}`)
+	var s Subscriber
+	s.Logger = Engine.Logger
+	s.Config = &config.Subscribe{SubVideoArgName: "vts", SubAudioArgName: "ats", JWTSecret: "secret"}
+	s.Args = url.Values{"ats": {"aac"}}
+	if err := s.authSubJWT(token); err != nil || s.Args.Get("vts") != "h264" || s.Args.Get("ats") != "aac" {
+		t.Fatalf("video only: %v %v", err, s.Args)
+	}
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"net"
+	"sync"
+
+	"m7s.live/engine/v4/config"
+)
+
+// IOCount 发布者或订阅者的数量统计
+type IOCount struct {
+	Total    int
+	Rejected int            // 超过限制被拒绝的次数
+	Apps     map[string]int `json:",omitempty"`
+	Streams  map[string]int `json:",omitempty"`
+	IPs      map[string]int `json:",omitempty"`
+}
+
+type ioCounter struct {
+	mu sync.Mutex
+	IOCount
+}
+
+var (
+	subscriberCounter ioCounter
+	publisherCounter  ioCounter
+)
+
+// limitKeys 计数使用的应用名、流路径和客户端 IP
+func limitKeys(io *IO) (app, stream, ip string) {
+	if io.Stream != nil {
+		app, stream = io.Stream.AppName, io.Stream.Path
+	}
+	if ip, _, _ = net.SplitHostPort(io.RemoteAddr); ip == "" {
+		ip = io.RemoteAddr
+	}
+	return
+}
+
+func limitExceeded(limit int, count int) bool {
+	return limit > 0 && count >= limit
+}
+
+func increase(m *map[string]int, key string, delta int) {
+	if *m == nil {
+		*m = make(map[string]int)
+	}
+	if (*m)[key] += delta; (*m)[key] <= 0 {
+		delete(*m, key)
+	}
+}
+
+// acquire 检查是否超过限制，没有超过则计数加一
+func (c *ioCounter) acquire(limit *config.IOLimit, io *IO) bool {
+	app, stream, ip := limitKeys(io)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	appLimit := limit.PerApp
+	if l, ok := limit.Apps[app]; ok {
+		appLimit = l
+	}
+	if limitExceeded(limit.Total, c.Total) || limitExceeded(appLimit, c.Apps[app]) || limitExceeded(limit.PerStream, c.Streams[stream]) || (ip != "" && limitExceeded(limit.PerIP, c.IPs[ip])) {
+		c.Rejected++
+		return false
+	}
+	c.Total++
+	increase(&c.Apps, app, 1)
+	increase(&c.Streams, stream, 1)
+	if ip != "" {
+		increase(&c.IPs, ip, 1)
+	}
+	return true
+}
+
+func (c *ioCounter) release(io *IO) {
+	app, stream, ip := limitKeys(io)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Total--
+	increase(&c.Apps, app, -1)
+	increase(&c.Streams, stream, -1)
+	if ip != "" {
+		increase(&c.IPs, ip, -1)
+	}
+}
+
+func copyCount(m map[string]int) (r map[string]int) {
+	if len(m) > 0 {
+		r = make(map[string]int, len(m))
+		for k, v := range m {
+			r[k] = v
+		}
+	}
+	return
+}
+
+// snapshot 复制一份当前的统计
+func (c *ioCounter) snapshot() IOCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return IOCount{
+		Total:    c.Total,
+		Rejected: c.Rejected,
+		Apps:     copyCount(c.Apps),
+		Streams:  copyCount(c.Streams),
+		IPs:      copyCount(c.IPs),
+	}
+}
@@ -106,6 +106,7 @@ func Run(ctx context.Context, conf any) (err error) {
 	util.PoolSize = EngineConfig.PoolSize
 	EventBus = make(chan any, EngineConfig.EventBusSize)
 	go EngineConfig.Listen(Engine)
+	startRegistry(ctx)
 	for _, plugin := range plugins {
 		plugin.Logger = log.LocaleLogger.Named(plugin.Name)
 		if os.Getenv(strings.ToUpper(plugin.Name)+"_ENABLE") == "false" {
@@ -196,6 +197,9 @@ func Run(ctx context.Context, conf any) (err error) {
 	for _, plugin := range enabledPlugins {
 		plugin.Config.OnEvent(EngineConfig) //引擎初始化完成后，通知插件
 	}
+	startFailover(ctx)
+	startCompose()
+	go sweepRemoteAuth(ctx)
 	for {
 		select {
 		case event := <-EventBus:
@@ -17,9 +17,10 @@ type MemoryTs struct {
 	util.BLL
 }
 
-func (ts *MemoryTs) WritePMTPacket(audio codec.AudioCodecID, video codec.VideoCodecID) {
+// WritePMTPacket audioSampleRate 为 MP2/MP3 的实际采样率（MPA.Header.SampleRate），用于区分 MPEG-1 和 MPEG-2 LSF 音频
+func (ts *MemoryTs) WritePMTPacket(audio codec.AudioCodecID, video codec.VideoCodecID, audioSampleRate ...uint32) {
 	ts.PMT.Reset()
-	mpegts.WritePMTPacket(&ts.PMT, video, audio)
+	mpegts.WritePMTPacket(&ts.PMT, video, audio, audioSampleRate...)
 }
 
 func (ts *MemoryTs) WriteTo(w io.Writer) (int64, error) {
@@ -155,7 +156,12 @@ func (ts *MemoryTs) WriteAudioFrame(frame AudioFrame, pes *mpegts.MpegtsPESFrame
 	}
 	packet.Header.PacketStartCodePrefix = 0x000001
 	packet.Header.ConstTen = 0x80
-	packet.Header.StreamID = mpegts.STREAM_ID_AUDIO
+	switch frame.CodecID {
+	case codec.CodecID_AC3, codec.CodecID_EAC3:
+		packet.Header.StreamID = mpegts.STREAM_ID_PRIVATE_1
+	default:
+		packet.Header.StreamID = mpegts.STREAM_ID_AUDIO
+	}
 	packet.Header.Pts = uint64(frame.PTS)
 	pes.ProgramClockReferenceBase = packet.Header.Pts
 	packet.Header.PtsDtsFlags = 0x80
@@ -166,9 +172,12 @@ func (ts *MemoryTs) WriteAudioFrame(frame AudioFrame, pes *mpegts.MpegtsPESFrame
 func (ts *MemoryTs) WriteVideoFrame(frame VideoFrame, pes *mpegts.MpegtsPESFrame) (err error) {
 	var buffer net.Buffers
 	//需要对原始数据(ES),进行一些预处理,视频需要分割nalu(H264编码),并且打上sps,pps,nalu_aud信息.
-	if len(frame.ParamaterSets) == 2 {
+	switch frame.CodecID {
+	case codec.CodecID_H264:
 		buffer = append(buffer, codec.NALU_AUD_BYTE)
-	} else {
+	case codec.CodecID_H266:
+		buffer = append(buffer, codec.H266AudNalu)
+	default:
 		buffer = append(buffer, codec.AudNalu)
 	}
 	buffer = append(buffer, frame.GetAnnexB()...)
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/track"
+)
+
+// metricFamily 同名的指标必须连续输出，先按名称归类
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []string
+}
+
+// metricsWriter 生成 Prometheus 文本格式的指标
+type metricsWriter struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m *metricsWriter) add(typ, name, help string, value float64, labels ...string) {
+	if m.index == nil {
+		m.index = make(map[string]*metricFamily)
+	}
+	family, ok := m.index[name]
+	if !ok {
+		family = &metricFamily{name: name, help: help, typ: typ}
+		m.index[name] = family
+		m.families = append(m.families, family)
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 1 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(metricLabelEscaper.Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	family.samples = append(family.samples, b.String())
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	m.add("gauge", name, help, value, labels...)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64, labels ...string) {
+	m.add("counter", name, help, value, labels...)
+}
+
+func (m *metricsWriter) WriteTo(w io.Writer) (n int64, err error) {
+	for _, family := range m.families {
+		var c int
+		if c, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s\n", family.name, family.help, family.name, family.typ, strings.Join(family.samples, "\n")); err != nil {
+			return
+		}
+		n += int64(c)
+	}
+	return
+}
+
+// reConnectCounter Puller 和 Pusher 通过 ClientIO 实现
+type reConnectCounter interface {
+	GetReConnectCount() int
+}
+
+// collectMetrics 采集引擎当前的运行指标
+func collectMetrics() *metricsWriter {
+	var m metricsWriter
+	m.gauge("m7s_eventbus_length", "Number of events waiting in the event bus.", float64(len(EventBus)))
+	m.gauge("m7s_eventbus_capacity", "Capacity of the event bus.", float64(cap(EventBus)))
+	streams := Streams.ToList()
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Path < streams[j].Path })
+	m.gauge("m7s_streams", "Number of streams.", float64(len(streams)))
+	for _, s := range streams {
+		m.collectStream(s)
+	}
+	Pullers.Range(func(key, value any) bool {
+		if c, ok := value.(reConnectCounter); ok {
+			m.gauge("m7s_puller_reconnects", "Reconnect attempts of the puller since the last successful connection.", float64(c.GetReConnectCount()), "stream", key.(string))
+		}
+		return true
+	})
+	Pushers.Range(func(key, value any) bool {
+		if c, ok := value.(reConnectCounter); ok {
+			m.gauge("m7s_pusher_reconnects", "Reconnect attempts of the pusher.", float64(c.GetReConnectCount()), "url", key.(string))
+		}
+		return true
+	})
+	return &m
+}
+
+func (m *metricsWriter) collectStream(s *Stream) {
+	path := s.Path
+	m.gauge("m7s_stream_state", "Stream state: 0 wait publish, 1 wait track, 2 publishing, 3 wait close, 4 closed.", float64(s.State), "stream", path, "type", s.GetType())
+	m.gauge("m7s_stream_subscribers", "Number of public subscribers of the stream.", float64(s.Subscribers.Len()), "stream", path)
+	m.gauge("m7s_stream_uptime_seconds", "Seconds since the stream was created.", time.Since(s.StartTime).Seconds(), "stream", path)
+	var actions [len(ActionNames)]int
+	for _, event := range s.SEHistory {
+		if int(event.Action) < len(actions) {
+			actions[event.Action]++
+		}
+	}
+	for action, count := range actions {
+		m.counter("m7s_stream_actions_total", "State machine actions applied to the stream.", float64(count), "stream", path, "action", ActionNames[action])
+	}
+	s.Tracks.Range(func(name string, t common.Track) {
+		m.gauge("m7s_track_bps", "Track bitrate in bytes per second.", float64(t.GetBPS()), "stream", path, "track", name)
+		m.gauge("m7s_track_fps", "Track frames per second.", float64(t.GetFPS()), "stream", path, "track", name)
+		m.counter("m7s_track_drops_total", "Frames dropped by the track.", float64(t.GetDrops()), "stream", path, "track", name)
+		m.gauge("m7s_track_ring_size", "Size of the track ring buffer.", float64(t.GetRBSize()), "stream", path, "track", name)
+		m.gauge("m7s_track_readers", "Number of readers of the track.", float64(t.GetReaderCount()), "stream", path, "track", name)
+		var media *track.Media
+		switch v := t.(type) {
+		case *track.Video:
+			media = &v.Media
+		case *track.Audio:
+			media = &v.Media
+		}
+		if media != nil {
+			var items, size int
+			for i, list := range media.BytesPool {
+				items += list.Length
+				if i > 0 {
+					size += list.Length << i
+				}
+			}
+			m.gauge("m7s_track_pool_items", "Idle items held by the track BytesPool.", float64(items), "stream", path, "track", name)
+			m.gauge("m7s_track_pool_bytes", "Idle memory held by the track BytesPool.", float64(size), "stream", path, "track", name)
+		}
+	})
+	s.Subscribers.RangeAll(func(sub ISubscriber) {
+		suber := sub.GetSubscriber()
+		id := suber.ID
+		if id == "" {
+			id = fmt.Sprintf("%p", suber)
+		}
+		for _, reader := range [...]*track.AVRingReader{suber.VideoReader, suber.AudioReader} {
+			if reader != nil && reader.Track != nil {
+				m.gauge("m7s_subscriber_lag_frames", "Frames between the subscriber read position and the newest frame.", float64(reader.Delay), "stream", path, "subscriber", id, "type", suber.Type, "track", reader.Track.Name)
+			}
+		}
+	})
+}
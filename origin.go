@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/util"
+)
+
+type originPuller struct {
+	plugin  *Plugin
+	factory func() IPuller
+}
+
+var (
+	originPullers util.Map[string, *originPuller]
+	originRound   atomic.Uint32
+)
+
+// RegisterOriginPuller 注册回源使用的拉流者，scheme 为源站地址的协议，例如 rtmp
+// 插件在 FirstConfig 事件中注册后，回源会等待拉流结束再决定是否尝试下一个源站；
+// 没有注册的协议会发送 InviteOrigin 事件，由同名插件异步拉流
+func (opt *Plugin) RegisterOriginPuller(scheme string, factory func() IPuller) {
+	originPullers.Set(scheme, &originPuller{opt, factory})
+}
+
+// originNodes 按照策略排列源站，排在前面的失败后依次尝试后面的
+func originNodes(conf *config.Origin, streamPath string) []string {
+	n := len(conf.Nodes)
+	if n == 0 {
+		return nil
+	}
+	var start int
+	switch conf.Policy {
+	case "roundrobin":
+		start = int((originRound.Add(1) - 1) % uint32(n))
+	case "failover":
+	default:
+		h := fnv.New32a()
+		h.Write([]byte(streamPath))
+		start = int(h.Sum32() % uint32(n))
+	}
+	return append(conf.Nodes[start:n:n], conf.Nodes[:start]...)
+}
+
+// newOriginPuller 根据拉流地址的协议创建已注册的拉流者
+func newOriginPuller(streamPath, remote string) (IPuller, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, err
+	}
+	op := originPullers.Get(u.Scheme)
+	if op == nil {
+		return nil, ErrNoOriginPuller
+	}
+	pullConf, ok := op.plugin.Config.(config.PullConfig)
+	if !ok {
+		return nil, ErrNoPullConfig
+	}
+	puller := op.factory()
+	puller.init(streamPath, remote, pullConf.GetPullConfig())
+	op.plugin.AssignPubConfig(puller.GetPublisher())
+	puller.SetLogger(op.plugin.Logger.With(zap.String("stream", streamPath), zap.String("url", remote)))
+	return puller, nil
+}
+
+// pluginForScheme 找到和协议同名的插件，例如 rtmp 对应 RTMP 插件，rtmps 也对应 RTMP 插件
+func pluginForScheme(scheme string) *Plugin {
+	for _, name := range []string{scheme, strings.TrimSuffix(scheme, "s")} {
+		for _, plugin := range plugins {
+			if strings.EqualFold(plugin.Name, name) {
+				return plugin
+			}
+		}
+	}
+	return nil
+}
+
+// pullByInvite 通过事件总线邀请同名插件从源站拉流，插件处理 InviteOrigin 事件即可，不需要修改它的 PullOnSub 配置
+func pullByInvite(streamPath, remote string) error {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return err
+	}
+	if plugin := pluginForScheme(u.Scheme); plugin == nil || plugin.Disabled {
+		return ErrNoOriginPuller
+	}
+	EventBus <- InviteOrigin{Event: CreateEvent(streamPath), Remote: remote}
+	return nil
+}
+
+// originDone 流已经关闭或者有了发布者就不再尝试下一个源站
+func originDone(streamPath string) bool {
+	s := Streams.Get(streamPath)
+	return s == nil || s.State == STATE_CLOSED || s.Publisher != nil && !s.Publisher.GetPublisher().IsClosed()
+}
+
+// waitOriginPublish 插件的拉流是异步的，等待发布者出现或者超时
+func waitOriginPublish(streamPath string, timeout time.Duration) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if originDone(streamPath) {
+			return true
+		}
+		<-ticker.C
+	}
+	return originDone(streamPath)
+}
+
+// pullFromOrigin 订阅者通过鉴权和准入后从源站拉流，无订阅者时流在 DelayCloseTimeout 后关闭，拉流随之结束
+func pullFromOrigin(streamPath string) {
+	conf := &EngineConfig.Origin
+	zpath := zap.String("stream", streamPath)
+	for _, node := range originNodes(conf, streamPath) {
+		remote := strings.TrimSuffix(node, "/") + "/" + streamPath
+		znode := zap.String("node", node)
+		puller, err := newOriginPuller(streamPath, remote)
+		if err == ErrNoOriginPuller {
+			if err = pullByInvite(streamPath, remote); err == nil {
+				Engine.Info("pull from origin by plugin", zpath, znode)
+				if waitOriginPublish(streamPath, conf.PullTimeout) {
+					return
+				}
+				Engine.Warn("origin publish timeout", zpath, znode)
+				continue
+			}
+		}
+		if err != nil {
+			Engine.Warn("origin node", zpath, znode, zap.Error(err))
+			continue
+		}
+		if conf.DelayCloseTimeout > 0 {
+			puller.GetPublisher().Config.DelayCloseTimeout = conf.DelayCloseTimeout
+		}
+		puller.Info("pull from origin")
+		puller.startPull(puller)
+		if originDone(streamPath) {
+			return
+		}
+	}
+	Engine.Warn("all origins failed", zpath)
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+type FLVPublisher struct {
+	Publisher
+	Metadata map[string]any // onMetaData 中的信息
+	Replay   Replayer
+	pool     util.BytesPool
+}
+
+// ReadFLVData 读取 FLV 文件，按照 tag 时间戳的节奏发布，循环播放时 source 需要实现 io.Seeker
+func (p *FLVPublisher) ReadFLVData(source io.Reader) (err error) {
+	defer p.Stop()
+	p.Replay.bind(&p.Publisher)
+	defer p.Replay.unbind()
+	p.pool = make(util.BytesPool, 17)
+	for {
+		if err = p.readHeader(source); err != nil {
+			p.Error("Error reading FLV header", zap.Error(err))
+			return
+		}
+		var action ReplayAction
+		if action, err = p.readTags(source); err != nil {
+			p.Error("Error reading FLV tag", zap.Error(err))
+			return
+		}
+		if action == ReplayStop {
+			p.Info("Reached end of FLV file")
+			return nil
+		}
+		seeker, ok := source.(io.Seeker)
+		if !ok {
+			p.Error("Error rewinding FLV file", zap.Error(ErrReplayNotSeekable))
+			return ErrReplayNotSeekable
+		}
+		if _, err = seeker.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+}
+
+func (p *FLVPublisher) readHeader(source io.Reader) (err error) {
+	head := make([]byte, len(codec.FLVHeader))
+	if _, err = io.ReadFull(source, head); err != nil {
+		return
+	}
+	if head[0] != 'F' || head[1] != 'L' || head[2] != 'V' {
+		return codec.ErrInvalidFLV
+	}
+	// DataOffset 通常为9，大于9时跳过多余的部分
+	if offset := util.ReadBE[int](head[5:9]); offset > 9 {
+		_, err = io.CopyN(io.Discard, source, int64(offset-9))
+	}
+	return
+}
+
+// readTags 读取并发布一遍 tag，直到文件结尾或者回放控制要求重新开始
+func (p *FLVPublisher) readTags(source io.Reader) (ReplayAction, error) {
+	var frame util.BLL
+	for {
+		t, ts, payload, err := codec.ReadFLVTag(source)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return p.Replay.OnEOF(), nil
+		} else if err != nil {
+			return ReplayStop, err
+		}
+		if t == codec.FLV_TAG_TYPE_SCRIPT {
+			if p.Metadata == nil {
+				p.readMetadata(payload)
+			}
+			continue
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		isVideo := t == codec.FLV_TAG_TYPE_VIDEO
+		if flvSequenceHead(isVideo, payload) {
+			// 循环或者跳转时序列头不变，只需要写入一次
+			if (isVideo && p.VideoTrack != nil) || (!isVideo && p.AudioTrack != nil) {
+				continue
+			}
+		} else {
+			key := !isVideo || (payload[0]>>4)&0x07 == 1
+			switch action := p.Replay.Check(time.Duration(ts)*time.Millisecond, isVideo, key); action {
+			case ReplaySkip:
+				continue
+			case ReplayRewind, ReplayStop:
+				return action, nil
+			}
+		}
+		frame.Push(p.pool.GetShell(payload))
+		if isVideo {
+			p.WriteAVCCVideo(ts, &frame, p.pool)
+		} else if p.AudioTrack == nil {
+			p.WriteAVCCAudio(ts, &frame, p.pool)
+			p.applyAudioMetadata()
+		} else {
+			p.WriteAVCCAudio(ts, &frame, p.pool)
+		}
+		frame.Recycle()
+	}
+}
+
+// flvSequenceHead 判断 tag 是否为 AVC/HEVC/AV1 或者 AAC 的序列头
+func flvSequenceHead(isVideo bool, payload []byte) bool {
+	if isVideo {
+		if payload[0]&0b1000_0000 != 0 {
+			return payload[0]&0x0F == codec.PacketTypeSequenceStart
+		}
+		return len(payload) > 1 && payload[1] == 0
+	}
+	return payload[0]>>4 == 10 && len(payload) > 1 && payload[1] == 0
+}
+
+func (p *FLVPublisher) readMetadata(payload []byte) {
+	amf := util.AMF{Buffer: payload}
+	for amf.CanRead() {
+		obj, err := amf.Unmarshal()
+		if err != nil {
+			return
+		}
+		// 可能是 onMetaData 或者 @setDataFrame,onMetaData
+		if metadata, ok := obj.(map[string]any); ok {
+			p.Metadata = metadata
+			p.Info("FLV metadata", zap.Any("metadata", metadata))
+			return
+		}
+	}
+}
+
+// applyAudioMetadata FLV 音频头无法表示 8kHz 等采样率，G711 以 metadata 中的为准
+func (p *FLVPublisher) applyAudioMetadata() {
+	g711, ok := p.AudioTrack.(*track.G711)
+	if !ok || p.Metadata == nil {
+		return
+	}
+	if rate, ok := p.Metadata["audiosamplerate"].(float64); ok && rate > 0 {
+		g711.SampleRate = uint32(rate)
+	}
+	if stereo, ok := p.Metadata["stereo"].(bool); ok {
+		g711.Channels = util.Conditoinal[byte](stereo, 2, 1)
+	}
+}
@@ -2,9 +2,11 @@ package engine
 
 import (
 	"io"
+	"time"
 
 	"github.com/yapingcat/gomedia/go-mp4"
 	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
 	"m7s.live/engine/v4/track"
 	"m7s.live/engine/v4/util"
 )
@@ -12,51 +14,93 @@ import (
 type MP4Publisher struct {
 	Publisher
 	*mp4.MovDemuxer `json:"-" yaml:"-"`
+	Replay          Replayer
 }
 
 // Start reading the MP4 file
 func (p *MP4Publisher) ReadMP4Data(source io.ReadSeeker) error {
 	defer p.Stop()
-	p.MovDemuxer = mp4.CreateMp4Demuxer(source)
-	if tracks, err := p.ReadHead(); err != nil {
-		if err == io.EOF {
+	p.Replay.bind(&p.Publisher)
+	defer p.Replay.unbind()
+	for {
+		p.MovDemuxer = mp4.CreateMp4Demuxer(source)
+		tracks, err := p.ReadHead()
+		if err != nil {
+			if err == io.EOF {
+				p.Info("Reached end of MP4 file")
+				return nil
+			}
+			p.Error("Error reading MP4 header", zap.Error(err))
+			return err
+		}
+		if p.VideoTrack == nil && p.AudioTrack == nil {
+			info := p.GetMp4Info()
+			p.Info("MP4 info", zap.Any("info", info))
+			for _, t := range tracks {
+				p.Info("MP4 track", zap.Any("track", t))
+				switch t.Cid {
+				case mp4.MP4_CODEC_H264:
+					p.VideoTrack = track.NewH264(p)
+				case mp4.MP4_CODEC_H265:
+					p.VideoTrack = track.NewH265(p)
+				case mp4.MP4_CODEC_AAC:
+					p.AudioTrack = track.NewAAC(p)
+				case mp4.MP4_CODEC_G711A:
+					p.AudioTrack = track.NewG711(p, true)
+				case mp4.MP4_CODEC_G711U:
+					p.AudioTrack = track.NewG711(p, false)
+				case mp4.MP4_CODEC_MP2, mp4.MP4_CODEC_MP3:
+					p.AudioTrack = track.NewMPA(p)
+				}
+			}
+		}
+		action, err := p.readPackets()
+		if err != nil {
+			p.Error("Error reading MP4 packet", zap.Error(err))
+			return err
+		}
+		if action == ReplayStop {
 			p.Info("Reached end of MP4 file")
 			return nil
 		}
-		p.Error("Error reading MP4 header", zap.Error(err))
-		return err
-	} else {
-		info := p.GetMp4Info()
-		p.Info("MP4 info", zap.Any("info", info))
-		for _, t := range tracks {
-			p.Info("MP4 track", zap.Any("track", t))
-			switch t.Cid {
-			case mp4.MP4_CODEC_H264:
-				p.VideoTrack = track.NewH264(p)
-			case mp4.MP4_CODEC_H265:
-				p.VideoTrack = track.NewH265(p)
-			case mp4.MP4_CODEC_AAC:
-				p.AudioTrack = track.NewAAC(p)
-			case mp4.MP4_CODEC_G711A:
-				p.AudioTrack = track.NewG711(p, true)
-			case mp4.MP4_CODEC_G711U:
-				p.AudioTrack = track.NewG711(p, false)
-			}
+		if _, err = source.Seek(0, io.SeekStart); err != nil {
+			return err
 		}
-		for {
-			pkg, err := p.ReadPacket()
-			if err != nil {
-				p.Error("Error reading MP4 packet", zap.Error(err))
-				return err
-			}
-			switch pkg.Cid {
-			case mp4.MP4_CODEC_H264, mp4.MP4_CODEC_H265:
-				p.VideoTrack.WriteAnnexB(uint32(pkg.Pts*90), uint32(pkg.Dts*90), pkg.Data)
-			case mp4.MP4_CODEC_AAC:
-				p.AudioTrack.WriteADTS(uint32(pkg.Pts*90), util.Buffer(pkg.Data))
-			case mp4.MP4_CODEC_G711A, mp4.MP4_CODEC_G711U:
-				p.AudioTrack.WriteRawBytes(uint32(pkg.Pts*90), util.Buffer(pkg.Data))
-			}
+	}
+}
+
+// readPackets 读取并发布一遍数据包，直到文件结尾或者回放控制要求重新开始
+func (p *MP4Publisher) readPackets() (ReplayAction, error) {
+	for {
+		pkg, err := p.ReadPacket()
+		if err == io.EOF {
+			return p.Replay.OnEOF(), nil
+		} else if err != nil {
+			return ReplayStop, err
+		}
+		ts := time.Duration(pkg.Dts) * time.Millisecond
+		var action ReplayAction
+		switch pkg.Cid {
+		case mp4.MP4_CODEC_H264:
+			action = p.Replay.Check(ts, true, annexBKeyFrame(codec.CodecID_H264, pkg.Data))
+		case mp4.MP4_CODEC_H265:
+			action = p.Replay.Check(ts, true, annexBKeyFrame(codec.CodecID_H265, pkg.Data))
+		default:
+			action = p.Replay.Check(ts, false, true)
+		}
+		switch action {
+		case ReplaySkip:
+			continue
+		case ReplayRewind, ReplayStop:
+			return action, nil
+		}
+		switch pkg.Cid {
+		case mp4.MP4_CODEC_H264, mp4.MP4_CODEC_H265:
+			p.VideoTrack.WriteAnnexB(uint32(pkg.Pts*90), uint32(pkg.Dts*90), pkg.Data)
+		case mp4.MP4_CODEC_AAC:
+			p.AudioTrack.WriteADTS(uint32(pkg.Pts*90), util.Buffer(pkg.Data))
+		case mp4.MP4_CODEC_G711A, mp4.MP4_CODEC_G711U, mp4.MP4_CODEC_MP2, mp4.MP4_CODEC_MP3:
+			p.AudioTrack.WriteRawBytes(uint32(pkg.Pts*90), util.Buffer(pkg.Data))
 		}
 	}
 }
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -21,6 +22,7 @@ type RTPDumpPublisher struct {
 	VPayloadType uint8
 	APayloadType uint8
 	other        rtpdump.Packet
+	Replay       Replayer
 	sync.Mutex
 }
 
@@ -33,6 +35,39 @@ func (t *RTPDumpPublisher) Feed(file *os.File) {
 	}
 	t.Lock()
 	t.Stream.Info("RTPDumpPublisher open file success", zap.String("file", file.Name()), zap.String("start", h.Start.String()), zap.String("source", h.Source.String()), zap.Uint16("port", h.Port))
+	t.createTracks()
+	t.Unlock()
+	needLock := true
+	for {
+		packet, err := r.Next()
+		if err != nil {
+			t.Stream.Error("RTPDumpPublisher read file error", zap.Error(err))
+			return
+		}
+		if packet.IsRTCP {
+			continue
+		}
+		if needLock {
+			t.Lock()
+		}
+		if t.other.Payload == nil {
+			t.other = packet
+			t.Unlock()
+			needLock = true
+			continue
+		}
+		if packet.Offset >= t.other.Offset {
+			t.WriteRTP(t.other.Payload)
+			t.other = packet
+			t.Unlock()
+			needLock = true
+			continue
+		}
+		needLock = false
+		t.WriteRTP(packet.Payload)
+	}
+}
+func (t *RTPDumpPublisher) createTracks() {
 	if t.VideoTrack == nil {
 		switch t.VCodec {
 		case codec.CodecID_H264:
@@ -58,42 +93,126 @@ func (t *RTPDumpPublisher) Feed(file *os.File) {
 			t.AudioTrack = track.NewG711(t, true, t.APayloadType)
 		case codec.CodecID_PCMU:
 			t.AudioTrack = track.NewG711(t, false, t.APayloadType)
+		case codec.CodecID_G722:
+			t.AudioTrack = track.NewG722(t, t.APayloadType)
 		}
 		if t.AudioTrack != nil {
 			t.AudioTrack.SetSpeedLimit(500 * time.Millisecond)
 		}
 	}
-	t.Unlock()
-	needLock := true
+}
+
+// ReplayRTPDump 按照回放控制读取单个 rtpdump 文件
+func (t *RTPDumpPublisher) ReplayRTPDump(file *os.File) {
+	defer t.Stop()
+	t.Replay.bind(&t.Publisher)
+	defer t.Replay.unbind()
 	for {
-		packet, err := r.Next()
+		r, h, err := rtpdump.NewReader(file)
 		if err != nil {
-			t.Stream.Error("RTPDumpPublisher read file error", zap.Error(err))
+			t.Stream.Error("RTPDumpPublisher open file error", zap.Error(err))
 			return
 		}
-		if packet.IsRTCP {
-			continue
+		if t.VideoTrack == nil && t.AudioTrack == nil {
+			t.Stream.Info("RTPDumpPublisher open file success", zap.String("file", file.Name()), zap.String("start", h.Start.String()), zap.String("source", h.Source.String()), zap.Uint16("port", h.Port))
+			t.createTracks()
 		}
-		if needLock {
-			t.Lock()
+		if t.replayPackets(r) == ReplayStop {
+			return
 		}
-		if t.other.Payload == nil {
-			t.other = packet
-			t.Unlock()
-			needLock = true
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+}
+
+// replayPackets 和 Feed 一样缓存一个包，时间戳较小的包先写入，以纠正文件中音视频包的乱序
+func (t *RTPDumpPublisher) replayPackets(r *rtpdump.Reader) ReplayAction {
+	var pending rtpdump.Packet
+	for {
+		packet, err := r.Next()
+		if err == io.EOF {
+			if pending.Payload != nil {
+				if action := t.replayPacket(pending); action == ReplayRewind || action == ReplayStop {
+					return action
+				}
+			}
+			return t.Replay.OnEOF()
+		} else if err != nil {
+			t.Stream.Error("RTPDumpPublisher read file error", zap.Error(err))
+			return ReplayStop
+		}
+		if packet.IsRTCP {
 			continue
 		}
-		if packet.Offset >= t.other.Offset {
-			t.WriteRTP(t.other.Payload)
-			t.other = packet
-			t.Unlock()
-			needLock = true
+		if pending.Payload == nil {
+			pending = packet
 			continue
 		}
-		needLock = false
+		if packet.Offset >= pending.Offset {
+			packet, pending = pending, packet
+		}
+		if action := t.replayPacket(packet); action == ReplayRewind || action == ReplayStop {
+			return action
+		}
+	}
+}
+
+func (t *RTPDumpPublisher) replayPacket(packet rtpdump.Packet) ReplayAction {
+	var frame common.RTPFrame
+	if frame.Unmarshal(packet.Payload) == nil {
+		return ReplaySkip
+	}
+	isVideo := frame.PayloadType == t.VPayloadType
+	key := !isVideo || rtpKeyFrame(t.VCodec, frame.Payload)
+	action := t.Replay.Check(packet.Offset, isVideo, key)
+	if action == ReplayWrite {
 		t.WriteRTP(packet.Payload)
 	}
+	return action
 }
+
+// rtpKeyFrame 判断 RTP 包是否为关键帧的开始（参数集或者 IDR 的第一个分片）
+func rtpKeyFrame(codecID codec.VideoCodecID, payload []byte) bool {
+	if len(payload) < 3 {
+		return false
+	}
+	switch codecID {
+	case codec.CodecID_H264:
+		naluType := codec.ParseH264NALUType(payload[0])
+		switch naluType {
+		case codec.NALU_STAPA:
+			// 1 字节 STAP-A 头和 2 字节长度之后是第一个 NALU
+			if len(payload) < 4 {
+				return false
+			}
+			naluType = codec.ParseH264NALUType(payload[3])
+		case codec.NALU_FUA:
+			if payload[1]&0x80 == 0 {
+				return false
+			}
+			naluType = codec.ParseH264NALUType(payload[1])
+		}
+		return naluType == codec.NALU_SPS || naluType == codec.NALU_IDR_Picture
+	case codec.CodecID_H265:
+		naluType := codec.ParseH265NALUType(payload[0])
+		switch naluType {
+		case codec.NAL_UNIT_RTP_AP:
+			if len(payload) < 5 {
+				return false
+			}
+			naluType = codec.ParseH265NALUType(payload[4])
+		case codec.NAL_UNIT_RTP_FU:
+			if payload[2]&0x80 == 0 {
+				return false
+			}
+			naluType = codec.H265NALUType(payload[2] & 0x3F)
+		}
+		return naluType == codec.NAL_UNIT_VPS || (naluType >= codec.NAL_UNIT_CODED_SLICE_BLA && naluType <= codec.NAL_UNIT_CODED_SLICE_CRA)
+	}
+	return true
+}
+
 func (t *RTPDumpPublisher) WriteRTP(raw []byte) {
 	var frame common.RTPFrame
 	frame.Unmarshal(raw)
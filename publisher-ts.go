@@ -1,7 +1,12 @@
 package engine
 
 import (
+	"io"
+	"sync/atomic"
+	"time"
+
 	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
 	"m7s.live/engine/v4/codec/mpegts"
 	"m7s.live/engine/v4/track"
 	"m7s.live/engine/v4/util"
@@ -24,7 +29,8 @@ func NewTSReader(pub *TSPublisher) (r *TSReader) {
 
 type TSPublisher struct {
 	Publisher
-	pool util.BytesPool
+	Replay Replayer
+	pool   util.BytesPool
 }
 
 func (t *TSPublisher) OnEvent(event any) {
@@ -44,7 +50,7 @@ func (t *TSPublisher) OnEvent(event any) {
 }
 
 func (t *TSPublisher) OnPmtStream(s mpegts.MpegTsPmtStream) {
-	switch s.StreamType {
+	switch s.ResolveStreamType() {
 	case mpegts.STREAM_TYPE_H264:
 		if t.VideoTrack == nil {
 			t.VideoTrack = track.NewH264(t, t.pool)
@@ -53,6 +59,10 @@ func (t *TSPublisher) OnPmtStream(s mpegts.MpegTsPmtStream) {
 		if t.VideoTrack == nil {
 			t.VideoTrack = track.NewH265(t, t.pool)
 		}
+	case mpegts.STREAM_TYPE_H266:
+		if t.VideoTrack == nil {
+			t.VideoTrack = track.NewH266(t, t.pool)
+		}
 	case mpegts.STREAM_TYPE_AAC:
 		if t.AudioTrack == nil {
 			t.AudioTrack = track.NewAAC(t, t.pool)
@@ -65,6 +75,18 @@ func (t *TSPublisher) OnPmtStream(s mpegts.MpegTsPmtStream) {
 		if t.AudioTrack == nil {
 			t.AudioTrack = track.NewG711(t, false, t.pool)
 		}
+	case mpegts.STREAM_TYPE_AUDIO_MPEG1, mpegts.STREAM_TYPE_AUDIO_MPEG2:
+		if t.AudioTrack == nil {
+			t.AudioTrack = track.NewMPA(t, t.pool)
+		}
+	case mpegts.STREAM_TYPE_AC3:
+		if t.AudioTrack == nil {
+			t.AudioTrack = track.NewAC3(t, false, t.pool)
+		}
+	case mpegts.STREAM_TYPE_EAC3:
+		if t.AudioTrack == nil {
+			t.AudioTrack = track.NewAC3(t, true, t.pool)
+		}
 	default:
 		t.Warn("unsupport stream type:", zap.Uint8("type", s.StreamType))
 	}
@@ -79,33 +101,133 @@ func (t *TSReader) ReadPES() {
 		if t.Err() != nil {
 			continue
 		}
-		if pes.Header.Dts == 0 {
-			pes.Header.Dts = pes.Header.Pts
+		t.writePES(pes)
+	}
+}
+
+func (t *TSReader) writePES(pes *mpegts.MpegTsPESPacket) {
+	if pes.Header.Dts == 0 {
+		pes.Header.Dts = pes.Header.Pts
+	}
+	switch pes.Header.StreamID & 0xF0 {
+	case mpegts.STREAM_ID_VIDEO:
+		if t.VideoTrack == nil {
+			for _, s := range t.PMT.Stream {
+				t.OnPmtStream(s)
+			}
 		}
-		switch pes.Header.StreamID & 0xF0 {
-		case mpegts.STREAM_ID_VIDEO:
-			if t.VideoTrack == nil {
-				for _, s := range t.PMT.Stream {
-					t.OnPmtStream(s)
-				}
+		if t.VideoTrack != nil {
+			t.WriteAnnexB(uint32(pes.Header.Pts), uint32(pes.Header.Dts), pes.Payload)
+		}
+	default:
+		if t.AudioTrack == nil {
+			for _, s := range t.PMT.Stream {
+				t.OnPmtStream(s)
 			}
-			if t.VideoTrack != nil {
-				t.WriteAnnexB(uint32(pes.Header.Pts), uint32(pes.Header.Dts), pes.Payload)
+		}
+		if t.AudioTrack != nil {
+			switch t.AudioTrack.(type) {
+			case *track.AAC:
+				t.AudioTrack.WriteADTS(uint32(pes.Header.Pts), pes.Payload)
+			case *track.G711, *track.MPA, *track.AC3:
+				t.AudioTrack.WriteRawBytes(uint32(pes.Header.Pts), pes.Payload)
 			}
-		default:
-			if t.AudioTrack == nil {
-				for _, s := range t.PMT.Stream {
-					t.OnPmtStream(s)
-				}
+		}
+	}
+}
+
+// tsAbortReader 回放控制要求重新开始时中断当前的读取
+type tsAbortReader struct {
+	io.Reader
+	abort *atomic.Bool
+}
+
+func (r tsAbortReader) Read(p []byte) (int, error) {
+	if r.abort.Load() {
+		return 0, io.EOF
+	}
+	return r.Reader.Read(p)
+}
+
+// ReplayTS 按照回放控制读取 TS 文件，读完一遍后向 PESChan 发送 nil 作为分隔
+func (t *TSPublisher) ReplayTS(source io.ReadSeeker) {
+	defer t.Stop()
+	t.Replay.bind(&t.Publisher)
+	defer t.Replay.unbind()
+	reader := &TSReader{TSPublisher: t}
+	reader.PESChan = make(chan *mpegts.MpegTsPESPacket, 50)
+	reader.PESBuffer = make(map[uint16]*mpegts.MpegTsPESPacket)
+	var abort atomic.Bool
+	rewind := make(chan bool)
+	go func() {
+		defer close(reader.PESChan)
+		for {
+			err := reader.Feed(tsAbortReader{source, &abort})
+			if err != nil {
+				t.Error("Error reading TS file", zap.Error(err))
+			}
+			reader.PESChan <- nil
+			if again := <-rewind; !again || err != nil {
+				return
 			}
-			if t.AudioTrack != nil {
-				switch t.AudioTrack.(type) {
-				case *track.AAC:
-					t.AudioTrack.WriteADTS(uint32(pes.Header.Pts), pes.Payload)
-				case *track.G711:
-					t.AudioTrack.WriteRawBytes(uint32(pes.Header.Pts), pes.Payload)
-				}
+			if _, err = source.Seek(0, io.SeekStart); err != nil {
+				return
+			}
+			for pid := range reader.PESBuffer {
+				reader.PESBuffer[pid] = nil
+			}
+			abort.Store(false)
+		}
+	}()
+	aborting, stopping, created := false, false, false
+	for pes := range reader.PESChan {
+		if pes == nil {
+			again := !stopping && (aborting || t.Replay.OnEOF() == ReplayRewind)
+			aborting = false
+			rewind <- again
+			continue
+		}
+		if aborting || stopping {
+			continue
+		}
+		// 先根据 PMT 创建轨道，回放控制需要知道是否有视频
+		if !created && len(reader.PMT.Stream) > 0 {
+			created = true
+			for _, s := range reader.PMT.Stream {
+				t.OnPmtStream(s)
 			}
 		}
+		isVideo := pes.Header.StreamID&0xF0 == mpegts.STREAM_ID_VIDEO
+		dts := pes.Header.Dts
+		if dts == 0 {
+			dts = pes.Header.Pts
+		}
+		key := !isVideo || annexBKeyFrame(reader.videoCodec(), pes.Payload)
+		switch t.Replay.Check(time.Duration(dts)*time.Millisecond/90, isVideo, key) {
+		case ReplaySkip:
+			continue
+		case ReplayRewind:
+			aborting = true
+			abort.Store(true)
+			continue
+		case ReplayStop:
+			stopping = true
+			abort.Store(true)
+			continue
+		}
+		reader.writePES(pes)
+	}
+	t.Info("Reached end of TS file")
+}
+
+func (t *TSReader) videoCodec() codec.VideoCodecID {
+	for _, s := range t.PMT.Stream {
+		switch s.StreamType {
+		case mpegts.STREAM_TYPE_H265:
+			return codec.CodecID_H265
+		case mpegts.STREAM_TYPE_H266:
+			return codec.CodecID_H266
+		}
 	}
+	return codec.CodecID_H264
 }
@@ -67,6 +67,18 @@ func (p *Publisher) CreateAudioTrack(codecID codec.AudioCodecID, stuff ...any) c
 		p.AudioTrack = track.NewG711(p, false, stuff...)
 	case codec.CodecID_OPUS:
 		p.AudioTrack = track.NewOpus(p, stuff...)
+	case codec.CodecID_MP3, codec.CodecID_MP2:
+		p.AudioTrack = track.NewMPA(p, stuff...)
+	case codec.CodecID_L16:
+		p.AudioTrack = track.NewLPCM(p, 16, false, stuff...)
+	case codec.CodecID_L24:
+		p.AudioTrack = track.NewLPCM(p, 24, false, stuff...)
+	case codec.CodecID_G722:
+		p.AudioTrack = track.NewG722(p, stuff...)
+	case codec.CodecID_AC3:
+		p.AudioTrack = track.NewAC3(p, false, stuff...)
+	case codec.CodecID_EAC3:
+		p.AudioTrack = track.NewAC3(p, true, stuff...)
 	}
 	return p.AudioTrack
 }
@@ -79,6 +91,12 @@ func (p *Publisher) CreateVideoTrack(codecID codec.VideoCodecID, stuff ...any) c
 		p.VideoTrack = track.NewH265(p, stuff...)
 	case codec.CodecID_AV1:
 		p.VideoTrack = track.NewAV1(p, stuff...)
+	case codec.CodecID_VP8:
+		p.VideoTrack = track.NewVP8(p, stuff...)
+	case codec.CodecID_VP9:
+		p.VideoTrack = track.NewVP9(p, stuff...)
+	case codec.CodecID_H266:
+		p.VideoTrack = track.NewH266(p, stuff...)
 	}
 	return p.VideoTrack
 }
@@ -99,6 +117,15 @@ func (p *Publisher) WriteAVCCVideo(ts uint32, frame *util.BLL, pool util.BytesPo
 			case codec.FourCC_AV1_32:
 				p.VideoTrack = track.NewAV1(p, pool)
 				p.VideoTrack.WriteAVCC(ts, frame)
+			case codec.FourCC_H266_32:
+				p.VideoTrack = track.NewH266(p, pool)
+				p.VideoTrack.WriteAVCC(ts, frame)
+			case codec.FourCC_VP8_32:
+				p.VideoTrack = track.NewVP8(p, pool)
+				p.VideoTrack.WriteAVCC(ts, frame)
+			case codec.FourCC_VP9_32:
+				p.VideoTrack = track.NewVP9(p, pool)
+				p.VideoTrack.WriteAVCC(ts, frame)
 			}
 		} else {
 			if frame.GetByte(1) == 0 {
@@ -140,6 +167,17 @@ func (p *Publisher) WriteAVCCAudio(ts uint32, frame *util.BLL, pool util.BytesPo
 			a.Channels = b0&0x01 + 1
 			a.AVCCHead = []byte{b0}
 			a.WriteAVCC(ts, frame)
+		case *track.MPA:
+			a.WriteAVCC(ts, frame)
+		case *track.LPCM:
+			if b0&0x02 == 0 {
+				p.Stream.Error("8bit linear pcm not support yet")
+				return
+			}
+			a.Audio.SampleRate = uint32(codec.SoundRate[(b0&0x0c)>>2])
+			a.Channels = b0&0x01 + 1
+			a.AVCCHead = []byte{b0}
+			a.WriteAVCC(ts, frame)
 		default:
 			p.Stream.Error("audio codec not support yet", zap.Uint8("codecId", uint8(codec.AudioCodecID(b0>>4))))
 		}
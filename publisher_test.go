@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/track"
+)
+
+func TestG722RTPTimestamp(t *testing.T) {
+	setupTestEngine()
+	var pub Publisher
+	pubConf := config.Global.Publish
+	pub.Config = &pubConf
+	if err := pub.Publish("test/g722", &pub); err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Stop()
+	g722 := track.NewG722(&pub)
+	write := func(seq uint16, ts uint32) *common.AVFrame {
+		item := &common.LIRTP{Value: common.RTPFrame{Packet: &rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: ts, Marker: true}, Payload: []byte{1, 2, 3}}}}
+		g722.WriteRTPFrame(item)
+		return g722.LastValue
+	}
+	first := write(1, 8000)
+	// RTP 时钟频率为8000，换算成90000
+	if first.PTS != 90000 || first.DTS != 90000 {
+		t.Fatalf("first pts %d dts %d", first.PTS, first.DTS)
+	}
+	second := write(2, 8160)
+	if d := second.DTS - first.DTS; d != 160*90000/8000 {
+		t.Fatalf("dts delta %d", d)
+	}
+	if d := second.Timestamp - first.Timestamp; d != 20*time.Millisecond {
+		t.Fatalf("timestamp delta %v", d)
+	}
+}
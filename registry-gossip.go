@@ -0,0 +1,278 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/util"
+)
+
+// gossipStreamsSize 每个 UDP 消息中流列表的大约字节数，流较多时拆成多个消息，避免超过 MTU 被分片或丢弃
+const gossipStreamsSize = 1000
+
+// gossipMessage 节点定时广播的本节点发布的全部流，发送时前面加上 HMAC-SHA256 签名
+type gossipMessage struct {
+	Node    string
+	Address string
+	Streams map[string]time.Time // key 为流路径，value 为开始发布的时间
+	Time    time.Time            `json:",omitempty"` // 发送时间，超过 TTL 的消息视为重放，同一轮广播的分片相同
+	Part    int                  `json:",omitempty"` // 分片序号，从 0 开始
+	Parts   int                  `json:",omitempty"` // 本轮广播的分片数量，0 和 1 都表示没有分片
+}
+
+type gossipPeer struct {
+	gossipMessage
+	lastSeen time.Time
+}
+
+// gossipRound 正在接收的一轮分片广播
+type gossipRound struct {
+	gossipMessage
+	received map[int]bool
+}
+
+// GossipRegistry 通过 UDP 广播同步各节点发布的流，通过 HTTP 踢掉其他节点上的发布者
+type GossipRegistry struct {
+	LocalRegistry
+	conf  *config.Cluster
+	conn  *net.UDPConn
+	peers util.Map[string, *gossipPeer]
+	known util.Map[string, string] // 配置的节点解析后的地址，只接受这些地址发来的消息
+}
+
+// Listen 监听 UDP 端口并开始定时广播
+func (r *GossipRegistry) Listen(ctx context.Context) (err error) {
+	if r.conf.Secret == "" {
+		return ErrGossipSecret
+	}
+	r.resolvePeers()
+	addr, err := net.ResolveUDPAddr("udp", r.conf.ListenUDP)
+	if err != nil {
+		return
+	}
+	if r.conn, err = net.ListenUDP("udp", addr); err != nil {
+		return
+	}
+	go r.receive()
+	go func() {
+		ticker := time.NewTicker(r.conf.Interval)
+		defer ticker.Stop()
+		defer r.conn.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.broadcast()
+			}
+		}
+	}()
+	return
+}
+
+// resolvePeers 解析配置的节点地址，域名对应的地址可能变化，每次广播时重新解析
+func (r *GossipRegistry) resolvePeers() (addrs []*net.UDPAddr) {
+	for _, peer := range r.conf.Peers {
+		addr, err := net.ResolveUDPAddr("udp", peer)
+		if err != nil {
+			Engine.Warn("gossip peer", zap.String("peer", peer), zap.Error(err))
+			continue
+		}
+		r.known.Set(addr.String(), peer)
+		addrs = append(addrs, addr)
+	}
+	return
+}
+
+func (r *GossipRegistry) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(r.conf.Secret))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// decode 校验来源地址、签名和发送时间
+func (r *GossipRegistry) decode(from *net.UDPAddr, data []byte) (msg gossipMessage, err error) {
+	if !r.known.Has(from.String()) {
+		return msg, ErrGossipPeer
+	}
+	if len(data) <= sha256.Size || !hmac.Equal(data[:sha256.Size], r.sign(data[sha256.Size:])) {
+		return msg, ErrGossipSign
+	}
+	if err = json.Unmarshal(data[sha256.Size:], &msg); err != nil {
+		return
+	}
+	if d := time.Since(msg.Time); d > r.conf.TTL || d < -r.conf.TTL {
+		return msg, ErrGossipSign
+	}
+	return
+}
+
+func (r *GossipRegistry) receive() {
+	buf := make([]byte, 65536)
+	rounds := make(map[string]*gossipRound)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		msg, err := r.decode(from, buf[:n])
+		if err != nil {
+			Engine.Debug("gossip drop", zap.String("from", from.String()), zap.Error(err))
+			continue
+		}
+		if msg.Node == "" || msg.Node == r.Node {
+			continue
+		}
+		r.merge(rounds, msg)
+	}
+}
+
+// merge 收齐同一轮广播的所有分片后才替换该节点的流列表，没有收齐时只刷新节点的在线时间
+func (r *GossipRegistry) merge(rounds map[string]*gossipRound, msg gossipMessage) {
+	now := time.Now()
+	if msg.Parts <= 1 {
+		delete(rounds, msg.Node)
+		r.peers.Set(msg.Node, &gossipPeer{msg, now})
+		return
+	}
+	round := rounds[msg.Node]
+	if round == nil || !round.Time.Equal(msg.Time) {
+		round = &gossipRound{msg, make(map[int]bool)}
+		round.Streams = make(map[string]time.Time)
+		rounds[msg.Node] = round
+	}
+	for streamPath, t := range msg.Streams {
+		round.Streams[streamPath] = t
+	}
+	if round.received[msg.Part] = true; len(round.received) >= msg.Parts {
+		delete(rounds, msg.Node)
+		round.Part, round.Parts = 0, 0
+		r.peers.Set(msg.Node, &gossipPeer{round.gossipMessage, now})
+	} else if peer := r.peers.Get(msg.Node); peer != nil {
+		r.peers.Set(msg.Node, &gossipPeer{peer.gossipMessage, now})
+	}
+}
+
+// messages 把本节点的流列表拆成多个签名后的消息
+func (r *GossipRegistry) messages() (datas [][]byte) {
+	now := time.Now()
+	parts := []map[string]time.Time{make(map[string]time.Time)}
+	size := 0
+	r.streams.Range(func(streamPath string, loc *StreamLocation) {
+		// 流路径加上时间的 JSON 编码大约多 48 字节
+		n := len(streamPath) + 48
+		if size+n > gossipStreamsSize && len(parts[len(parts)-1]) > 0 {
+			parts = append(parts, make(map[string]time.Time))
+			size = 0
+		}
+		parts[len(parts)-1][streamPath] = loc.PublishTime
+		size += n
+	})
+	for i, streams := range parts {
+		msg := gossipMessage{r.Node, r.Address, streams, now, i, len(parts)}
+		if len(parts) == 1 {
+			msg.Parts = 0
+		}
+		data, _ := json.Marshal(msg)
+		datas = append(datas, append(r.sign(data), data...))
+	}
+	return
+}
+
+func (r *GossipRegistry) broadcast() {
+	datas := r.messages()
+	for _, addr := range r.resolvePeers() {
+		for _, data := range datas {
+			r.conn.WriteToUDP(data, addr)
+		}
+	}
+}
+
+func (r *GossipRegistry) Announce(streamPath string) {
+	r.LocalRegistry.Announce(streamPath)
+	r.broadcast()
+}
+
+func (r *GossipRegistry) Withdraw(streamPath string) {
+	r.LocalRegistry.Withdraw(streamPath)
+	r.broadcast()
+}
+
+// Lookup 优先查找本节点，其他节点中有多个时取最早发布的
+func (r *GossipRegistry) Lookup(streamPath string) (loc *StreamLocation) {
+	if loc = r.LocalRegistry.Lookup(streamPath); loc != nil {
+		return
+	}
+	r.peers.Range(func(node string, peer *gossipPeer) {
+		if time.Since(peer.lastSeen) > r.conf.TTL {
+			r.peers.Delete(node)
+			return
+		}
+		if t, ok := peer.Streams[streamPath]; ok && (loc == nil || t.Before(loc.PublishTime)) {
+			loc = &StreamLocation{peer.Node, peer.Address, t}
+		}
+	})
+	return
+}
+
+// kickSign 踢流请求的签名，包含流路径和请求时间
+func (r *GossipRegistry) kickSign(streamPath, ts string) string {
+	return fmt.Sprintf("%x", r.sign([]byte("kick\n"+streamPath+"\n"+ts)))
+}
+
+// VerifyKick 校验其他节点发来的踢流请求，请求时间超过 TTL 视为重放
+func (r *GossipRegistry) VerifyKick(streamPath, ts, sign string) error {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrGossipSign
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > r.conf.TTL || d < -r.conf.TTL {
+		return ErrGossipSign
+	}
+	if !hmac.Equal([]byte(sign), []byte(r.kickSign(streamPath, ts))) {
+		return ErrGossipSign
+	}
+	return nil
+}
+
+// Kick 调用其他节点的 /api/stop/publish 踢掉发布者，请求用 Secret 签名
+func (r *GossipRegistry) Kick(streamPath string, loc *StreamLocation) error {
+	if loc.Address == "" {
+		return ErrDuplicatePublish
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	query := url.Values{"streamPath": {streamPath}, "ts": {ts}, "sign": {r.kickSign(streamPath, ts)}}
+	client := http.Client{Timeout: r.conf.Interval + time.Second}
+	res, err := client.Get(loc.Address + "/api/stop/publish?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	// 404 说明发布者已经离开
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("kick %s on %s: %s", streamPath, loc.Node, res.Status)
+	}
+	// 不等待下一次广播，直接移除该节点上的流
+	if peer := r.peers.Get(loc.Node); peer != nil {
+		streams := make(map[string]time.Time, len(peer.Streams))
+		for k, v := range peer.Streams {
+			if k != streamPath {
+				streams[k] = v
+			}
+		}
+		msg := peer.gossipMessage
+		msg.Streams = streams
+		r.peers.Set(loc.Node, &gossipPeer{msg, peer.lastSeen})
+	}
+	return nil
+}
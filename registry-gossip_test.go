@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/config"
+)
+
+func testGossipRegistry(node string) *GossipRegistry {
+	r := &GossipRegistry{conf: &config.Cluster{Secret: "secret", TTL: 5 * time.Second, Peers: []string{"127.0.0.1:4400"}}}
+	r.Node = node
+	r.resolvePeers()
+	return r
+}
+
+func TestGossipDecode(t *testing.T) {
+	r := testGossipRegistry("a")
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4400}
+	encode := func(secret string, sent time.Time) []byte {
+		data, _ := json.Marshal(gossipMessage{Node: "b", Time: sent})
+		signer := &GossipRegistry{conf: &config.Cluster{Secret: secret}}
+		return append(signer.sign(data), data...)
+	}
+	for _, tt := range []struct {
+		name string
+		from *net.UDPAddr
+		data []byte
+		err  error
+	}{
+		{"valid", peer, encode("secret", time.Now()), nil},
+		{"unknown peer", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 4400}, encode("secret", time.Now()), ErrGossipPeer},
+		{"bad signature", peer, encode("other", time.Now()), ErrGossipSign},
+		{"truncated", peer, encode("secret", time.Now())[:16], ErrGossipSign},
+		{"replay outside ttl", peer, encode("secret", time.Now().Add(-time.Minute)), ErrGossipSign},
+		{"from the future", peer, encode("secret", time.Now().Add(time.Minute)), ErrGossipSign},
+	} {
+		msg, err := r.decode(tt.from, tt.data)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		} else if err == nil && msg.Node != "b" {
+			t.Errorf("%s: node %q", tt.name, msg.Node)
+		}
+	}
+}
+
+func TestGossipLookupEarliest(t *testing.T) {
+	r := testGossipRegistry("a")
+	now := time.Now()
+	rounds := make(map[string]*gossipRound)
+	r.merge(rounds, gossipMessage{Node: "b", Address: "http://b", Streams: map[string]time.Time{"live/test": now}})
+	r.merge(rounds, gossipMessage{Node: "c", Address: "http://c", Streams: map[string]time.Time{"live/test": now.Add(-time.Second)}})
+	r.merge(rounds, gossipMessage{Node: "d", Address: "http://d", Streams: map[string]time.Time{"live/test": now.Add(time.Second)}})
+	if loc := r.Lookup("live/test"); loc == nil || loc.Node != "c" {
+		t.Fatalf("lookup %+v", loc)
+	}
+	// 本节点发布的流优先
+	r.LocalRegistry.Announce("live/test")
+	if loc := r.Lookup("live/test"); loc == nil || loc.Node != "a" {
+		t.Fatalf("lookup local %+v", loc)
+	}
+	if loc := r.Lookup("live/none"); loc != nil {
+		t.Fatalf("lookup missing %+v", loc)
+	}
+}
+
+func TestGossipSplit(t *testing.T) {
+	sender := testGossipRegistry("b")
+	for i := 0; i < 100; i++ {
+		sender.LocalRegistry.Announce(fmt.Sprintf("live/stream-%03d", i))
+	}
+	datas := sender.messages()
+	if len(datas) < 2 {
+		t.Fatalf("messages %d", len(datas))
+	}
+	r := testGossipRegistry("a")
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4400}
+	rounds := make(map[string]*gossipRound)
+	for i, data := range datas {
+		if len(data) > 1400 {
+			t.Fatalf("message %d size %d", i, len(data))
+		}
+		msg, err := r.decode(peer, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 收齐之前不替换流列表
+		if loc := r.Lookup("live/stream-000"); loc != nil {
+			t.Fatalf("part %d applied before the round completes", i)
+		}
+		r.merge(rounds, msg)
+	}
+	for i := 0; i < 100; i++ {
+		if loc := r.Lookup(fmt.Sprintf("live/stream-%03d", i)); loc == nil || loc.Node != "b" {
+			t.Fatalf("stream %d: %+v", i, loc)
+		}
+	}
+}
+
+func TestGossipVerifyKick(t *testing.T) {
+	r := testGossipRegistry("a")
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	other := &GossipRegistry{conf: &config.Cluster{Secret: "other"}}
+	for _, tt := range []struct {
+		name, streamPath, ts, sign string
+		err                        error
+	}{
+		{"valid", "live/test", now, r.kickSign("live/test", now), nil},
+		{"other stream", "live/other", now, r.kickSign("live/test", now), ErrGossipSign},
+		{"bad secret", "live/test", now, other.kickSign("live/test", now), ErrGossipSign},
+		{"replay outside ttl", "live/test", old, r.kickSign("live/test", old), ErrGossipSign},
+		{"missing", "live/test", "", "", ErrGossipSign},
+	} {
+		if err := r.VerifyKick(tt.streamPath, tt.ts, tt.sign); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
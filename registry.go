@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/util"
+)
+
+// StreamLocation 流所在的节点
+type StreamLocation struct {
+	Node        string    // 节点标识
+	Address     string    // 节点的 HTTP 地址
+	PublishTime time.Time // 开始发布的时间
+}
+
+// StreamRegistry 集群流注册表
+type StreamRegistry interface {
+	Announce(streamPath string)                        // 本节点开始发布
+	Withdraw(streamPath string)                        // 本节点停止发布
+	Lookup(streamPath string) *StreamLocation          // 查找发布该流的节点，包括本节点
+	Kick(streamPath string, loc *StreamLocation) error // 踢掉其他节点上的发布者
+}
+
+// Registry 当前使用的流注册表，可在引擎启动前替换为自定义的实现
+var Registry StreamRegistry
+
+// LocalRegistry 单机的流注册表
+type LocalRegistry struct {
+	Node    string
+	Address string
+	streams util.Map[string, *StreamLocation]
+}
+
+func (r *LocalRegistry) Announce(streamPath string) {
+	r.streams.Set(streamPath, &StreamLocation{r.Node, r.Address, time.Now()})
+}
+
+func (r *LocalRegistry) Withdraw(streamPath string) {
+	r.streams.Delete(streamPath)
+}
+
+func (r *LocalRegistry) Lookup(streamPath string) *StreamLocation {
+	return r.streams.Get(streamPath)
+}
+
+func (r *LocalRegistry) Kick(streamPath string, loc *StreamLocation) error {
+	return nil
+}
+
+// startRegistry 根据配置创建流注册表
+func startRegistry(ctx context.Context) {
+	conf := &EngineConfig.Cluster
+	if conf.NodeID == "" {
+		conf.NodeID, _ = os.Hostname()
+	}
+	if Registry != nil {
+		return
+	}
+	if conf.Registry == "gossip" {
+		gossip := &GossipRegistry{conf: conf}
+		gossip.Node, gossip.Address = conf.NodeID, conf.Advertise
+		if err := gossip.Listen(ctx); err == nil {
+			Registry = gossip
+			return
+		} else {
+			Engine.Error("gossip listen", zap.String("addr", conf.ListenUDP), zap.Error(err))
+		}
+	}
+	Registry = &LocalRegistry{Node: conf.NodeID, Address: conf.Advertise}
+}
+
+// remoteStream 查找其他节点上发布的流
+func remoteStream(streamPath string) *StreamLocation {
+	if Registry == nil {
+		return nil
+	}
+	if loc := Registry.Lookup(streamPath); loc != nil && loc.Node != EngineConfig.Cluster.NodeID {
+		return loc
+	}
+	return nil
+}
+
+// onRegistryEvent 发布者开始发布或者离开时通知注册表，拉流的发布者不需要通知
+func onRegistryEvent(event any) {
+	if Registry == nil {
+		return
+	}
+	switch v := event.(type) {
+	case SEpublish:
+		if _, isPuller := v.Target.Publisher.(IPuller); !isPuller {
+			Registry.Announce(v.Target.Path)
+		}
+	case SErepublish:
+		if _, isPuller := v.Target.Publisher.(IPuller); !isPuller {
+			Registry.Announce(v.Target.Path)
+		}
+	case SEwaitPublish:
+		Registry.Withdraw(v.Target.Path)
+	case SEclose:
+		Registry.Withdraw(v.Target.Path)
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/util"
+)
+
+// RemoteAuthRequest 发送给鉴权服务的 JSON 内容，鉴权服务返回 2xx 表示允许，401 或 403 表示拒绝，其他状态码视为服务不可用
+type RemoteAuthRequest struct {
+	Action     string // publish 或 subscribe
+	StreamPath string
+	Args       url.Values
+	RemoteAddr string
+	Type       string
+	ID         string `json:",omitempty"`
+}
+
+type remoteAuthResult struct {
+	allow  bool
+	expire time.Time
+}
+
+var remoteAuthCache util.Map[string, *remoteAuthResult]
+
+func remoteAuthPub(p *util.Promise[IPublisher]) error {
+	go remoteAuthResolve(p, "publish", config.Global.RemoteAuth.PublishURL, &p.Value.GetPublisher().IO)
+	return nil
+}
+
+func remoteAuthSub(p *util.Promise[ISubscriber]) error {
+	go remoteAuthResolve(p, "subscribe", config.Global.RemoteAuth.SubscribeURL, &p.Value.GetSubscriber().IO)
+	return nil
+}
+
+func remoteAuthResolve[S any](p *util.Promise[S], action string, authURL string, io *IO) {
+	if err := io.remoteAuth(&config.Global.RemoteAuth, action, authURL); err != nil {
+		p.Reject(err)
+	} else {
+		p.Resolve()
+	}
+}
+
+// remoteAuth 请求鉴权服务，允许和拒绝的结果按照流路径、参数和客户端 IP 缓存
+func (io *IO) remoteAuth(conf *config.RemoteAuth, action string, authURL string) error {
+	ip, _, err := net.SplitHostPort(io.RemoteAddr)
+	if err != nil {
+		ip = io.RemoteAddr
+	}
+	key := fmt.Sprintf("%s %s?%s %s", action, io.Stream.Path, io.Args.Encode(), ip)
+	if r := remoteAuthCache.Get(key); r != nil {
+		if time.Now().Before(r.expire) {
+			return util.Conditoinal[error](r.allow, nil, ErrAuth)
+		}
+		remoteAuthCache.Delete(key)
+	}
+	allow, err := io.requestRemoteAuth(conf, action, authURL)
+	if err != nil {
+		io.Warn("remote auth unavailable", zap.String("action", action), zap.Bool("failOpen", conf.FailOpen), zap.Error(err))
+		return util.Conditoinal[error](conf.FailOpen, nil, ErrAuthUnavailable)
+	}
+	if conf.CacheTTL > 0 {
+		remoteAuthCache.Set(key, &remoteAuthResult{allow, time.Now().Add(conf.CacheTTL)})
+	}
+	if !allow {
+		io.Warn("remote auth denied", zap.String("action", action))
+		return ErrAuth
+	}
+	return nil
+}
+
+// sweepRemoteAuth 按照 CacheTTL 的间隔定期清理过期的鉴权结果，避免每次未命中都遍历缓存
+func sweepRemoteAuth(ctx context.Context) {
+	for {
+		interval := config.Global.RemoteAuth.CacheTTL
+		if interval <= 0 {
+			interval = time.Minute
+		} else if interval < time.Second {
+			interval = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			expireRemoteAuth(time.Now())
+		}
+	}
+}
+
+func expireRemoteAuth(now time.Time) {
+	remoteAuthCache.Range(func(k string, r *remoteAuthResult) {
+		if now.After(r.expire) {
+			remoteAuthCache.Delete(k)
+		}
+	})
+}
+
+func (io *IO) requestRemoteAuth(conf *config.RemoteAuth, action string, authURL string) (allow bool, err error) {
+	body, err := json.Marshal(&RemoteAuthRequest{
+		Action:     action,
+		StreamPath: io.Stream.Path,
+		Args:       io.Args,
+		RemoteAddr: io.RemoteAddr,
+		Type:       io.Type,
+		ID:         io.ID,
+	})
+	if err != nil {
+		return
+	}
+	client := http.Client{Timeout: conf.Timeout}
+	res, err := client.Post(authURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return true, nil
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return false, nil
+	}
+	return false, fmt.Errorf("remote auth status %d", res.StatusCode)
+}
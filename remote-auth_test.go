@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/config"
+)
+
+func TestRemoteAuthCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	conf := &config.RemoteAuth{Timeout: time.Second, CacheTTL: time.Minute}
+	io := &IO{RemoteAddr: "127.0.0.1:1935", Stream: &Stream{Path: "live/auth"}}
+	for i := 0; i < 2; i++ {
+		if err := io.remoteAuth(conf, "publish", server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("requests %d", n)
+	}
+	// 清理只删除过期的结果
+	remoteAuthCache.Set("expired", &remoteAuthResult{true, time.Now().Add(-time.Second)})
+	expireRemoteAuth(time.Now())
+	if remoteAuthCache.Has("expired") || remoteAuthCache.Len() != 1 {
+		t.Fatalf("cache size %d", remoteAuthCache.Len())
+	}
+	expireRemoteAuth(time.Now().Add(2 * time.Minute))
+	if remoteAuthCache.Len() != 0 {
+		t.Fatalf("cache size %d after ttl", remoteAuthCache.Len())
+	}
+}
@@ -0,0 +1,334 @@
+package engine
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+// ReplayAction 回放控制对当前数据包的处理结果
+type ReplayAction byte
+
+const (
+	ReplayWrite  ReplayAction = iota // 写入当前数据包
+	ReplaySkip                       // 丢弃当前数据包
+	ReplayRewind                     // 回到文件开头重新读取
+	ReplayStop                       // 结束回放
+)
+
+var (
+	ErrReplayNotSeekable = errors.New("replay source not seekable")
+	// Replays 正在进行的文件回放，key 为 streamPath
+	Replays util.Map[string, *Replayer]
+)
+
+// ReplayState 回放选项和进度
+type ReplayState struct {
+	StreamPath string
+	Loop       int           // 播放次数，-1 为无限循环，0 和 1 都只播放一次
+	Start      time.Duration // 每次播放的起始位置
+	End        time.Duration // 每次播放的结束位置，0 为文件末尾
+	Speed      float64       // 播放倍速，0 为原速
+	Loops      int           // 已播放完成的次数
+	Position   time.Duration // 当前播放位置
+	Paused     bool
+}
+
+// Replayer 文件回放控制，零值为按原速播放一次
+type Replayer struct {
+	ReplayState
+	mu        sync.Mutex
+	wake      chan struct{}
+	publisher *Publisher
+	video     common.VideoTrack
+	audio     common.AudioTrack
+	base      time.Duration // 本轮第一个数据包的时间戳
+	baseSet   bool
+	skipTo    time.Duration // 跳过该位置之前的数据包
+	skipping  bool
+	seekTo    time.Duration
+	seeking   bool
+	paceTime  time.Time // 节奏控制的起始时间
+	pacePos   time.Duration
+	paceSet   bool
+	written   bool
+	stopped   bool
+}
+
+// parseReplayDuration 支持 Go 时间格式（如 1m30s）或者秒数
+func parseReplayDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// State 返回当前回放状态的副本，供接口输出
+func (r *Replayer) State() ReplayState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ReplayState
+}
+
+// ParseQuery 从 loop、start、end、speed 参数中读取回放选项
+func (r *Replayer) ParseQuery(q url.Values) (err error) {
+	if s := q.Get("loop"); s != "" {
+		if r.Loop, err = strconv.Atoi(s); err != nil {
+			return
+		}
+		if r.Loop < -1 {
+			return errors.New("invalid loop")
+		}
+	}
+	if s := q.Get("start"); s != "" {
+		if r.Start, err = parseReplayDuration(s); err != nil {
+			return
+		}
+	}
+	if s := q.Get("end"); s != "" {
+		if r.End, err = parseReplayDuration(s); err != nil {
+			return
+		}
+	}
+	if s := q.Get("speed"); s != "" {
+		if r.Speed, err = strconv.ParseFloat(s, 64); err != nil {
+			return
+		}
+		if r.Speed <= 0 {
+			return errors.New("speed must be positive")
+		}
+	}
+	if r.Start < 0 || r.End < 0 || (r.End > 0 && r.End <= r.Start) {
+		return errors.New("invalid start or end")
+	}
+	return
+}
+
+// bind 开始回放时调用，注册到 Replays 中供控制接口使用
+func (r *Replayer) bind(p *Publisher) {
+	r.mu.Lock()
+	r.publisher = p
+	r.wake = make(chan struct{}, 1)
+	r.StreamPath = p.Stream.Path
+	if r.Start > 0 {
+		r.skipTo, r.skipping = r.Start, true
+	}
+	r.mu.Unlock()
+	Replays.Set(r.StreamPath, r)
+}
+
+func (r *Replayer) unbind() {
+	Replays.CompareAndDelete(r.StreamPath, r)
+}
+
+func (r *Replayer) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pause 暂停回放，数据不再写入轨道
+func (r *Replayer) Pause() {
+	r.mu.Lock()
+	r.Paused = true
+	r.mu.Unlock()
+}
+
+// Resume 恢复回放，从当前位置重新计算节奏
+func (r *Replayer) Resume() {
+	r.mu.Lock()
+	r.Paused, r.paceSet = false, false
+	r.mu.Unlock()
+	r.notify()
+}
+
+// Seek 跳转到指定位置，从该位置之后的第一个关键帧开始播放
+func (r *Replayer) Seek(pos time.Duration) {
+	r.mu.Lock()
+	r.seekTo, r.seeking = pos, true
+	r.mu.Unlock()
+	r.notify()
+}
+
+// Stop 结束回放并停止发布
+func (r *Replayer) Stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	r.notify()
+}
+
+// offline 将轨道置为离线，下一帧写入时由 Media.Flush 保持时间戳连续
+func (r *Replayer) offline() {
+	if !r.written {
+		return
+	}
+	if r.video != nil {
+		r.video.SetStuff(common.TrackStateOffline)
+	}
+	if r.audio != nil {
+		r.audio.SetStuff(common.TrackStateOffline)
+	}
+	r.paceSet = false
+}
+
+// takeOver 由回放控制节奏，关闭轨道自身的流速控制
+func (r *Replayer) takeOver() {
+	if p := r.publisher; p != nil {
+		if p.VideoTrack != r.video {
+			if r.video = p.VideoTrack; r.video != nil {
+				r.video.SetSpeedLimit(0)
+			}
+		}
+		if p.AudioTrack != r.audio {
+			if r.audio = p.AudioTrack; r.audio != nil {
+				r.audio.SetSpeedLimit(0)
+			}
+		}
+	}
+}
+
+func (r *Replayer) closed() bool {
+	return r.stopped || (r.publisher != nil && r.publisher.IsClosed())
+}
+
+// Check 读取到时间戳为 ts 的数据包后调用，决定如何处理该数据包，必要时等待到播放时间
+func (r *Replayer) Check(ts time.Duration, video bool, key bool) ReplayAction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.takeOver()
+	if !r.baseSet {
+		r.base, r.baseSet = ts, true
+	}
+	pos := ts - r.base
+	for {
+		if r.closed() {
+			return ReplayStop
+		}
+		if r.seeking {
+			r.seeking = false
+			r.offline()
+			r.skipTo, r.skipping = r.seekTo, true
+			if r.seekTo < pos {
+				r.baseSet = false
+				return ReplayRewind
+			}
+		}
+		if r.skipping {
+			if pos < r.skipTo || (r.video != nil && !(video && key)) {
+				return ReplaySkip
+			}
+			r.skipping = false
+		}
+		if r.End > 0 && pos >= r.End {
+			return r.finish()
+		}
+		r.Position = pos
+		if r.Paused {
+			r.wait(0)
+			continue
+		}
+		if !r.paceSet {
+			r.paceTime, r.pacePos, r.paceSet = time.Now(), pos, true
+		}
+		speed := r.Speed
+		if speed <= 0 {
+			speed = 1
+		}
+		if wait := time.Duration(float64(pos-r.pacePos)/speed) - time.Since(r.paceTime); wait > 0 {
+			r.wait(wait)
+			continue
+		}
+		r.written = true
+		return ReplayWrite
+	}
+}
+
+// wait 释放锁等待控制指令或者超时，d 为 0 时一直等待
+func (r *Replayer) wait(d time.Duration) {
+	r.mu.Unlock()
+	defer r.mu.Lock()
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var done <-chan struct{}
+	if r.publisher != nil {
+		done = r.publisher.Done()
+	}
+	select {
+	case <-timeout:
+	case <-r.wake:
+	case <-done:
+	}
+}
+
+// OnEOF 读到文件末尾时调用，返回 ReplayRewind 表示需要重新播放
+func (r *Replayer) OnEOF() ReplayAction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed() {
+		return ReplayStop
+	}
+	// 文件末尾之后的跳转只能从头开始
+	if r.seeking {
+		r.seeking = false
+		r.offline()
+		r.skipTo, r.skipping = r.seekTo, true
+		r.baseSet = false
+		return ReplayRewind
+	}
+	return r.finish()
+}
+
+func (r *Replayer) finish() ReplayAction {
+	r.Loops++
+	if r.Loop >= 0 && r.Loops >= r.Loop {
+		return ReplayStop
+	}
+	if r.publisher != nil {
+		r.publisher.Info("replay loop", zap.Int("loops", r.Loops))
+	}
+	r.offline()
+	r.baseSet = false
+	if r.Start > 0 {
+		r.skipTo, r.skipping = r.Start, true
+	}
+	return ReplayRewind
+}
+
+// annexBKeyFrame 判断 AnnexB 格式的视频帧是否为关键帧
+func annexBKeyFrame(codecID codec.VideoCodecID, frame []byte) bool {
+	for _, nalu := range codec.SplitH264(frame) {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch codecID {
+		case codec.CodecID_H265:
+			if t := codec.ParseH265NALUType(nalu[0]); t >= codec.NAL_UNIT_CODED_SLICE_BLA && t <= codec.NAL_UNIT_CODED_SLICE_CRA {
+				return true
+			}
+		case codec.CodecID_H266:
+			if len(nalu) > 1 {
+				if t := codec.ParseH266NALUType(nalu[1]); t >= codec.H266_NAL_IDR_W_RADL && t <= codec.H266_NAL_CRA {
+					return true
+				}
+			}
+		default:
+			if codec.ParseH264NALUType(nalu[0]) == codec.NALU_IDR_Picture {
+				return true
+			}
+		}
+	}
+	return false
+}
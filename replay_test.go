@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/codec"
+)
+
+// checkAll 依次检查从 base 开始、间隔 step 的 n 个数据包
+func checkAll(r *Replayer, base, step time.Duration, n int) (actions []ReplayAction) {
+	for i := 0; i < n; i++ {
+		action := r.Check(base+time.Duration(i)*step, false, true)
+		actions = append(actions, action)
+		if action == ReplayRewind || action == ReplayStop {
+			return
+		}
+	}
+	return
+}
+
+func equalActions(a, b []ReplayAction) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplayerCheck(t *testing.T) {
+	t.Run("range and loop", func(t *testing.T) {
+		r := &Replayer{}
+		r.Loop, r.Start, r.End, r.Speed = 2, time.Second, 3*time.Second, 1e6
+		r.skipTo, r.skipping = r.Start, true
+		want := []ReplayAction{ReplaySkip, ReplaySkip, ReplayWrite, ReplayWrite, ReplayWrite, ReplayWrite, ReplayRewind}
+		// 时间戳不从0开始，位置以第一个数据包为准
+		if got := checkAll(r, 10*time.Second, 500*time.Millisecond, 10); !equalActions(got, want) {
+			t.Fatalf("first loop: got %v, want %v", got, want)
+		}
+		if r.Loops != 1 || r.Position != 2500*time.Millisecond {
+			t.Fatalf("loops %d position %v", r.Loops, r.Position)
+		}
+		want[len(want)-1] = ReplayStop
+		if got := checkAll(r, 10*time.Second, 500*time.Millisecond, 10); !equalActions(got, want) {
+			t.Fatalf("second loop: got %v, want %v", got, want)
+		}
+	})
+	t.Run("stop", func(t *testing.T) {
+		r := &Replayer{}
+		if r.Check(0, false, true) != ReplayWrite {
+			t.Fatal("first packet should be written")
+		}
+		r.Stop()
+		if r.Check(time.Second, false, true) != ReplayStop {
+			t.Fatal("stopped replay should stop")
+		}
+	})
+	t.Run("pace", func(t *testing.T) {
+		r := &Replayer{}
+		r.Speed = 2
+		start := time.Now()
+		checkAll(r, 0, 100*time.Millisecond, 3)
+		// 两倍速播放 200ms 的数据需要 100ms
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+			t.Fatalf("elapsed %v", elapsed)
+		}
+	})
+}
+
+func TestReplayerOnEOF(t *testing.T) {
+	for _, tt := range []struct {
+		loop int
+		want []ReplayAction
+	}{
+		{0, []ReplayAction{ReplayStop}},
+		{1, []ReplayAction{ReplayStop}},
+		{3, []ReplayAction{ReplayRewind, ReplayRewind, ReplayStop}},
+		{-1, []ReplayAction{ReplayRewind, ReplayRewind, ReplayRewind, ReplayRewind}},
+	} {
+		r := &Replayer{}
+		r.Loop = tt.loop
+		var got []ReplayAction
+		for len(got) < len(tt.want) {
+			action := r.OnEOF()
+			got = append(got, action)
+			if action == ReplayStop {
+				break
+			}
+		}
+		if !equalActions(got, tt.want) {
+			t.Errorf("loop %d: got %v, want %v", tt.loop, got, tt.want)
+		}
+	}
+	t.Run("start", func(t *testing.T) {
+		r := &Replayer{}
+		r.Loop, r.Start, r.Speed = 2, time.Second, 1e6
+		if r.OnEOF() != ReplayRewind {
+			t.Fatal("should rewind")
+		}
+		// 重新播放时从 Start 开始
+		want := []ReplayAction{ReplaySkip, ReplayWrite}
+		if got := checkAll(r, 0, time.Second, 2); !equalActions(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestReplayerSeek(t *testing.T) {
+	t.Run("forward", func(t *testing.T) {
+		r := &Replayer{}
+		r.Speed = 1e6
+		r.Check(0, false, true)
+		r.Seek(2 * time.Second)
+		want := []ReplayAction{ReplaySkip, ReplayWrite, ReplayWrite}
+		if got := checkAll(r, time.Second, time.Second, 3); !equalActions(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if r.Position != 3*time.Second {
+			t.Fatalf("position %v", r.Position)
+		}
+	})
+	t.Run("backward", func(t *testing.T) {
+		r := &Replayer{}
+		r.Speed = 1e6
+		checkAll(r, 0, time.Second, 3)
+		r.Seek(time.Second)
+		if action := r.Check(3*time.Second, false, true); action != ReplayRewind {
+			t.Fatalf("got %v, want rewind", action)
+		}
+		want := []ReplayAction{ReplaySkip, ReplayWrite}
+		if got := checkAll(r, 0, time.Second, 2); !equalActions(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if r.Loops != 0 {
+			t.Fatalf("seek should not count as loop, loops %d", r.Loops)
+		}
+	})
+	t.Run("after eof", func(t *testing.T) {
+		r := &Replayer{}
+		r.Speed = 1e6
+		checkAll(r, 0, time.Second, 2)
+		r.Seek(5 * time.Second)
+		if action := r.OnEOF(); action != ReplayRewind {
+			t.Fatalf("got %v, want rewind", action)
+		}
+		want := []ReplayAction{ReplaySkip, ReplaySkip, ReplayWrite}
+		if got := checkAll(r, 3*time.Second, 5*time.Second/2, 3); !equalActions(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestRTPKeyFrame(t *testing.T) {
+	for _, tt := range []struct {
+		payload []byte
+		want    bool
+	}{
+		{[]byte{0x65, 0x88, 0x80}, true},       // IDR
+		{[]byte{0x41, 0x9a, 0x00}, false},      // 非 IDR
+		{[]byte{0x78, 0x00, 0x01}, false},      // STAP-A 没有 NALU
+		{[]byte{0x78, 0x00, 0x01, 0x67}, true}, // STAP-A 中的 SPS
+		{[]byte{0x7c, 0x85, 0x00}, true},       // FU-A IDR 起始分片
+		{[]byte{0x7c, 0x05, 0x00}, false},      // FU-A IDR 后续分片
+	} {
+		if got := rtpKeyFrame(codec.CodecID_H264, tt.payload); got != tt.want {
+			t.Errorf("%x: got %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
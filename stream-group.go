@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+// Rendition 多码率流组中的一路视频
+type Rendition struct {
+	StreamPath string
+	Track      string
+	Codec      string
+	Width      uint
+	Height     uint
+	BPS        int
+	FPS        int
+	Online     bool // 对应的流和轨道是否存在
+	video      *track.Video
+}
+
+// StreamGroup 按配置顺序排列的多码率流组，成员可以是同一个流中的多个视频轨道，也可以是多个兄弟流
+type StreamGroup struct {
+	Name       string
+	Renditions []Rendition
+}
+
+// findGroup 查找流组并解析每个成员对应的视频轨道，成员形如 live/test 或 live/test?vts=h264_1
+func findGroup(name string) *StreamGroup {
+	members, ok := EngineConfig.StreamGroups[name]
+	if !ok {
+		return nil
+	}
+	group := &StreamGroup{Name: name, Renditions: make([]Rendition, len(members))}
+	for i, member := range members {
+		streamPath, query, _ := strings.Cut(member, "?")
+		args, _ := url.ParseQuery(query)
+		r := &group.Renditions[i]
+		r.StreamPath, r.Track = streamPath, args.Get(EngineConfig.Subscribe.SubVideoArgName)
+		s := Streams.Get(streamPath)
+		if s == nil {
+			continue
+		}
+		if r.Track == "" {
+			r.video = s.Tracks.MainVideo
+		} else if t, ok := s.Tracks.Load(r.Track); ok {
+			r.video, _ = t.(*track.Video)
+		}
+		if v := r.video; v != nil {
+			r.Online = true
+			r.Track = v.Name
+			r.Codec = v.CodecID.String()
+			r.Width, r.Height = v.Width, v.Height
+			r.BPS, r.FPS = v.BPS, v.FPS
+		}
+	}
+	return group
+}
+
+// groups 所有配置的流组
+func groups() (list []*StreamGroup) {
+	for name := range EngineConfig.StreamGroups {
+		list = append(list, findGroup(name))
+	}
+	return
+}
+
+// renditionHolder 订阅者切换到兄弟流的视频后，代替订阅者加入兄弟流的订阅者列表，
+// 使兄弟流计入订阅者数量和限制，并且不会因为没有订阅者而关闭
+type renditionHolder struct {
+	Subscriber
+}
+
+// OnAuth 订阅者已经通过了原来的流的鉴权，流组由配置指定，不再重复鉴权
+func (h *renditionHolder) OnAuth(promise *util.Promise[ISubscriber]) error {
+	promise.Resolve()
+	return nil
+}
+
+// OnEvent 轨道由原订阅者读取，这里不读取
+func (h *renditionHolder) OnEvent(event any) {
+	if _, ok := event.(common.Track); !ok {
+		h.Subscriber.OnEvent(event)
+	}
+}
+
+func (h *renditionHolder) release() {
+	if h == nil {
+		return
+	}
+	h.Stop(zap.String("reason", "rendition switched"))
+	h.Stream.Receive(Unsubscribe(h))
+}
+
+// holdRendition 视频轨道属于其他流时，在该流中加入占位订阅者，属于同一个流时返回 nil
+func holdRendition(s *Subscriber, v *track.Video) (*renditionHolder, error) {
+	if v.Publisher == nil {
+		return nil, nil
+	}
+	stream := v.Publisher.GetStream()
+	if stream == nil || stream == common.IStream(s.Stream) {
+		return nil, nil
+	}
+	h := &renditionHolder{}
+	h.ID, h.Type, h.RemoteAddr = s.ID, "RenditionHolder", s.RemoteAddr
+	conf := *s.Config
+	conf.SubAudio = false
+	h.Config = &conf
+	h.Args = url.Values{conf.SubVideoArgName: {v.Name}}
+	h.SetParentCtx(s.IO.Context)
+	if err := h.Subscribe(stream.GetPath(), h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -196,17 +197,20 @@ type Stream struct {
 	*log.Logger
 	StartTime time.Time //创建时间
 	StreamTimeoutConfig
-	Path        string
-	Publisher   IPublisher
-	publisher   *Publisher
-	State       StreamState
-	SEHistory   []StateEvent // 事件历史
-	Subscribers Subscribers  // 订阅者
-	Tracks      Tracks
-	AppName     string
-	StreamName  string
-	IsPause     bool // 是否处于暂停状态
-	pubLocker   sync.Mutex
+	Path           string
+	Publisher      IPublisher
+	publisher      *Publisher
+	State          StreamState
+	SEHistory      []StateEvent // 事件历史
+	Subscribers    Subscribers  // 订阅者
+	Tracks         Tracks
+	AppName        string
+	StreamName     string
+	IsPause        bool                        // 是否处于暂停状态
+	limitPublisher *Publisher                  // 占用了发布者数量的发布者
+	standby        []*util.Promise[IPublisher] // 热备的发布者
+	pubLocker      sync.Mutex
+	originPulling  atomic.Bool // 是否正在回源
 }
 type StreamSummay struct {
 	Path        string
@@ -315,6 +319,7 @@ func (r *Stream) action(action StreamAction) (ok bool) {
 		switch next {
 		case STATE_WAITPUBLISH:
 			stateEvent = SEwaitPublish{event, r.Publisher}
+			r.releasePublisher()
 			waitTime := time.Duration(0)
 			if r.Publisher != nil {
 				waitTime = r.Publisher.GetConfig().WaitCloseTimeout
@@ -357,6 +362,7 @@ func (r *Stream) action(action StreamAction) (ok bool) {
 			}
 		case STATE_CLOSED:
 			Streams.Delete(r.Path)
+			r.releasePublisher()
 			r.timeout.Stop()
 			stateEvent = SEclose{event}
 			r.Subscribers.Broadcast(stateEvent)
@@ -365,6 +371,10 @@ func (r *Stream) action(action StreamAction) (ok bool) {
 					t.Dispose()
 				}
 			})
+			for _, v := range r.standby {
+				v.Reject(ErrStreamIsClosed)
+			}
+			r.standby = nil
 			r.Subscribers.Dispose()
 			r.actionChan.Close()
 		}
@@ -381,12 +391,97 @@ func (r *Stream) action(action StreamAction) (ok bool) {
 				r.Warn("action timeout after send to publisher", zap.String("action", action.String()), zap.Duration("cost", actionCoust))
 			}
 		}
+		if next == STATE_WAITPUBLISH {
+			r.switchStandby()
+		}
 	} else {
 		r.Debug("wrong action", zap.String("action", action.String()))
 	}
 	return
 }
 
+// acceptPublisher 接受发布者，接管老的发布者的音视频轨道
+func (s *Stream) acceptPublisher(v *util.Promise[IPublisher], republish bool) bool {
+	puber := v.Value.GetPublisher()
+	acquired := s.limitPublisher != puber
+	if acquired && !publisherCounter.acquire(&EngineConfig.PublishLimit, &puber.IO) {
+		s.Warn("publisher limit exceeded", zap.String("remote", puber.RemoteAddr))
+		v.Reject(ErrLimitExceeded)
+		return false
+	}
+	oldPuber := s.publisher
+	policy := puber.Config.GetDuplicatePolicy()
+	// 热备和优先级策略从正在发布的发布者无缝切换过来，踢掉老的发布者时按照新的发布处理
+	takeover := !republish && oldPuber != nil && s.State != STATE_WAITPUBLISH && (policy == "standby" || policy == "priority")
+	s.publisher = puber
+	conf := puber.Config
+	if republish {
+		s.Info("republish")
+		s.Tracks.Range(func(name string, t common.Track) {
+			t.SetStuff(common.TrackStateOffline)
+		})
+	}
+	s.Publisher = v.Value
+	s.PublishTimeout = conf.PublishTimeout
+	s.DelayCloseTimeout = conf.DelayCloseTimeout
+	s.IdleTimeout = conf.IdleTimeout
+	s.PauseTimeout = conf.PauseTimeout
+	s.action(ACTION_PUBLISH)
+	if oldPuber != nil {
+		// 接管老的发布者的音视频轨道
+		puber.AudioTrack = oldPuber.AudioTrack
+		puber.VideoTrack = oldPuber.VideoTrack
+		if takeover {
+			// 时间戳接续，视频从下一个关键帧开始
+			s.Tracks.Range(func(name string, t common.Track) {
+				t.SetStuff(common.TrackStateOffline)
+			})
+			if puber.VideoTrack != nil {
+				puber.VideoTrack.SetLostFlag()
+			}
+		}
+	}
+	if acquired {
+		s.releasePublisher()
+		s.limitPublisher = puber
+	}
+	v.Resolve()
+	return true
+}
+
+// switchStandby 发布者超时后切换到第一个可用的热备发布者
+func (s *Stream) switchStandby() {
+	for len(s.standby) > 0 {
+		v := s.standby[0]
+		s.standby = s.standby[1:]
+		if v.Value.IsClosed() {
+			v.Reject(ErrStreamIsClosed)
+			continue
+		}
+		if s.Publisher != nil {
+			s.Publisher.OnEvent(SEKick{CreateEvent(util.Null)})
+		}
+		s.Info("switch to standby", zap.String("type", v.Value.GetPublisher().Type))
+		if s.acceptPublisher(v, false) {
+			return
+		}
+	}
+}
+
+// publishPriority 发布者在参数中携带的优先级，默认为 0
+func publishPriority(puber *Publisher) int {
+	priority, _ := strconv.Atoi(puber.Args.Get(puber.Config.PriorityArgName))
+	return priority
+}
+
+// releasePublisher 发布者离开后释放占用的发布者数量
+func (r *Stream) releasePublisher() {
+	if r.limitPublisher != nil {
+		publisherCounter.release(&r.limitPublisher.IO)
+		r.limitPublisher = nil
+	}
+}
+
 func (r *Stream) IsShutdown() bool {
 	switch l := len(r.SEHistory); l {
 	case 0:
@@ -534,37 +629,24 @@ func (s *Stream) run() {
 					break
 				}
 				puber := v.Value.GetPublisher()
-				oldPuber := s.publisher
-				s.publisher = puber
-				conf := puber.Config
 				republish := s.Publisher == v.Value // 重复发布
-				if republish {
-					s.Info("republish")
-					s.Tracks.Range(func(name string, t common.Track) {
-						t.SetStuff(common.TrackStateOffline)
-					})
-				}
-				needKick := !republish && oldPuber != nil && conf.KickExist // 需要踢掉老的发布者
-				if needKick {
-					s.Warn("kick", zap.String("old type", oldPuber.Type))
-					s.Publisher.OnEvent(SEKick{CreateEvent(util.Null)})
-				}
-				s.Publisher = v.Value
-				s.PublishTimeout = conf.PublishTimeout
-				s.DelayCloseTimeout = conf.DelayCloseTimeout
-				s.IdleTimeout = conf.IdleTimeout
-				s.PauseTimeout = conf.PauseTimeout
-				if s.action(ACTION_PUBLISH) || republish || needKick {
-					if oldPuber != nil {
-						// 接管老的发布者的音视频轨道
-						puber.AudioTrack = oldPuber.AudioTrack
-						puber.VideoTrack = oldPuber.VideoTrack
+				if !republish && s.State != STATE_WAITPUBLISH {
+					// 已经有发布者，按照重复发布策略处理
+					switch policy := puber.Config.GetDuplicatePolicy(); {
+					case policy == "kick", policy == "priority" && publishPriority(puber) > publishPriority(s.publisher):
+						s.Warn("kick", zap.String("old type", s.publisher.Type))
+						s.Publisher.OnEvent(SEKick{CreateEvent(util.Null)})
+					case policy == "standby":
+						s.Info("standby", zap.String("type", puber.Type), zap.String("remote", puber.RemoteAddr))
+						s.standby = append(s.standby, v)
+						continue
+					default:
+						s.Warn("duplicate publish")
+						v.Reject(ErrDuplicatePublish)
+						continue
 					}
-					v.Resolve()
-				} else {
-					s.Warn("duplicate publish")
-					v.Reject(ErrDuplicatePublish)
 				}
+				s.acceptPublisher(v, republish)
 			case *util.Promise[ISubscriber]:
 				timeOutInfo = zap.String("action", "Subscribe")
 				if s.IsClosed() {
@@ -596,6 +678,24 @@ func (s *Stream) run() {
 				} else {
 					// waits.data.Wait()
 				}
+				if _, ok := s.Subscribers.public[suber]; !ok && !sbConfig.Internal {
+					if !admitBandwidth(waits.bps(&s.Tracks)) {
+						io.Warn("egress bandwidth exceeded", zap.Int("limit", EngineConfig.EgressLimit))
+						v.Reject(ErrBandwidthLimit)
+						break
+					}
+					if !subscriberCounter.acquire(&EngineConfig.SubscribeLimit, &io.IO) {
+						io.Warn("subscriber limit exceeded")
+						v.Reject(ErrLimitExceeded)
+						break
+					}
+					if !io.acquireJWTSession() {
+						subscriberCounter.release(&io.IO)
+						io.Warn("jwt sessions exceeded", zap.Int("maxSessions", io.jwtMaxSessions))
+						v.Reject(ErrAuth)
+						break
+					}
+				}
 				if s.Publisher != nil {
 					s.Publisher.OnEvent(v) // 通知Publisher有新的订阅者加入，在回调中可以去获取订阅者数量
 					pubConfig := s.Publisher.GetConfig()
@@ -618,6 +718,13 @@ func (s *Stream) run() {
 					}
 				}
 				s.Subscribers.Add(suber, waits)
+				// 边缘节点在第一个订阅者通过鉴权和准入后才从源站拉流
+				if s.Publisher == nil && len(EngineConfig.Origin.Nodes) > 0 && s.originPulling.CompareAndSwap(false, true) {
+					go func() {
+						pullFromOrigin(s.Path)
+						s.originPulling.Store(false)
+					}()
+				}
 				if s.Subscribers.Len() == 1 && s.State == STATE_WAITCLOSE {
 					s.action(ACTION_FIRSTENTER)
 				}
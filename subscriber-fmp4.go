@@ -0,0 +1,456 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+// FMP4Init fMP4 初始化分片（ftyp+moov）
+type FMP4Init []byte
+
+// FMP4Fragment fMP4 媒体分片（moof+mdat）
+type FMP4Fragment net.Buffers
+
+func (f FMP4Fragment) WriteTo(w io.Writer) (int64, error) {
+	t := (net.Buffers)(f)
+	return t.WriteTo(w)
+}
+
+var ErrMP4CodecNotSupport = errors.New("mp4 codec not support")
+
+// MP4VideoSampleEntry 根据视频轨道生成 stsd 采样条目，NALU 长度统一为4字节
+func MP4VideoSampleEntry(v *track.Video) (entry *codec.MP4SampleEntry, err error) {
+	entry = &codec.MP4SampleEntry{IsVideo: true, Width: uint16(v.Width), Height: uint16(v.Height)}
+	switch v.CodecID {
+	case codec.CodecID_H264:
+		if len(v.SequenceHead) < 10 {
+			return nil, ErrMP4CodecNotSupport
+		}
+		entry.Type, entry.ConfigType = "avc1", "avcC"
+		entry.Config = append([]byte(nil), v.SequenceHead[5:]...)
+		entry.Config[4] |= 0x03
+	case codec.CodecID_H265:
+		if len(v.SequenceHead) < 28 {
+			return nil, ErrMP4CodecNotSupport
+		}
+		entry.Type, entry.ConfigType = "hvc1", "hvcC"
+		entry.Config = append([]byte(nil), v.SequenceHead[5:]...)
+		entry.Config[21] |= 0x03
+	case codec.CodecID_AV1:
+		entry.Type, entry.ConfigType = "av01", "av1C"
+		if len(v.SequenceHead) > 5 && v.SequenceHead[5] == 0x81 {
+			entry.Config = append([]byte(nil), v.SequenceHead[5:]...)
+		} else if len(v.ParamaterSets) > 1 && len(v.ParamaterSets[1]) == 3 {
+			// 来自RTP的AV1只有序列头OBU，需要自行构造av1C
+			levelIdx, profile, tier := v.ParamaterSets[1][0], v.ParamaterSets[1][1], v.ParamaterSets[1][2]
+			entry.Config = append([]byte{0x81, profile<<5 | levelIdx&0x1F, tier << 7, 0}, v.ParamaterSets[0]...)
+		} else {
+			return nil, ErrMP4CodecNotSupport
+		}
+	default:
+		return nil, ErrMP4CodecNotSupport
+	}
+	return
+}
+
+// MP4AudioSampleEntry 根据音频轨道生成 stsd 采样条目
+func MP4AudioSampleEntry(a *track.Audio) (entry *codec.MP4SampleEntry, err error) {
+	entry = &codec.MP4SampleEntry{Channels: uint16(a.Channels), SampleSize: uint16(a.SampleSize), SampleRate: a.SampleRate}
+	if entry.SampleSize == 0 {
+		entry.SampleSize = 16
+	}
+	switch a.CodecID {
+	case codec.CodecID_AAC:
+		if len(a.SequenceHead) < 4 {
+			return nil, ErrMP4CodecNotSupport
+		}
+		entry.Type, entry.ConfigType = "mp4a", "esds"
+		entry.Config = codec.MakeESDS(codec.MP4_ESDS_OBJECT_TYPE_AAC, a.SequenceHead[2:])
+	case codec.CodecID_PCMA:
+		entry.Type = "alaw"
+	case codec.CodecID_PCMU:
+		entry.Type = "ulaw"
+	case codec.CodecID_OPUS:
+		entry.Type, entry.ConfigType = "Opus", "dOps"
+		entry.Config = codec.MakeDOps(a.Channels, 0, a.SampleRate)
+		entry.SampleRate = 48000
+	case codec.CodecID_L16:
+		entry.Type = "twos"
+	case codec.CodecID_L24:
+		entry.Type = "in24"
+	case codec.CodecID_AC3, codec.CodecID_EAC3:
+		ac3, ok := a.SpesificTrack.(*track.AC3)
+		if !ok || ac3.SyncFrame.SampleRate == 0 {
+			return nil, ErrMP4CodecNotSupport
+		}
+		if ac3.SyncFrame.EAC3 {
+			entry.Type, entry.ConfigType = "ec-3", "dec3"
+			entry.Config = ac3.SyncFrame.DEC3(ac3.Dependents...)
+		} else {
+			entry.Type, entry.ConfigType = "ac-3", "dac3"
+			entry.Config = ac3.SyncFrame.DAC3()
+		}
+	case codec.CodecID_MP3, codec.CodecID_MP2:
+		// 轨道的 SampleRate 是 RTP 时钟频率，实际采样率以帧头为准
+		mpa, ok := a.SpesificTrack.(*track.MPA)
+		if !ok || mpa.Header.SampleRate == 0 {
+			return nil, ErrMP4CodecNotSupport
+		}
+		entry.Type, entry.ConfigType = "mp4a", "esds"
+		entry.SampleRate = uint32(mpa.Header.SampleRate)
+		if entry.SampleRate >= 32000 {
+			entry.Config = codec.MakeESDS(codec.MP4_ESDS_OBJECT_TYPE_MPEG1_AUDIO, nil)
+		} else {
+			entry.Config = codec.MakeESDS(codec.MP4_ESDS_OBJECT_TYPE_MPEG2_AUDIO, nil)
+		}
+	default:
+		return nil, ErrMP4CodecNotSupport
+	}
+	return
+}
+
+// mp4VideoSample 将视频帧转换为mp4采样数据，H264/H265 的 NALU 前加4字节长度
+func mp4VideoSample(v *track.Video, frame *AVFrame) []byte {
+	size := frame.AUList.ByteLength
+	if v.CodecID != codec.CodecID_AV1 {
+		size += frame.AUList.Length * 4
+	}
+	data := make(util.Buffer, 0, size)
+	frame.AUList.Range(func(au *util.BLL) bool {
+		if v.CodecID != codec.CodecID_AV1 {
+			data.WriteUint32(uint32(au.ByteLength))
+		}
+		au.Range(func(b util.Buffer) bool {
+			data.Write(b)
+			return true
+		})
+		return true
+	})
+	return data
+}
+
+// mp4AudioSample 将音频帧转换为mp4采样数据
+func mp4AudioSample(frame *AVFrame) []byte {
+	return frame.AUList.ToBytes()
+}
+
+// mp4Timeline 将32位的90kHz时间戳累加为64位，处理时间戳回绕
+type mp4Timeline struct {
+	started bool
+	lastDTS uint32
+	dts     uint64
+}
+
+// next 返回以 timescale 为单位的累计时间
+func (t *mp4Timeline) next(dts uint32, timescale uint32) uint64 {
+	if t.started {
+		t.dts += uint64(dts - t.lastDTS)
+	} else {
+		t.dts, t.started = uint64(dts), true
+	}
+	t.lastDTS = dts
+	return t.dts * uint64(timescale) / 90000
+}
+
+type fmp4Sample struct {
+	data     []byte
+	dts      uint64 // 以 Timescale 为单位
+	cts      int32
+	duration uint32
+	sync     bool
+}
+
+// FMP4Track fMP4 中的一个轨道
+type FMP4Track struct {
+	*codec.MP4SampleEntry
+	ID        uint32
+	Timescale uint32
+	mp4Timeline
+	samples      []fmp4Sample
+	lastDuration uint32
+}
+
+func (t *FMP4Track) push(dts, pts uint32, data []byte, sync bool) {
+	sampleDTS := t.next(dts, t.Timescale)
+	if n := len(t.samples); n > 0 {
+		prev := &t.samples[n-1]
+		prev.duration = uint32(sampleDTS - prev.dts)
+		t.lastDuration = prev.duration
+	}
+	t.samples = append(t.samples, fmp4Sample{
+		data: data,
+		dts:  sampleDTS,
+		cts:  int32(int64(int32(pts-dts)) * int64(t.Timescale) / 90000),
+		sync: sync,
+	})
+}
+
+// duration 已缓存的采样的时长
+func (t *FMP4Track) duration() time.Duration {
+	if len(t.samples) == 0 || t.Timescale == 0 {
+		return 0
+	}
+	return time.Duration(t.samples[len(t.samples)-1].dts-t.samples[0].dts) * time.Second / time.Duration(t.Timescale)
+}
+
+// FMP4Muxer 将音视频帧封装为 fMP4（CMAF）格式，不依赖具体的传输方式
+type FMP4Muxer struct {
+	Video, Audio *FMP4Track
+	sequence     uint32
+}
+
+// SetVideo 设置视频轨道，返回的错误表示不支持该编码
+func (m *FMP4Muxer) SetVideo(v *track.Video) error {
+	entry, err := MP4VideoSampleEntry(v)
+	if err == nil {
+		m.Video = &FMP4Track{MP4SampleEntry: entry, ID: 1, Timescale: 90000}
+	}
+	return err
+}
+
+// SetAudio 设置音频轨道，返回的错误表示不支持该编码，采样率未知时时间刻度使用90kHz
+func (m *FMP4Muxer) SetAudio(a *track.Audio) error {
+	entry, err := MP4AudioSampleEntry(a)
+	if err == nil {
+		m.Audio = &FMP4Track{MP4SampleEntry: entry, ID: 2, Timescale: util.Conditoinal(entry.SampleRate > 0, entry.SampleRate, 90000)}
+	}
+	return err
+}
+
+func (m *FMP4Muxer) tracks() (tracks []*FMP4Track) {
+	if m.Video != nil {
+		tracks = append(tracks, m.Video)
+	}
+	if m.Audio != nil {
+		tracks = append(tracks, m.Audio)
+	}
+	return
+}
+
+// GetInitSegment 生成初始化分片
+func (m *FMP4Muxer) GetInitSegment() FMP4Init {
+	var b util.Buffer
+	codec.WriteMP4Ftyp(&b, "iso5", 512, "iso5", "iso6", "mp41", "cmfc")
+	codec.WriteMP4Box(&b, "moov", func() {
+		codec.WriteMP4Mvhd(&b, 1000, 0, 3)
+		var ids []uint32
+		for _, t := range m.tracks() {
+			codec.WriteMP4Trak(&b, &codec.MP4TrakInfo{MP4SampleEntry: t.MP4SampleEntry, TrackID: t.ID, Timescale: t.Timescale}, func() {
+				for _, name := range []string{"stts", "stsc", "stco"} {
+					codec.WriteMP4FullBox(&b, name, 0, 0, func() {
+						b.WriteUint32(0)
+					})
+				}
+				codec.WriteMP4FullBox(&b, "stsz", 0, 0, func() {
+					b.WriteUint32(0)
+					b.WriteUint32(0)
+				})
+			})
+			ids = append(ids, t.ID)
+		}
+		codec.WriteMP4Mvex(&b, ids...)
+	})
+	return FMP4Init(b)
+}
+
+// WriteVideo 缓存一个视频帧，dts、pts 以90kHz为单位
+func (m *FMP4Muxer) WriteVideo(frame VideoFrame) {
+	if m.Video != nil {
+		m.Video.push(frame.DTS, frame.PTS, mp4VideoSample(frame.Video, frame.AVFrame), frame.IFrame)
+	}
+}
+
+// WriteAudio 缓存一个音频帧
+func (m *FMP4Muxer) WriteAudio(frame AudioFrame) {
+	if m.Audio != nil {
+		m.Audio.push(frame.DTS, frame.DTS, mp4AudioSample(frame.AVFrame), true)
+	}
+}
+
+// Duration 当前缓存的媒体时长，有视频时以视频为准
+func (m *FMP4Muxer) Duration() time.Duration {
+	if m.Video != nil {
+		return m.Video.duration()
+	}
+	if m.Audio != nil {
+		return m.Audio.duration()
+	}
+	return 0
+}
+
+// Fragment 将缓存的采样输出为一个媒体分片，keepLastVideo 为 true 时保留最后一个视频帧（通常是新的关键帧）用于下一个分片
+func (m *FMP4Muxer) Fragment(keepLastVideo bool) (fragment FMP4Fragment) {
+	type trafSamples struct {
+		*FMP4Track
+		samples          []fmp4Sample
+		dataOffsetOffset int
+	}
+	var trafs []trafSamples
+	for _, t := range m.tracks() {
+		samples := t.samples
+		if keepLastVideo && t == m.Video && len(samples) > 0 {
+			samples = samples[:len(samples)-1]
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		// 最后一个采样的时长未知，沿用上一个采样的时长
+		if last := &samples[len(samples)-1]; last.duration == 0 {
+			last.duration = t.lastDuration
+		}
+		trafs = append(trafs, trafSamples{FMP4Track: t, samples: samples})
+	}
+	if len(trafs) == 0 {
+		return nil
+	}
+	m.sequence++
+	var moof util.Buffer
+	codec.WriteMP4Box(&moof, "moof", func() {
+		codec.WriteMP4FullBox(&moof, "mfhd", 0, 0, func() {
+			moof.WriteUint32(m.sequence)
+		})
+		for i := range trafs {
+			traf := &trafs[i]
+			codec.WriteMP4Box(&moof, "traf", func() {
+				codec.WriteMP4FullBox(&moof, "tfhd", 0, 0x020000, func() { // default-base-is-moof
+					moof.WriteUint32(traf.ID)
+				})
+				codec.WriteMP4FullBox(&moof, "tfdt", 1, 0, func() {
+					codec.WriteMP4Uint64(&moof, traf.samples[0].dts)
+				})
+				// data-offset | sample-duration | sample-size | sample-flags | sample-composition-time-offset
+				codec.WriteMP4FullBox(&moof, "trun", 1, 0x000F01, func() {
+					moof.WriteUint32(uint32(len(traf.samples)))
+					traf.dataOffsetOffset = moof.Len()
+					moof.WriteUint32(0)
+					for _, sample := range traf.samples {
+						moof.WriteUint32(sample.duration)
+						moof.WriteUint32(uint32(len(sample.data)))
+						if sample.sync {
+							moof.WriteUint32(codec.MP4_SAMPLE_FLAG_SYNC)
+						} else {
+							moof.WriteUint32(codec.MP4_SAMPLE_FLAG_NON_SYNC)
+						}
+						moof.WriteUint32(uint32(sample.cts))
+					}
+				})
+			})
+		}
+	})
+	mdat := make([]byte, 8)
+	fragment = FMP4Fragment{moof, mdat}
+	dataOffset := moof.Len() + 8
+	for _, traf := range trafs {
+		util.BigEndian.PutUint32(moof[traf.dataOffsetOffset:], uint32(dataOffset))
+		for _, sample := range traf.samples {
+			fragment = append(fragment, sample.data)
+			dataOffset += len(sample.data)
+		}
+		traf.FMP4Track.samples = traf.FMP4Track.samples[len(traf.samples):]
+	}
+	util.BigEndian.PutUint32(mdat, uint32(dataOffset-moof.Len()))
+	copy(mdat[4:], "mdat")
+	return
+}
+
+// FMP4Subscriber 以 fMP4 格式输出的订阅者，供 HLS-fMP4、DASH、MSE 等播放方式共用
+// 初始化分片和媒体分片分别以 FMP4Init 和 FMP4Fragment 事件发出，未处理时直接写入 Writer
+type FMP4Subscriber struct {
+	Subscriber
+	Muxer            FMP4Muxer
+	FragmentDuration time.Duration // 分片的最小时长，有视频时只在关键帧处切分，为0时每个关键帧切分（纯音频时为1秒）
+	initSent         bool
+}
+
+// PlayFMP4 阻塞式输出 fMP4
+func (s *FMP4Subscriber) PlayFMP4() {
+	s.PlayBlock(SUBTYPE_RAW)
+	s.flush(false)
+}
+
+func (s *FMP4Subscriber) flush(keepLastVideo bool) {
+	if fragment := s.Muxer.Fragment(keepLastVideo); fragment != nil {
+		s.Spesific.OnEvent(fragment)
+	}
+}
+
+// sendInit 发送初始化分片，解码器配置变化后需要重新发送
+func (s *FMP4Subscriber) sendInit() bool {
+	if s.initSent {
+		return true
+	}
+	if s.Video != nil && s.Muxer.Video == nil {
+		if err := s.Muxer.SetVideo(s.Video); err != nil {
+			s.Warn("fmp4 video", zap.String("codec", s.Video.CodecID.String()), zap.Error(err))
+		}
+	}
+	if s.Audio != nil && s.Muxer.Audio == nil {
+		if err := s.Muxer.SetAudio(s.Audio); err != nil {
+			s.Warn("fmp4 audio", zap.String("codec", s.Audio.CodecID.String()), zap.Error(err))
+		}
+	}
+	if s.Muxer.Video == nil && s.Muxer.Audio == nil {
+		s.Stop(zap.Error(ErrMP4CodecNotSupport))
+		return false
+	}
+	s.initSent = true
+	s.Spesific.OnEvent(s.Muxer.GetInitSegment())
+	return true
+}
+
+func (s *FMP4Subscriber) OnEvent(event any) {
+	switch v := event.(type) {
+	case VideoDeConf:
+		if s.Muxer.Video != nil {
+			if entry, err := MP4VideoSampleEntry(s.Video); err == nil && !bytes.Equal(entry.Config, s.Muxer.Video.Config) {
+				s.flush(false)
+				s.Muxer.SetVideo(s.Video)
+				s.initSent = false
+			}
+		}
+	case AudioDeConf:
+		if s.Muxer.Audio != nil {
+			if entry, err := MP4AudioSampleEntry(s.Audio); err == nil && !bytes.Equal(entry.Config, s.Muxer.Audio.Config) {
+				s.flush(false)
+				s.Muxer.SetAudio(s.Audio)
+				s.initSent = false
+			}
+		}
+	case VideoFrame:
+		if !s.sendInit() || s.Muxer.Video == nil {
+			return
+		}
+		s.Muxer.WriteVideo(v)
+		// 每个分片都从关键帧开始，达到分片时长后在下一个关键帧处切分
+		if v.IFrame && s.Muxer.Duration() >= s.FragmentDuration {
+			s.flush(true)
+		}
+	case AudioFrame:
+		if !s.sendInit() || s.Muxer.Audio == nil {
+			return
+		}
+		s.Muxer.WriteAudio(v)
+		if s.Muxer.Video == nil && s.Muxer.Duration() >= util.Conditoinal(s.FragmentDuration > 0, s.FragmentDuration, time.Second) {
+			s.flush(false)
+		}
+	case FMP4Init:
+		if s.Writer != nil {
+			s.Writer.Write(v)
+		}
+	case FMP4Fragment:
+		if s.Writer != nil {
+			v.WriteTo(s.Writer)
+		}
+	default:
+		s.Subscriber.OnEvent(event)
+	}
+}
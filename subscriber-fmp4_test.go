@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/codec"
+)
+
+// splitMP4Boxes 按顺序列出同一层级的 box，返回类型和内容（不含头部）
+func splitMP4Boxes(data []byte) (types []string, bodies [][]byte) {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			return
+		}
+		types = append(types, string(data[4:8]))
+		bodies = append(bodies, data[8:size])
+		data = data[size:]
+	}
+	return
+}
+
+func TestFMP4InitSegment(t *testing.T) {
+	var m FMP4Muxer
+	if err := m.SetVideo(testH264(testSPS[0])); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetAudio(testAAC()); err != nil {
+		t.Fatal(err)
+	}
+	init := m.GetInitSegment()
+	types, bodies := splitMP4Boxes(init)
+	if len(types) != 2 || types[0] != "ftyp" || types[1] != "moov" {
+		t.Fatalf("top level boxes %v", types)
+	}
+	if string(bodies[0][:4]) != "iso5" {
+		t.Fatalf("major brand %s", bodies[0][:4])
+	}
+	types, bodies = splitMP4Boxes(bodies[1])
+	var traks int
+	var mvex []byte
+	for i, typ := range types {
+		switch typ {
+		case "trak":
+			traks++
+			// 空的采样表，所有采样都在 moof 中描述
+			stbl := findMP4Box(bodies[i], "mdia", "minf", "stbl")
+			for _, name := range []string{"stts", "stsc", "stco", "stsz"} {
+				if box := findMP4Box(stbl, name); box == nil || binary.BigEndian.Uint32(box[4:]) != 0 {
+					t.Errorf("trak %d %s %x", traks, name, box)
+				}
+			}
+		case "mvex":
+			mvex = bodies[i]
+		}
+	}
+	if traks != 2 || mvex == nil {
+		t.Fatalf("moov boxes %v", types)
+	}
+	if avcC := findMP4Box(init, "moov", "trak", "mdia", "minf", "stbl", "stsd", "avc1", "avcC"); avcC == nil || avcC[4] != 0xFF {
+		t.Fatalf("avcC %x", avcC)
+	}
+	types, bodies = splitMP4Boxes(mvex)
+	if len(types) != 2 || types[0] != "trex" || types[1] != "trex" {
+		t.Fatalf("mvex boxes %v", types)
+	}
+	for i, body := range bodies {
+		if id := binary.BigEndian.Uint32(body[4:]); id != uint32(i+1) {
+			t.Errorf("trex %d track_ID %d", i, id)
+		}
+	}
+}
+
+func TestFMP4Fragment(t *testing.T) {
+	var m FMP4Muxer
+	v, a := testH264(testSPS[0]), testAAC()
+	m.SetVideo(v)
+	m.SetAudio(a)
+	for i := 0; i < 3; i++ {
+		dts := uint32(i * 3600)
+		key := i != 1
+		nalu := []byte{0x41, byte(i)}
+		if key {
+			nalu[0] = 0x65
+		}
+		m.WriteVideo(VideoFrame{AVFrame: testAVFrame(key, nalu), Video: v, DTS: dts, PTS: dts + 3600})
+		m.WriteAudio(AudioFrame{AVFrame: testAVFrame(true, []byte{0x21, byte(i), 0}), Audio: a, DTS: dts})
+	}
+	var data bytes.Buffer
+	if _, err := m.Fragment(true).WriteTo(&data); err != nil {
+		t.Fatal(err)
+	}
+	fragment := data.Bytes()
+	types, bodies := splitMP4Boxes(fragment)
+	if len(types) != 2 || types[0] != "moof" || types[1] != "mdat" {
+		t.Fatalf("fragment boxes %v", types)
+	}
+	moofSize := 8 + len(bodies[0])
+	mdat := bodies[1]
+	// 保留最后一个视频帧，两个视频采样各 4+2 字节，三个音频采样各 3 字节
+	if len(mdat) != 2*6+3*3 {
+		t.Fatalf("mdat size %d", len(mdat))
+	}
+	types, bodies = splitMP4Boxes(bodies[0])
+	if len(types) != 3 || types[0] != "mfhd" || types[1] != "traf" || types[2] != "traf" {
+		t.Fatalf("moof boxes %v", types)
+	}
+	if seq := binary.BigEndian.Uint32(bodies[0][4:]); seq != 1 {
+		t.Fatalf("sequence %d", seq)
+	}
+	for i, tt := range []struct {
+		id       uint32
+		dts      uint64
+		samples  int
+		size     int
+		duration uint32
+		cts      uint32
+		flags    []uint32
+	}{
+		{1, 0, 2, 6, 3600, 3600, []uint32{codec.MP4_SAMPLE_FLAG_SYNC, codec.MP4_SAMPLE_FLAG_NON_SYNC}},
+		{2, 0, 3, 3, 1764, 0, []uint32{codec.MP4_SAMPLE_FLAG_SYNC, codec.MP4_SAMPLE_FLAG_SYNC, codec.MP4_SAMPLE_FLAG_SYNC}},
+	} {
+		traf := bodies[i+1]
+		tfhd := findMP4Box(traf, "tfhd")
+		if flags := binary.BigEndian.Uint32(tfhd) & 0xFFFFFF; flags != 0x020000 {
+			t.Errorf("track %d tfhd flags %x", tt.id, flags)
+		}
+		if id := binary.BigEndian.Uint32(tfhd[4:]); id != tt.id {
+			t.Errorf("traf %d track_ID %d", i, id)
+		}
+		tfdt := findMP4Box(traf, "tfdt")
+		if tfdt[0] != 1 || binary.BigEndian.Uint64(tfdt[4:]) != tt.dts {
+			t.Errorf("track %d tfdt %x", tt.id, tfdt)
+		}
+		trun := findMP4Box(traf, "trun")
+		if vf := binary.BigEndian.Uint32(trun); vf != 0x01000F01 {
+			t.Errorf("track %d trun version and flags %x", tt.id, vf)
+		}
+		n := int(binary.BigEndian.Uint32(trun[4:]))
+		if n != tt.samples || len(trun) != 12+16*n {
+			t.Fatalf("track %d trun samples %d size %d", tt.id, n, len(trun))
+		}
+		// data_offset 相对于 moof 起始位置，指向该轨道第一个采样
+		offset := int(binary.BigEndian.Uint32(trun[8:])) - moofSize - 8
+		if tt.id == 1 && offset != 0 || tt.id == 2 && offset != 2*6 {
+			t.Errorf("track %d data_offset %d", tt.id, offset)
+		}
+		for j := 0; j < n; j++ {
+			entry := trun[12+16*j:]
+			duration, size, flags, cts := binary.BigEndian.Uint32(entry), binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:]), binary.BigEndian.Uint32(entry[12:])
+			if duration != tt.duration || size != uint32(tt.size) || flags != tt.flags[j] || cts != tt.cts {
+				t.Errorf("track %d sample %d: duration %d size %d flags %x cts %d", tt.id, j, duration, size, flags, cts)
+			}
+			if tt.id == 1 && mdat[offset+j*tt.size+5] != byte(j) {
+				t.Errorf("sample %d data %x", j, mdat[offset+j*tt.size:offset+(j+1)*tt.size])
+			}
+		}
+	}
+	if len(m.Video.samples) != 1 || !m.Video.samples[0].sync || len(m.Audio.samples) != 0 {
+		t.Fatalf("remaining samples video %d audio %d", len(m.Video.samples), len(m.Audio.samples))
+	}
+	data.Reset()
+	m.Fragment(false).WriteTo(&data)
+	moof := findMP4Box(data.Bytes(), "moof")
+	if seq := binary.BigEndian.Uint32(findMP4Box(moof, "mfhd")[4:]); seq != 2 {
+		t.Fatalf("next sequence %d", seq)
+	}
+	if dts := binary.BigEndian.Uint64(findMP4Box(moof, "traf", "tfdt")[4:]); dts != 7200 {
+		t.Fatalf("next tfdt %d", dts)
+	}
+}
+
+func TestFMP4KeyFrameFragments(t *testing.T) {
+	var s FMP4Subscriber
+	var out bytes.Buffer
+	s.Writer, s.Spesific = &out, &s
+	s.Video = testH264(testSPS[0])
+	s.FragmentDuration = time.Second
+	// 每秒25帧，每10帧一个关键帧
+	for i := 0; i < 100; i++ {
+		dts := uint32(i * 3600)
+		key := i%10 == 0
+		nalu := []byte{0x41, byte(i)}
+		if key {
+			nalu[0] = 0x65
+		}
+		s.OnEvent(VideoFrame{AVFrame: testAVFrame(key, nalu), Video: s.Video, DTS: dts, PTS: dts})
+	}
+	types, bodies := splitMP4Boxes(out.Bytes())
+	var fragments int
+	for i, typ := range types {
+		if typ != "moof" {
+			continue
+		}
+		fragments++
+		trun := findMP4Box(bodies[i], "traf", "trun")
+		n := int(binary.BigEndian.Uint32(trun[4:]))
+		// 分片从关键帧开始，并且至少包含 FragmentDuration 的采样
+		if flags := binary.BigEndian.Uint32(trun[12+8:]); flags != codec.MP4_SAMPLE_FLAG_SYNC {
+			t.Errorf("fragment %d starts with sample flags %x", fragments, flags)
+		}
+		if n < 25 || n%10 != 0 {
+			t.Errorf("fragment %d has %d samples", fragments, n)
+		}
+	}
+	if fragments < 2 {
+		t.Fatalf("fragments %d", fragments)
+	}
+}
+
+func TestFMP4TrackZeroTimescale(t *testing.T) {
+	track := FMP4Track{}
+	track.push(0, 0, []byte{1}, true)
+	track.push(3600, 3600, []byte{2}, true)
+	if d := track.duration(); d != 0 {
+		t.Fatalf("duration %v", d)
+	}
+}
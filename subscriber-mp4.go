@@ -0,0 +1,447 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+const mp4MovieTimescale = 1000
+
+var ErrMP4NoSample = errors.New("mp4 no sample")
+
+type mp4Sample struct {
+	dts  uint64 // 以 Timescale 为单位
+	cts  int32
+	size uint32
+}
+
+type mp4Chunk struct {
+	offset uint64
+	count  uint32
+	entry  uint32 // sample_description_index，从1开始
+}
+
+// MP4Track 普通 MP4 中的一个轨道，采样表在内存中累积，结束时写入 moov
+type MP4Track struct {
+	*codec.MP4SampleEntry
+	entries   []*codec.MP4SampleEntry // 解码器配置变化后追加新的采样条目，之后的 chunk 引用新的条目
+	ID        uint32
+	Timescale uint32
+	mp4Timeline
+	samples []mp4Sample
+	syncs   []uint32 // 关键帧的采样序号，从1开始
+	chunks  []mp4Chunk
+}
+
+func (t *MP4Track) duration(i int) uint32 {
+	if i+1 < len(t.samples) {
+		return uint32(t.samples[i+1].dts - t.samples[i].dts)
+	}
+	if i > 0 {
+		return uint32(t.samples[i].dts - t.samples[i-1].dts)
+	}
+	return 0
+}
+
+// mediaDuration 轨道时长，以 Timescale 为单位
+func (t *MP4Track) mediaDuration() uint64 {
+	last := len(t.samples) - 1
+	return t.samples[last].dts - t.samples[0].dts + uint64(t.duration(last))
+}
+
+// writeSampleTables 写入 stts、ctts、stss、stsc、stsz、stco/co64，shift 为 faststart 时 mdat 的偏移量
+func (t *MP4Track) writeSampleTables(b *util.Buffer, shift uint64) {
+	type entry struct {
+		count uint32
+		value uint32
+	}
+	runLength := func(n int, value func(int) uint32) (entries []entry) {
+		for i := 0; i < n; i++ {
+			v := value(i)
+			if l := len(entries); l > 0 && entries[l-1].value == v {
+				entries[l-1].count++
+			} else {
+				entries = append(entries, entry{1, v})
+			}
+		}
+		return
+	}
+	writeEntries := func(entries []entry) {
+		b.WriteUint32(uint32(len(entries)))
+		for _, e := range entries {
+			b.WriteUint32(e.count)
+			b.WriteUint32(e.value)
+		}
+	}
+	codec.WriteMP4FullBox(b, "stts", 0, 0, func() {
+		writeEntries(runLength(len(t.samples), t.duration))
+	})
+	var hasCTS, negativeCTS bool
+	for _, s := range t.samples {
+		hasCTS = hasCTS || s.cts != 0
+		negativeCTS = negativeCTS || s.cts < 0
+	}
+	if hasCTS {
+		codec.WriteMP4FullBox(b, "ctts", util.Conditoinal[byte](negativeCTS, 1, 0), 0, func() {
+			writeEntries(runLength(len(t.samples), func(i int) uint32 {
+				return uint32(t.samples[i].cts)
+			}))
+		})
+	}
+	if t.IsVideo && len(t.syncs) < len(t.samples) {
+		codec.WriteMP4FullBox(b, "stss", 0, 0, func() {
+			b.WriteUint32(uint32(len(t.syncs)))
+			for _, n := range t.syncs {
+				b.WriteUint32(n)
+			}
+		})
+	}
+	codec.WriteMP4FullBox(b, "stsc", 0, 0, func() {
+		type stscEntry struct {
+			first, count, entry uint32
+		}
+		var entries []stscEntry
+		for i, c := range t.chunks {
+			if l := len(entries); l == 0 || entries[l-1].count != c.count || entries[l-1].entry != c.entry {
+				entries = append(entries, stscEntry{uint32(i + 1), c.count, c.entry})
+			}
+		}
+		b.WriteUint32(uint32(len(entries)))
+		for _, e := range entries {
+			b.WriteUint32(e.first) // first_chunk
+			b.WriteUint32(e.count) // samples_per_chunk
+			b.WriteUint32(e.entry) // sample_description_index
+		}
+	})
+	codec.WriteMP4FullBox(b, "stsz", 0, 0, func() {
+		b.WriteUint32(0)
+		b.WriteUint32(uint32(len(t.samples)))
+		for _, s := range t.samples {
+			b.WriteUint32(s.size)
+		}
+	})
+	if t.chunks[len(t.chunks)-1].offset+shift > math.MaxUint32 {
+		codec.WriteMP4FullBox(b, "co64", 0, 0, func() {
+			b.WriteUint32(uint32(len(t.chunks)))
+			for _, c := range t.chunks {
+				codec.WriteMP4Uint64(b, c.offset+shift)
+			}
+		})
+	} else {
+		codec.WriteMP4FullBox(b, "stco", 0, 0, func() {
+			b.WriteUint32(uint32(len(t.chunks)))
+			for _, c := range t.chunks {
+				b.WriteUint32(uint32(c.offset + shift))
+			}
+		})
+	}
+}
+
+// MP4Muxer 将音视频帧封装为普通 MP4 文件，媒体数据边写边落盘，moov 在 Close 时写入文件末尾
+type MP4Muxer struct {
+	io.WriteSeeker `json:"-" yaml:"-"`
+	Video, Audio   *MP4Track
+	ftyp           util.Buffer
+	mdatStart      uint64 // free+mdat 头部的位置，共16字节，mdat 超过4GB时整体作为 largesize 的 mdat 头部
+	offset         uint64 // 当前写入位置
+	lastTrack      *MP4Track
+}
+
+// Start 写入 ftyp 以及 mdat 头部的占位
+func (m *MP4Muxer) Start(w io.WriteSeeker) (err error) {
+	m.WriteSeeker = w
+	m.ftyp = nil
+	codec.WriteMP4Ftyp(&m.ftyp, "isom", 512, "isom", "iso2", "avc1", "mp41")
+	m.mdatStart = uint64(m.ftyp.Len())
+	if _, err = w.Write(m.ftyp); err == nil {
+		_, err = w.Write(make([]byte, 16))
+	}
+	m.offset = m.mdatStart + 16
+	return
+}
+
+// SetVideo 设置视频轨道，已经设置过时追加新的采样条目，用于解码器配置变化，返回的错误表示不支持该编码
+func (m *MP4Muxer) SetVideo(v *track.Video) error {
+	entry, err := MP4VideoSampleEntry(v)
+	if err == nil {
+		if m.Video == nil {
+			m.Video = &MP4Track{MP4SampleEntry: entry, ID: 1, Timescale: 90000}
+		}
+		m.addEntry(m.Video, entry)
+	}
+	return err
+}
+
+// SetAudio 设置音频轨道，已经设置过时追加新的采样条目，用于解码器配置变化，返回的错误表示不支持该编码
+// 时间刻度为采样率，采样率变化时换算已经写入的采样，采样率未知时使用90kHz
+func (m *MP4Muxer) SetAudio(a *track.Audio) error {
+	entry, err := MP4AudioSampleEntry(a)
+	if err == nil {
+		if m.Audio == nil {
+			m.Audio = &MP4Track{MP4SampleEntry: entry, ID: 2, Timescale: util.Conditoinal(entry.SampleRate > 0, entry.SampleRate, 90000)}
+		} else if entry.SampleRate > 0 && entry.SampleRate != m.Audio.Timescale {
+			m.Audio.rescale(entry.SampleRate)
+		}
+		m.addEntry(m.Audio, entry)
+	}
+	return err
+}
+
+// rescale 换算已经写入的采样的时间
+func (t *MP4Track) rescale(timescale uint32) {
+	for i := range t.samples {
+		sample := &t.samples[i]
+		sample.dts = sample.dts * uint64(timescale) / uint64(t.Timescale)
+		sample.cts = int32(int64(sample.cts) * int64(timescale) / int64(t.Timescale))
+	}
+	t.Timescale = timescale
+}
+
+// sameMP4Entry 解码器配置没有变化时不需要新的采样条目
+func sameMP4Entry(a, b *codec.MP4SampleEntry) bool {
+	return a.Type == b.Type && a.ConfigType == b.ConfigType && bytes.Equal(a.Config, b.Config) &&
+		a.Width == b.Width && a.Height == b.Height && a.Channels == b.Channels && a.SampleSize == b.SampleSize && a.SampleRate == b.SampleRate
+}
+
+// addEntry 之后的采样写入新的 chunk，以便引用新的采样条目，和最后一个采样条目相同时不追加
+func (m *MP4Muxer) addEntry(t *MP4Track, entry *codec.MP4SampleEntry) {
+	if n := len(t.entries); n > 0 && sameMP4Entry(t.entries[n-1], entry) {
+		return
+	}
+	t.entries = append(t.entries, entry)
+	if m.lastTrack == t {
+		m.lastTrack = nil
+	}
+}
+
+func (m *MP4Muxer) tracks() (tracks []*MP4Track) {
+	if m.Video != nil && len(m.Video.samples) > 0 {
+		tracks = append(tracks, m.Video)
+	}
+	if m.Audio != nil && len(m.Audio.samples) > 0 {
+		tracks = append(tracks, m.Audio)
+	}
+	return
+}
+
+func (m *MP4Muxer) writeSample(t *MP4Track, dts, pts uint32, data []byte, sync bool) (err error) {
+	if _, err = m.Write(data); err != nil {
+		return
+	}
+	if m.lastTrack == t {
+		t.chunks[len(t.chunks)-1].count++
+	} else {
+		t.chunks = append(t.chunks, mp4Chunk{m.offset, 1, uint32(len(t.entries))})
+		m.lastTrack = t
+	}
+	m.offset += uint64(len(data))
+	t.samples = append(t.samples, mp4Sample{
+		dts:  t.next(dts, t.Timescale),
+		cts:  int32(int64(int32(pts-dts)) * int64(t.Timescale) / 90000),
+		size: uint32(len(data)),
+	})
+	if sync {
+		t.syncs = append(t.syncs, uint32(len(t.samples)))
+	}
+	return
+}
+
+// WriteVideo 写入一个视频帧
+func (m *MP4Muxer) WriteVideo(frame VideoFrame) error {
+	if m.Video == nil {
+		return nil
+	}
+	return m.writeSample(m.Video, frame.DTS, frame.PTS, mp4VideoSample(frame.Video, frame.AVFrame), frame.IFrame)
+}
+
+// WriteAudio 写入一个音频帧
+func (m *MP4Muxer) WriteAudio(frame AudioFrame) error {
+	if m.Audio == nil {
+		return nil
+	}
+	return m.writeSample(m.Audio, frame.DTS, frame.DTS, mp4AudioSample(frame.AVFrame), true)
+}
+
+// writeMoov 生成 moov，shift 为所有 chunk 偏移需要增加的量
+func (m *MP4Muxer) writeMoov(shift uint64) (moov util.Buffer) {
+	tracks := m.tracks()
+	// 以最早开始的轨道为影片起点，晚开始的轨道用空编辑补齐
+	start := uint64(math.MaxUint64)
+	for _, t := range tracks {
+		if first := t.samples[0].dts * mp4MovieTimescale / uint64(t.Timescale); first < start {
+			start = first
+		}
+	}
+	infos := make([]codec.MP4TrakInfo, len(tracks))
+	var movieDuration uint64
+	for i, t := range tracks {
+		info := &infos[i]
+		info.MP4SampleEntry, info.Entries, info.TrackID, info.Timescale = t.MP4SampleEntry, t.entries, t.ID, t.Timescale
+		info.MediaDuration = t.mediaDuration()
+		info.EmptyDuration = t.samples[0].dts*mp4MovieTimescale/uint64(t.Timescale) - start
+		info.MovieDuration = info.EmptyDuration + info.MediaDuration*mp4MovieTimescale/uint64(t.Timescale)
+		if info.MovieDuration > movieDuration {
+			movieDuration = info.MovieDuration
+		}
+	}
+	codec.WriteMP4Box(&moov, "moov", func() {
+		codec.WriteMP4Mvhd(&moov, mp4MovieTimescale, movieDuration, 3)
+		for i, t := range tracks {
+			codec.WriteMP4Trak(&moov, &infos[i], func() {
+				t.writeSampleTables(&moov, shift)
+			})
+		}
+	})
+	return
+}
+
+// Close 回填 mdat 大小并在文件末尾写入 moov
+func (m *MP4Muxer) Close() (err error) {
+	if len(m.tracks()) == 0 {
+		return ErrMP4NoSample
+	}
+	mdatSize := m.offset - m.mdatStart - 8
+	header := make([]byte, 16)
+	if mdatSize > math.MaxUint32 {
+		// 使用 largesize，16字节全部作为 mdat 头部
+		util.PutBE(header[0:4], 1)
+		copy(header[4:8], "mdat")
+		util.PutBE(header[8:16], mdatSize+8)
+	} else {
+		util.PutBE(header[0:4], 8)
+		copy(header[4:8], "free")
+		util.PutBE(header[8:12], mdatSize)
+		copy(header[12:16], "mdat")
+	}
+	if _, err = m.Seek(int64(m.mdatStart), io.SeekStart); err != nil {
+		return
+	}
+	if _, err = m.Write(header); err != nil {
+		return
+	}
+	if _, err = m.Seek(int64(m.offset), io.SeekStart); err != nil {
+		return
+	}
+	_, err = m.Write(m.writeMoov(0))
+	return
+}
+
+// FastStart 将 Close 后的文件 src 重新组织为 moov 在前的文件写入 dst，便于边下载边播放
+func (m *MP4Muxer) FastStart(src io.ReadSeeker, dst io.Writer) (err error) {
+	// moov 的大小可能因为 stco 变为 co64 而改变，需要重新计算直到稳定
+	moov := m.writeMoov(0)
+	for size := 0; size != moov.Len(); {
+		size = moov.Len()
+		moov = m.writeMoov(uint64(size))
+	}
+	if _, err = dst.Write(m.ftyp); err != nil {
+		return
+	}
+	if _, err = dst.Write(moov); err != nil {
+		return
+	}
+	if _, err = src.Seek(int64(m.mdatStart), io.SeekStart); err != nil {
+		return
+	}
+	_, err = io.CopyN(dst, src, int64(m.offset-m.mdatStart))
+	return
+}
+
+// MP4Subscriber 将流录制为普通 MP4 文件的订阅者，录制的文件可以通过 /api/replay/mp4 回放
+type MP4Subscriber struct {
+	Subscriber
+	Muxer     MP4Muxer
+	FastStart bool // 录制结束后将 moov 移至文件头部
+	skipVideo bool
+	skipAudio bool
+	videoSeq  int // 写入采样条目时的 SequenceHeadSeq
+	audioSeq  int
+}
+
+// Record 阻塞式录制到指定文件，直到订阅结束
+func (s *MP4Subscriber) Record(filePath string) (err error) {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return
+	}
+	if err = s.Muxer.Start(file); err != nil {
+		file.Close()
+		return
+	}
+	s.PlayBlock(SUBTYPE_RAW)
+	err = s.Muxer.Close()
+	file.Close()
+	if err != nil || !s.FastStart {
+		return
+	}
+	return s.fastStart(filePath)
+}
+
+func (s *MP4Subscriber) fastStart(filePath string) (err error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	tmpPath := filePath + ".faststart"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return
+	}
+	if err = s.Muxer.FastStart(src, dst); err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	} else {
+		os.Remove(tmpPath)
+	}
+	return
+}
+
+func (s *MP4Subscriber) OnEvent(event any) {
+	var err error
+	switch v := event.(type) {
+	case VideoFrame:
+		if s.skipVideo {
+			return
+		}
+		if s.Muxer.Video == nil || (v.IFrame && s.videoSeq != v.Video.SequenceHeadSeq) {
+			s.videoSeq = v.Video.SequenceHeadSeq
+			if err = s.Muxer.SetVideo(v.Video); err != nil {
+				s.Warn("mp4 video", zap.String("codec", v.Video.CodecID.String()), zap.Error(err))
+				s.skipVideo = true
+				return
+			}
+		}
+		err = s.Muxer.WriteVideo(v)
+	case AudioFrame:
+		if s.skipAudio {
+			return
+		}
+		if s.Muxer.Audio == nil || s.audioSeq != v.Audio.SequenceHeadSeq {
+			s.audioSeq = v.Audio.SequenceHeadSeq
+			if err = s.Muxer.SetAudio(v.Audio); err != nil {
+				s.Warn("mp4 audio", zap.String("codec", v.Audio.CodecID.String()), zap.Error(err))
+				s.skipAudio = true
+				return
+			}
+		}
+		err = s.Muxer.WriteAudio(v)
+	default:
+		s.Subscriber.OnEvent(event)
+	}
+	if err != nil {
+		s.Stop(zap.Error(err))
+	}
+}
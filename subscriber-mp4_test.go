@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+var (
+	// 352x288 和 1280x720 的 H264 SPS
+	testSPS = [][]byte{
+		{0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0, 0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00, 0x00, 0x03, 0x00, 0x3d, 0x08},
+		{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x6c, 0x80, 0x00, 0x00, 0x03, 0x00, 0x80, 0x00, 0x00, 0x1e, 0x07, 0x8c, 0x18, 0xcb},
+	}
+	testPPS        = []byte{0x68, 0xeb, 0xec, 0xb2, 0x2c}
+	testEngineOnce sync.Once
+)
+
+// setupTestEngine 初始化发布和订阅所需的全局状态
+func setupTestEngine() {
+	testEngineOnce.Do(func() {
+		var logger log.Logger
+		log.LocaleLogger = logger.Lang(nil)
+		Engine.Logger = log.LocaleLogger.Named("engine")
+		Engine.Context = context.Background()
+		EventBus = make(chan any, 100)
+		go func() {
+			for range EventBus {
+			}
+		}()
+	})
+}
+
+// testH264 构造带有 AVCDecoderConfigurationRecord 的 H264 视频轨道
+func testH264(sps []byte) *track.Video {
+	v := &track.Video{}
+	v.CodecID = codec.CodecID_H264
+	v.SequenceHead = append([]byte{0x17, 0, 0, 0, 0, 1, sps[1], sps[2], sps[3], 0xFF, 0xE1, 0, byte(len(sps))}, sps...)
+	v.SequenceHead = append(v.SequenceHead, 1, 0, byte(len(testPPS)))
+	v.SequenceHead = append(v.SequenceHead, testPPS...)
+	info, _ := codec.ParseSPS(sps)
+	v.Width, v.Height = uint(info.Width), uint(info.Height)
+	return v
+}
+
+func testAAC() *track.Audio {
+	a := &track.Audio{}
+	a.CodecID = codec.CodecID_AAC
+	a.SampleRate, a.Channels, a.SampleSize = 44100, 2, 16
+	a.SequenceHead = []byte{0xAF, 0x00, 0x12, 0x10} // AAC LC 44100Hz 双声道
+	return a
+}
+
+func testAVFrame(keyFrame bool, payload ...[]byte) *AVFrame {
+	frame := &AVFrame{}
+	frame.IFrame = keyFrame
+	for _, p := range payload {
+		var au util.BLL
+		au.Push(&util.ListItem[util.Buffer]{Value: p})
+		frame.AUList.PushValue(&au)
+	}
+	return frame
+}
+
+// writeTestMP4 写入 frames 个视频帧（每秒25帧，每25帧一个关键帧）和对应的音频帧，videos 依次作为每一段的视频轨道
+func writeTestMP4(t *testing.T, m *MP4Muxer, frames int, videos ...*track.Video) {
+	a := testAAC()
+	if err := m.SetAudio(a); err != nil {
+		t.Fatal(err)
+	}
+	segment := frames / len(videos)
+	for i := 0; i < frames; i++ {
+		dts := uint32(i * 3600)
+		if i%segment == 0 {
+			if err := m.SetVideo(videos[i/segment]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		key := i%25 == 0
+		nalu := []byte{0x41, byte(i), 0x80}
+		if key {
+			nalu[0] = 0x65
+		}
+		if err := m.WriteVideo(VideoFrame{AVFrame: testAVFrame(key, nalu), Video: videos[i/segment], DTS: dts, PTS: dts + 3600}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.WriteAudio(AudioFrame{AVFrame: testAVFrame(true, []byte{0x21, byte(i), 0x00, 0x00}), Audio: a, DTS: dts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// findMP4Box 按路径查找 box，返回 box 的内容（不含头部）
+func findMP4Box(data []byte, path ...string) []byte {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			return nil
+		}
+		if string(data[4:8]) == path[0] {
+			body := data[8:size]
+			if len(path) == 1 {
+				return body
+			}
+			switch path[0] {
+			case "stsd":
+				body = body[8:] // version/flags + entry_count
+			case "avc1":
+				body = body[78:] // VisualSampleEntry 的固定部分
+			}
+			return findMP4Box(body, path[1:]...)
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func TestMP4RoundTrip(t *testing.T) {
+	setupTestEngine()
+	for _, fastStart := range []bool{false, true} {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "test.mp4")
+		file, err := os.Create(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m MP4Muxer
+		if err = m.Start(file); err != nil {
+			t.Fatal(err)
+		}
+		writeTestMP4(t, &m, 100, testH264(testSPS[0]))
+		if err = m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		if fastStart {
+			src, _ := os.Open(filePath)
+			dst, _ := os.Create(filePath + ".faststart")
+			if err = m.FastStart(src, dst); err != nil {
+				t.Fatal(err)
+			}
+			src.Close()
+			dst.Close()
+			filePath += ".faststart"
+		}
+
+		var pub MP4Publisher
+		pub.Config = &config.Publish{PubVideo: true, PubAudio: true, PublishTimeout: 10 * time.Second}
+		pub.Replay.Speed = 1e6
+		streamPath := "test/mp4roundtrip" + util.Conditoinal(fastStart, "faststart", "")
+		if err = pub.Publish(streamPath, &pub); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = pub.ReadMP4Data(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vt, ok := pub.VideoTrack.(*track.H264)
+		if !ok {
+			t.Fatalf("faststart %v: video track %T", fastStart, pub.VideoTrack)
+		}
+		if vt.SPSInfo.Width != 352 || vt.SPSInfo.Height != 288 {
+			t.Errorf("faststart %v: video size %dx%d", fastStart, vt.SPSInfo.Width, vt.SPSInfo.Height)
+		}
+		// 第一帧作为序列头之后的第一帧，之后每帧递增
+		if seq := vt.LastValue.Sequence; seq < 99 {
+			t.Errorf("faststart %v: video frames %d", fastStart, seq)
+		}
+		at, ok := pub.AudioTrack.(*track.AAC)
+		if !ok {
+			t.Fatalf("faststart %v: audio track %T", fastStart, pub.AudioTrack)
+		}
+		if at.SampleRate != 44100 || at.Channels != 2 {
+			t.Errorf("faststart %v: audio %d %d", fastStart, at.SampleRate, at.Channels)
+		}
+	}
+}
+
+func TestMP4SequenceHeadChange(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "test.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var m MP4Muxer
+	if err = m.Start(file); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMP4(t, &m, 100, testH264(testSPS[0]), testH264(testSPS[1]))
+	moov := m.writeMoov(0)
+	stbl := findMP4Box(moov, "moov", "trak", "mdia", "minf", "stbl")
+	stsd := findMP4Box(stbl, "stsd")
+	if n := binary.BigEndian.Uint32(stsd[4:]); n != 2 {
+		t.Fatalf("stsd entry count %d", n)
+	}
+	// 两个采样条目分别带有各自的 SPS
+	first := findMP4Box(stbl, "stsd", "avc1", "avcC")
+	if first == nil || first[3] != testSPS[0][3] {
+		t.Fatalf("first avcC %x", first)
+	}
+	second := findMP4Box(stsd[8+binary.BigEndian.Uint32(stsd[8:]):], "avc1")
+	if second == nil || binary.BigEndian.Uint16(second[24:]) != 1280 || binary.BigEndian.Uint16(second[26:]) != 720 {
+		t.Fatalf("second avc1 %x", second)
+	}
+	// 配置变化之后的 chunk 引用第二个采样条目
+	stsc := findMP4Box(stbl, "stsc")
+	n := int(binary.BigEndian.Uint32(stsc[4:]))
+	var indexes []uint32
+	for i := 0; i < n; i++ {
+		entry := stsc[8+i*12:]
+		indexes = append(indexes, binary.BigEndian.Uint32(entry[8:]))
+	}
+	if indexes[0] != 1 || indexes[n-1] != 2 {
+		t.Fatalf("sample_description_index %v", indexes)
+	}
+	for _, c := range m.Video.chunks[:len(m.Video.chunks)/2] {
+		if c.entry != 1 {
+			t.Fatalf("chunk before change references entry %d", c.entry)
+		}
+	}
+}
+
+// startTestMP4 在临时文件中开始写入 MP4
+func startTestMP4(t *testing.T) *MP4Muxer {
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	var m MP4Muxer
+	if err = m.Start(file); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+func TestMP4SameSequenceHead(t *testing.T) {
+	m := startTestMP4(t)
+	v := testH264(testSPS[0])
+	for i := 0; i < 3; i++ {
+		// 重新发送相同的序列头时不追加采样条目
+		if err := m.SetVideo(testH264(testSPS[0])); err != nil {
+			t.Fatal(err)
+		}
+		m.WriteVideo(VideoFrame{AVFrame: testAVFrame(true, []byte{0x65, byte(i)}), Video: v, DTS: uint32(i * 3600), PTS: uint32(i * 3600)})
+	}
+	if len(m.Video.entries) != 1 || len(m.Video.chunks) != 1 {
+		t.Fatalf("entries %d chunks %d", len(m.Video.entries), len(m.Video.chunks))
+	}
+}
+
+func TestMP4AudioRateChange(t *testing.T) {
+	m := startTestMP4(t)
+	a := testAAC()
+	m.SetAudio(a)
+	for i := 0; i < 2; i++ {
+		m.WriteAudio(AudioFrame{AVFrame: testAVFrame(true, []byte{0x21, byte(i)}), Audio: a, DTS: uint32(i * 1800)})
+	}
+	// 44100Hz 变为 48000Hz
+	b := testAAC()
+	b.SampleRate, b.SequenceHead = 48000, []byte{0xAF, 0x00, 0x11, 0x90}
+	if err := m.SetAudio(b); err != nil {
+		t.Fatal(err)
+	}
+	m.WriteAudio(AudioFrame{AVFrame: testAVFrame(true, []byte{0x21, 2}), Audio: b, DTS: 3600})
+	if m.Audio.Timescale != 48000 || len(m.Audio.entries) != 2 {
+		t.Fatalf("timescale %d entries %d", m.Audio.Timescale, len(m.Audio.entries))
+	}
+	for i, want := range []uint64{0, 960, 1920} {
+		if dts := m.Audio.samples[i].dts; dts != want {
+			t.Errorf("sample %d dts %d, want %d", i, dts, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -107,6 +108,8 @@ type ISubscriber interface {
 	PlayFLV()
 	Stop(reason ...zapcore.Field)
 	Subscribe(streamPath string, sub ISubscriber) error
+	SwitchVideo(*track.Video) error
+	SwitchTrack(name string) error
 }
 
 type TrackPlayer struct {
@@ -127,12 +130,25 @@ func (player *TrackPlayer) StopPlay() {
 	}
 }
 
+// videoSwitch 等待切换的视频轨道，idr 为请求切换时该轨道的关键帧，holder 为切换到兄弟流时的占位订阅者
+type videoSwitch struct {
+	video  *track.Video
+	idr    *util.Ring[*AVFrame]
+	holder *renditionHolder
+}
+
 // Subscriber 订阅者实体定义
 type Subscriber struct {
 	IO
-	Config      *config.Subscribe
-	readers     []*track.AVRingReader
-	TrackPlayer `json:"-" yaml:"-"`
+	Config         *config.Subscribe
+	readers        []*track.AVRingReader
+	TrackPlayer    `json:"-" yaml:"-"`
+	switchVideo    atomic.Pointer[videoSwitch]
+	switchAudio    atomic.Pointer[track.Audio]
+	playAudio      atomic.Bool      // 播放协程是否在读取音频
+	rendition      *renditionHolder // 正在播放兄弟流的视频时，在兄弟流中的占位订阅者
+	jwtSession     string           // JWT 中限制同时订阅数量的会话
+	jwtMaxSessions int
 }
 
 func (s *Subscriber) Subscribe(streamPath string, sub ISubscriber) error {
@@ -198,6 +214,61 @@ func (s *Subscriber) AddTrack(t Track) bool {
 	return true
 }
 
+// SwitchVideo 切换到另一个视频轨道，切换由播放协程完成：正在播放时等到新轨道出现下一个关键帧再切换，时间戳保持连续，
+// 还没有开始播放时在开始播放时切换。轨道属于其他流时先加入该流的订阅者列表
+func (s *Subscriber) SwitchVideo(v *track.Video) error {
+	holder, err := holdRendition(s, v)
+	if err != nil {
+		return err
+	}
+	s.Info("switch video", zap.String("track", v.Name))
+	if prev := s.switchVideo.Swap(&videoSwitch{v, v.IDRing, holder}); prev != nil {
+		prev.holder.release()
+	}
+	return nil
+}
+
+// setRendition 切换生效后释放之前在兄弟流中的占位订阅者
+func (s *Subscriber) setRendition(holder *renditionHolder) {
+	s.rendition.release()
+	s.rendition = holder
+}
+
+// audioFollowVideo 音视频来自同一个流时，音频使用和视频相同的时间戳偏移，切换到兄弟流的视频后音频保持自己的偏移
+func (s *Subscriber) audioFollowVideo() bool {
+	if s.Video == nil || s.Audio == nil || s.Video.Publisher == nil || s.Audio.Publisher == nil {
+		return s.Video != nil
+	}
+	return s.Video.Publisher.GetStream() == s.Audio.Publisher.GetStream()
+}
+
+// SwitchAudio 切换到另一个音频轨道，例如切换语种，切换由播放协程完成，切换后重新发送音频序列头
+// 不订阅音频或者正在播放但没有读取音频时返回 ErrTrackNotSupport
+func (s *Subscriber) SwitchAudio(a *track.Audio) error {
+	if !s.Config.SubAudio || s.IsPlaying() && !s.playAudio.Load() {
+		return ErrTrackNotSupport
+	}
+	s.Info("switch audio", zap.String("track", a.Name))
+	s.switchAudio.Store(a)
+	return nil
+}
+
+// SwitchTrack 按名称切换到当前流中的另一个音视频轨道，数据轨道不支持切换
+func (s *Subscriber) SwitchTrack(name string) error {
+	t, ok := s.Stream.Tracks.Load(name)
+	if !ok {
+		return ErrTrackNotExist
+	}
+	switch v := t.(type) {
+	case *track.Video:
+		return s.SwitchVideo(v)
+	case *track.Audio:
+		return s.SwitchAudio(v)
+	default:
+		return ErrTrackNotSupport
+	}
+}
+
 func (s *Subscriber) IsPlaying() bool {
 	return s.TrackPlayer.Context != nil && s.TrackPlayer.Err() == nil
 }
@@ -230,10 +301,20 @@ func (s *Subscriber) PlayBlock(subType byte) {
 		return
 	}
 	s.Info("playblock", zap.Uint8("subType", subType))
-	s.TrackPlayer.Context, s.TrackPlayer.CancelFunc = context.WithCancel(s.IO)
-	ctx := s.TrackPlayer.Context
+	// 开始播放之前请求的切换直接生效
+	if sw := s.switchVideo.Swap(nil); sw != nil {
+		s.AddTrack(sw.video)
+		s.setRendition(sw.holder)
+	}
+	if a := s.switchAudio.Swap(nil); a != nil {
+		s.AddTrack(a)
+	}
 	conf := s.Config
 	hasVideo, hasAudio := s.Video != nil && conf.SubVideo, s.Audio != nil && conf.SubAudio
+	s.playAudio.Store(hasAudio)
+	defer s.playAudio.Store(false)
+	s.TrackPlayer.Context, s.TrackPlayer.CancelFunc = context.WithCancel(s.IO)
+	ctx := s.TrackPlayer.Context
 	stopReason := zap.String("reason", "stop")
 	defer s.onStop(&stopReason)
 	if !hasAudio && !hasVideo {
@@ -333,6 +414,9 @@ func (s *Subscriber) PlayBlock(subType byte) {
 		}
 		sendAudioFrame = func(frame *AVFrame) {
 			// fmt.Println(frame.Sequence, s.AudioReader.AbsTime, s.AudioReader.Delay)
+			if frame.AVCC.ByteLength == 0 {
+				return // 例如 G.722 在 FLV 中没有对应的格式
+			}
 			sendFlvFrame(codec.FLV_TAG_TYPE_AUDIO, s.AudioReader.AbsTime, frame.AVCC.ToBuffers()...)
 		}
 	}
@@ -341,12 +425,27 @@ func (s *Subscriber) PlayBlock(subType byte) {
 	if s.Args.Has(conf.SubModeArgName) {
 		subMode, _ = strconv.Atoi(s.Args.Get(conf.SubModeArgName))
 	}
+	if seekTime := s.seekTime(); !seekTime.IsZero() {
+		if hasVideo {
+			s.VideoReader.SeekTime = seekTime
+		}
+		if hasAudio {
+			s.AudioReader.SeekTime = seekTime
+		}
+	}
 	var initState = 0
 	var videoFrame, audioFrame *AVFrame
 	for ctx.Err() == nil {
 		if hasVideo {
 			for ctx.Err() == nil {
-				err := s.VideoReader.ReadFrame(subMode)
+				mode := subMode
+				if sw := s.switchVideo.Load(); sw != nil && sw.video.IDRing != sw.idr && s.switchVideo.CompareAndSwap(sw, nil) {
+					// 新的轨道出现了关键帧，从该关键帧开始读取，新的读取者会在关键帧时重新发送序列头
+					s.AddTrack(sw.video)
+					s.setRendition(sw.holder)
+					mode = track.SUBMODE_REAL
+				}
+				err := s.VideoReader.ReadFrame(mode)
 				if err == nil {
 					err = ctx.Err()
 				}
@@ -383,14 +482,23 @@ func (s *Subscriber) PlayBlock(subType byte) {
 		// 正常模式下或者纯音频模式下，音频开始播放
 		if hasAudio {
 			for ctx.Err() == nil {
+				if a := s.switchAudio.Swap(nil); a != nil && a != s.Audio {
+					prev, sameStream := s.AudioReader, a.Publisher != nil && s.Audio.Publisher != nil && a.Publisher.GetStream() == s.Audio.Publisher.GetStream()
+					s.AddTrack(a) // 新的读取者会重新发送序列头
+					if sameStream && prev.State != track.READSTATE_INIT {
+						// 同一个流的轨道时间戳一致，沿用原来的偏移（包括追帧累积的偏移），否则从原来的播放时间接续
+						s.AudioReader.FirstTs = prev.FirstTs
+						s.AudioReader.StartTs = prev.FirstTs - prev.SkipTs
+					}
+				}
 				switch s.AudioReader.State {
 				case track.READSTATE_INIT:
-					if s.Video != nil {
+					if s.audioFollowVideo() {
 						s.AudioReader.FirstTs = s.VideoReader.FirstTs
 
 					}
 				case track.READSTATE_NORMAL:
-					if s.Video != nil {
+					if s.audioFollowVideo() {
 						s.AudioReader.SkipTs = s.VideoReader.SkipTs
 					}
 				}
@@ -427,6 +535,24 @@ func (s *Subscriber) PlayBlock(subType byte) {
 	stopReason = zap.Error(ctx.Err())
 }
 
+// seekTime 根据时光回溯参数计算起始时间，未指定时返回零值
+func (s *Subscriber) seekTime() (t time.Time) {
+	conf := s.Config
+	if v := s.Args.Get(conf.SeekArgName); conf.SeekArgName != "" && v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			t = time.Now().Add(d)
+		} else {
+			s.Warn("invalid seek", zap.String("seek", v), zap.Error(err))
+		}
+	} else if v := s.Args.Get(conf.AtArgName); conf.AtArgName != "" && v != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, v); err != nil {
+			s.Warn("invalid at", zap.String("at", v), zap.Error(err))
+		}
+	}
+	return
+}
+
 func (s *Subscriber) onStop(reason *zapcore.Field) {
 	s.StopPlay()
 	if !s.Stream.IsClosed() {
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/config"
+	"m7s.live/engine/v4/track"
+	"m7s.live/engine/v4/util"
+)
+
+// testAudioSubscriber 把收到的音频帧转发到通道
+type testAudioSubscriber struct {
+	Subscriber
+	frames chan AudioFrame
+}
+
+func (s *testAudioSubscriber) OnEvent(event any) {
+	if v, ok := event.(AudioFrame); ok {
+		s.frames <- v
+	} else {
+		s.Subscriber.OnEvent(event)
+	}
+}
+
+func TestSwitchAudioPlaying(t *testing.T) {
+	setupTestEngine()
+	var pub Publisher
+	pubConf := config.Global.Publish
+	pub.Config = &pubConf
+	if err := pub.Publish("test/switch-audio", &pub); err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Stop()
+	tracks := []*track.AAC{track.NewAAC(&pub, "aac1"), track.NewAAC(&pub, "aac2")}
+	for _, a := range tracks {
+		a.WriteSequenceHead([]byte{0xAF, 0x00, 0x12, 0x10})
+	}
+	// 轨道异步加入流，都加入后再订阅，避免播放时收到新的轨道
+	for i := 0; ; i++ {
+		_, ok1 := pub.Stream.Tracks.Load("aac1")
+		_, ok2 := pub.Stream.Tracks.Load("aac2")
+		if ok1 && ok2 {
+			break
+		} else if i == 100 {
+			t.Fatal("tracks not attached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	write := func(ts uint32) {
+		for _, a := range tracks {
+			var b util.BLL
+			b.Push(&util.ListItem[util.Buffer]{Value: []byte{0xAF, 0x01, 0x21, byte(ts)}})
+			a.WriteAVCC(ts, &b)
+		}
+	}
+	subConf := config.Global.Subscribe
+	subConf.SubVideo = false
+	sub := &testAudioSubscriber{frames: make(chan AudioFrame, 10)}
+	sub.Config = &subConf
+	if err := sub.Subscribe("test/switch-audio?ats=aac1", sub); err != nil {
+		t.Fatal(err)
+	}
+	go sub.PlayRaw()
+	defer sub.Stop()
+	// 等待开始播放，第一帧的时间戳为 1，从第二帧开始检查
+	ts := uint32(1000)
+	for len(sub.frames) < 2 {
+		if ts += 20; ts > 3000 {
+			t.Fatal("play timeout")
+		}
+		write(ts)
+		time.Sleep(10 * time.Millisecond)
+	}
+	var last uint32
+	for len(sub.frames) > 0 {
+		last = (<-sub.frames).AbsTime
+	}
+	var switched bool
+	for i := 0; i < 40; i++ {
+		ts += 20
+		write(ts)
+		select {
+		case frame := <-sub.frames:
+			if frame.AbsTime != last+20 {
+				t.Fatalf("frame %d from %s: abs time %d after %d", i, frame.Audio.Name, frame.AbsTime, last)
+			}
+			last = frame.AbsTime
+			switched = frame.Audio.Name == "aac2"
+			if i == 10 {
+				if err := sub.SwitchTrack("aac2"); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("frame %d timeout", i)
+		}
+	}
+	if !switched {
+		t.Fatal("audio not switched")
+	}
+	// 不订阅音频时不能切换
+	noAudio := &testAudioSubscriber{frames: make(chan AudioFrame, 10)}
+	noAudioConf := subConf
+	noAudioConf.SubAudio = false
+	noAudio.Config = &noAudioConf
+	noAudio.Stream = sub.Stream
+	if err := noAudio.SwitchTrack("aac2"); err != ErrTrackNotSupport {
+		t.Fatalf("switch without audio: %v", err)
+	}
+}
@@ -135,6 +135,8 @@ func (s *Subscribers) Delete(suber ISubscriber) {
 	io.readers = nil
 	if _, ok := s.public[suber]; ok {
 		delete(s.public, suber)
+		subscriberCounter.release(&io.IO)
+		io.releaseJWTSession()
 		io.Info("suber -1", zap.Int("remains", s.Len()))
 	}
 	if _, ok := s.internal[suber]; ok {
@@ -170,6 +172,10 @@ func (s *Subscribers) Dispose() {
 		w.Reject(ErrStreamIsClosed)
 	}
 	s.waits = nil
+	for suber := range s.public {
+		subscriberCounter.release(&suber.GetSubscriber().IO)
+		suber.GetSubscriber().releaseJWTSession()
+	}
 	s.public = nil
 	s.internal = nil
 }
@@ -35,9 +35,11 @@ type Summary struct {
 		Used  uint64
 		Usage float64
 	}
-	NetWork []NetWorkInfo
-	Streams []StreamSummay
-	ts      time.Time //上次更新时间
+	NetWork     []NetWorkInfo
+	Streams     []StreamSummay
+	Publishers  IOCount   // 发布者数量统计
+	Subscribers IOCount   // 订阅者数量统计
+	ts          time.Time //上次更新时间
 }
 
 // NetWorkInfo 网速信息
@@ -109,6 +111,8 @@ func (s *SummaryUtil) collect() *Summary {
 	s.Streams = util.MapList(&Streams, func(name string, ss *Stream) StreamSummay {
 		return ss.Summary()
 	})
+	s.Publishers = publisherCounter.snapshot()
+	s.Subscribers = subscriberCounter.snapshot()
 	lastSummary = Summary(*s)
 	return &lastSummary
 }
@@ -0,0 +1,201 @@
+package track
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*AC3)(nil)
+
+var errAC3Codec = errors.New("ac3 codec mismatch")
+
+// NewAC3 AC-3 和 E-AC-3 透传，编码类型在创建时确定，不一致的同步帧会被丢弃，采样率和声道数以收到的同步帧为准
+func NewAC3(puber IPuber, eac3 bool, stuff ...any) (ac3 *AC3) {
+	ac3 = &AC3{}
+	if eac3 {
+		ac3.CodecID = codec.CodecID_EAC3
+	} else {
+		ac3.CodecID = codec.CodecID_AC3
+	}
+	ac3.SampleSize = 16
+	ac3.Channels = 2
+	ac3.SetStuff(uint32(48000), byte(96), ac3, stuff, puber)
+	if ac3.BytesPool == nil {
+		ac3.BytesPool = make(util.BytesPool, 17)
+	}
+	return
+}
+
+type AC3 struct {
+	Audio
+	SyncFrame  codec.AC3SyncFrame   // 最近一个独立子流的帧头，用于生成 dac3/dec3
+	Dependents []codec.AC3SyncFrame // 和 SyncFrame 一起解码的 E-AC-3 从属子流
+	fragments  []byte               // RTP 中被分片的帧
+	config     []byte               // 当前的 dac3/dec3
+}
+
+// appendFrames 写入完整的同步帧，E-AC-3 的从属子流和前面的独立子流放在同一个 AU 中
+func (ac3 *AC3) appendFrames(data []byte) error {
+	var au [][]byte
+	var syncFrame codec.AC3SyncFrame
+	var dependents []codec.AC3SyncFrame
+	appendAU := func() {
+		if len(au) > 0 {
+			ac3.AppendAuBytes(au...)
+			ac3.setSyncFrame(syncFrame, dependents)
+		}
+	}
+	for _, frame := range codec.SplitAC3Frames(data) {
+		f, err := codec.ParseAC3SyncFrame(frame)
+		if err != nil {
+			return err
+		}
+		if f.Dependent && len(au) > 0 {
+			au = append(au, frame)
+			dependents = append(dependents, f)
+			continue
+		}
+		if f.EAC3 != (ac3.CodecID == codec.CodecID_EAC3) {
+			return errAC3Codec
+		}
+		appendAU()
+		au, syncFrame, dependents = [][]byte{frame}, f, nil
+	}
+	appendAU()
+	return nil
+}
+
+// setSyncFrame 更新帧头，dac3/dec3 变化时视为解码配置变化，通知订阅者重新生成配置
+func (ac3 *AC3) setSyncFrame(f codec.AC3SyncFrame, dependents []codec.AC3SyncFrame) {
+	ac3.SyncFrame, ac3.Dependents = f, dependents
+	var config []byte
+	if f.EAC3 {
+		config = f.DEC3(dependents...)
+	} else {
+		config = f.DAC3()
+	}
+	if bytes.Equal(config, ac3.config) {
+		return
+	}
+	ac3.config = config
+	ac3.SampleRate = uint32(f.SampleRate)
+	ac3.Channels = f.Channels
+	// 没有序列头，只增加序号
+	ac3.SequenceHeadSeq++
+}
+
+func (ac3 *AC3) WriteAVCC(ts uint32, frame *util.BLL) error {
+	return errors.New("ac3 not support WriteAVCC")
+}
+
+func (ac3 *AC3) WriteRawBytes(pts uint32, raw util.IBytes) {
+	// PES private stream 1 中也可能是字幕等其他数据
+	if err := ac3.appendFrames(raw.Bytes()); err != nil {
+		ac3.Debug("ac3 syncframe error", zap.Error(err))
+		ac3.Value.AUList.Recycle()
+		return
+	}
+	ac3.Value.BytesIn += raw.Len()
+	ac3.generateTimestamp(pts)
+	ac3.Flush()
+}
+
+// WriteRTPFrame RFC 4184 和 RFC 4598，负载头第一个字节低2位为帧类型，第二个字节为帧数或者分片数
+func (ac3 *AC3) WriteRTPFrame(rtpItem *LIRTP) {
+	frame := &rtpItem.Value
+	ac3.Value.RTP.Push(rtpItem)
+	if len(frame.Payload) <= 2 {
+		return
+	}
+	payload := frame.Payload[2:]
+	switch ft := frame.Payload[0] & 0x03; {
+	case ft == 0:
+		ac3.fragments = nil
+		if err := ac3.appendFrames(payload); err != nil {
+			ac3.Warn("ac3 syncframe error", zap.Error(err))
+			ac3.Value.AUList.Recycle()
+			return
+		}
+	case ft == 1 || (ft == 2 && ac3.CodecID == codec.CodecID_AC3):
+		// 起始分片，AC-3 中1和2都表示起始分片
+		ac3.fragments = append([]byte(nil), payload...)
+		return
+	default:
+		if ac3.fragments == nil {
+			return
+		}
+		ac3.fragments = append(ac3.fragments, payload...)
+		f, err := codec.ParseAC3SyncFrame(ac3.fragments)
+		if err != nil {
+			ac3.fragments = nil
+			ac3.Warn("ac3 syncframe error", zap.Error(err))
+			return
+		}
+		if len(ac3.fragments) < f.FrameLength {
+			return
+		}
+		err = ac3.appendFrames(ac3.fragments)
+		ac3.fragments = nil
+		if err != nil {
+			ac3.Value.AUList.Recycle()
+			return
+		}
+	}
+	ac3.generateTimestamp(uint32(uint64(frame.Timestamp) * 90000 / uint64(ac3.SampleRate)))
+	ac3.Flush()
+}
+
+// CompleteAVCC FLV 中没有 AC-3
+func (ac3 *AC3) CompleteAVCC(value *AVFrame) {
+}
+
+// CompleteRTP 每个包只含一个 AU，超过 MTU 的分片
+func (ac3 *AC3) CompleteRTP(value *AVFrame) {
+	var packets [][][]byte
+	var timestamps []time.Duration
+	pts := value.PTS
+	size := RTPMTU - 2
+	value.AUList.Range(func(au *util.BLL) bool {
+		if au.ByteLength <= size {
+			packets = append(packets, append([][]byte{{0, byte(au.Length)}}, au.ToBuffers()...))
+			timestamps = append(timestamps, pts)
+		} else {
+			n := (au.ByteLength + size - 1) / size
+			ft := byte(3)
+			if ac3.CodecID == codec.CodecID_EAC3 {
+				ft = 2
+			}
+			r := au.NewReader()
+			for bufs := r.ReadN(size); len(bufs) > 0; bufs = r.ReadN(size) {
+				packets = append(packets, append([][]byte{{ft, byte(n)}}, bufs...))
+				timestamps = append(timestamps, pts)
+			}
+			// 起始分片，AC-3 中包含至少 5/8 帧时为1，E-AC-3 中总是1
+			if ac3.CodecID == codec.CodecID_AC3 && size*8 < au.ByteLength*5 {
+				packets[len(packets)-n][0][0] = 2
+			} else {
+				packets[len(packets)-n][0][0] = 1
+			}
+		}
+		if ac3.SyncFrame.SampleRate > 0 {
+			pts += time.Duration(ac3.SyncFrame.SamplesPerFrame * 90000 / ac3.SyncFrame.SampleRate)
+		}
+		return true
+	})
+	if len(packets) == 0 {
+		return
+	}
+	ac3.PacketizeRTP(packets...)
+	i := 0
+	value.RTP.Range(func(packet RTPFrame) bool {
+		packet.Timestamp = uint32(time.Duration(ac3.SampleRate) * timestamps[i] / 90000)
+		i++
+		return true
+	})
+}
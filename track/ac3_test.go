@@ -0,0 +1,72 @@
+package track
+
+import (
+	"testing"
+
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+)
+
+var (
+	// AC-3 48kHz 384kbps 3/2+LFE
+	testAC3Header = []byte{0x0B, 0x77, 0, 0, 0x1C, 0x40, 0xE1}
+	// E-AC-3 独立子流 48kHz 3/2+LFE 和从属子流 2/0
+	testEAC3Header          = []byte{0x0B, 0x77, 0x01, 0x7F, 0x3F, 0x80, 0x00}
+	testEAC3DependentHeader = []byte{0x0B, 0x77, 0x41, 0x7F, 0x34, 0x80, 0x10, 0x20, 0x00}
+)
+
+// testAC3Frame 按照帧头中的长度补足一个同步帧
+func testAC3Frame(header []byte) []byte {
+	f, _ := codec.ParseAC3SyncFrame(header)
+	frame := make([]byte, f.FrameLength)
+	copy(frame, header)
+	return frame
+}
+
+func TestAC3ConfigChange(t *testing.T) {
+	ac3 := NewAC3(nil, false)
+	ac3.Init(8, NewAVFrame)
+	frame := testAC3Frame(testAC3Header)
+	for i := 0; i < 2; i++ {
+		if err := ac3.appendFrames(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 配置不变时只通知一次
+	if ac3.SequenceHeadSeq != 1 || ac3.SampleRate != 48000 || ac3.Channels != 6 {
+		t.Fatalf("seq %d rate %d channels %d", ac3.SequenceHeadSeq, ac3.SampleRate, ac3.Channels)
+	}
+	// 编码类型在创建时确定
+	if err := ac3.appendFrames(testAC3Frame(testEAC3Header)); err != errAC3Codec || ac3.CodecID != codec.CodecID_AC3 || ac3.SequenceHeadSeq != 1 {
+		t.Fatalf("eac3 frame %v codec %v seq %d", err, ac3.CodecID, ac3.SequenceHeadSeq)
+	}
+	// 采样率变为 44.1kHz
+	header := append([]byte(nil), testAC3Header...)
+	header[4] = 0x5C
+	if err := ac3.appendFrames(testAC3Frame(header)); err != nil {
+		t.Fatal(err)
+	}
+	if ac3.SequenceHeadSeq != 2 || ac3.SampleRate != 44100 {
+		t.Fatalf("seq %d rate %d", ac3.SequenceHeadSeq, ac3.SampleRate)
+	}
+}
+
+func TestEAC3Dependents(t *testing.T) {
+	ac3 := NewAC3(nil, true)
+	ac3.Init(8, NewAVFrame)
+	var data []byte
+	for i := 0; i < 2; i++ {
+		data = append(data, testAC3Frame(testEAC3Header)...)
+		data = append(data, testAC3Frame(testEAC3DependentHeader)...)
+	}
+	if err := ac3.appendFrames(data); err != nil {
+		t.Fatal(err)
+	}
+	// 从属子流和独立子流放在同一个 AU 中
+	if ac3.Value.AUList.Length != 2 || ac3.Value.AUList.Next.Value.Length != 2 || len(ac3.Dependents) != 1 || ac3.SequenceHeadSeq != 1 {
+		t.Fatalf("au %d dependents %d seq %d", ac3.Value.AUList.Length, len(ac3.Dependents), ac3.SequenceHeadSeq)
+	}
+	if err := ac3.appendFrames(testAC3Frame(testAC3Header)); err != errAC3Codec || ac3.CodecID != codec.CodecID_EAC3 {
+		t.Fatalf("ac3 frame %v codec %v", err, ac3.CodecID)
+	}
+}
@@ -0,0 +1,401 @@
+package track
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/util"
+)
+
+// dvrSegmentTime 每个分片文件覆盖的时长
+const dvrSegmentTime = time.Minute
+
+type dvrSegment struct {
+	path    string
+	start   time.Time
+	size    int64
+	gops    int // 索引中引用该分片的 GOP 数量
+	removed bool
+}
+
+// dvrGOP 落盘 GOP 的索引
+type dvrGOP struct {
+	WriteTime time.Time // 关键帧的写入时间
+	FirstSeq  uint32
+	LastSeq   uint32
+	segment   *dvrSegment
+	offset    int64
+	data      []byte // 写入磁盘之前暂存在内存中
+	size      int
+}
+
+// DVRSpill 时光回溯落盘，移出内存缓冲的 GOP 追加写入磁盘分片文件，并在内存中保存索引
+type DVRSpill struct {
+	Dir     string
+	Retain  time.Duration // 磁盘上保留的时长
+	log.Zap `json:"-" yaml:"-"`
+	mu      sync.Mutex
+	gops    []*dvrGOP
+	current *dvrSegment
+	pending []*dvrGOP
+	notify  chan struct{}
+	frames  chan []*AVFrame // 等待编码的 GOP
+	closed  bool
+}
+
+func newDVRSpill(dir string, retain time.Duration, logger log.Zap) (*DVRSpill, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &DVRSpill{
+		Dir:    dir,
+		Retain: retain,
+		Zap:    logger,
+		notify: make(chan struct{}, 1),
+		frames: make(chan []*AVFrame, 16),
+	}
+	go s.encode()
+	go s.run()
+	return s, nil
+}
+
+// AppendGOP 在发布者协程中调用，帧已经加了读锁，环形缓冲不会复用它们，编码完成后释放读锁
+func (s *DVRSpill) AppendGOP(frames []*AVFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		select {
+		case s.frames <- frames:
+			return
+		default:
+			s.Warn("dvr spill queue full", zap.Uint32("seq", frames[0].Sequence))
+		}
+	}
+	for _, frame := range frames {
+		frame.ReaderLeave()
+	}
+}
+
+// encode 在单独的协程中序列化 GOP，避免占用发布者的写入时间
+func (s *DVRSpill) encode() {
+	for frames := range s.frames {
+		var b util.Buffer
+		for _, frame := range frames {
+			encodeDVRFrame(&b, frame)
+		}
+		writeTime, firstSeq, lastSeq := frames[0].WriteTime, frames[0].Sequence, frames[len(frames)-1].Sequence
+		for _, frame := range frames {
+			frame.ReaderLeave()
+		}
+		s.Append(writeTime, firstSeq, lastSeq, b)
+	}
+}
+
+// run 在单独的协程中写入磁盘，避免阻塞发布者
+func (s *DVRSpill) run() {
+	var file *os.File
+	var segment *dvrSegment
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+	for range s.notify {
+		s.mu.Lock()
+		pending := s.pending
+		s.pending = nil
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+		for _, gop := range pending {
+			s.mu.Lock()
+			removed, data := gop.segment.removed, gop.data
+			s.mu.Unlock()
+			if removed {
+				continue
+			}
+			if gop.segment != segment {
+				if file != nil {
+					file.Close()
+				}
+				segment = gop.segment
+				var err error
+				if file, err = os.OpenFile(segment.path, os.O_CREATE|os.O_WRONLY, 0666); err != nil {
+					s.Error("dvr spill open", zap.Error(err))
+					continue
+				}
+			}
+			if _, err := file.WriteAt(data, gop.offset); err != nil {
+				s.Error("dvr spill write", zap.Error(err))
+				continue
+			}
+			s.mu.Lock()
+			gop.data = nil
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Append 追加一个 GOP，超过保留时长的 GOP 将被删除
+func (s *DVRSpill) Append(writeTime time.Time, firstSeq, lastSeq uint32, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.current == nil || writeTime.Sub(s.current.start) > dvrSegmentTime {
+		if s.current != nil && s.current.gops == 0 {
+			s.remove(s.current)
+		}
+		s.current = &dvrSegment{
+			path:  filepath.Join(s.Dir, fmt.Sprintf("%d.dvr", firstSeq)),
+			start: writeTime,
+		}
+	}
+	gop := &dvrGOP{
+		WriteTime: writeTime,
+		FirstSeq:  firstSeq,
+		LastSeq:   lastSeq,
+		segment:   s.current,
+		offset:    s.current.size,
+		data:      data,
+		size:      len(data),
+	}
+	s.current.size += int64(len(data))
+	s.current.gops++
+	s.gops = append(s.gops, gop)
+	s.pending = append(s.pending, gop)
+	for len(s.gops) > 1 && writeTime.Sub(s.gops[0].WriteTime) > s.Retain {
+		s.drop()
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *DVRSpill) drop() {
+	gop := s.gops[0]
+	s.gops[0] = nil
+	s.gops = s.gops[1:]
+	seg := gop.segment
+	if seg.gops--; seg.gops == 0 && seg != s.current {
+		s.remove(seg)
+	}
+}
+
+func (s *DVRSpill) remove(seg *dvrSegment) {
+	seg.removed = true
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		s.Warn("dvr spill remove", zap.String("path", seg.path), zap.Error(err))
+	}
+}
+
+// Range 返回磁盘上可回溯的时间范围和 GOP 数量
+func (s *DVRSpill) Range() (start time.Time, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count = len(s.gops); count > 0 {
+		start = s.gops[0].WriteTime
+	}
+	return
+}
+
+// Seek 定位到写入时间在 t 之前最近的 GOP，t 早于保留范围时定位到最早的 GOP
+func (s *DVRSpill) Seek(t time.Time) *DVRCursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.gops) == 0 {
+		return nil
+	}
+	i := 0
+	for i+1 < len(s.gops) && !s.gops[i+1].WriteTime.After(t) {
+		i++
+	}
+	return &DVRCursor{spill: s, lastSeq: s.gops[i].FirstSeq - 1}
+}
+
+// after 查找第一个包含 seq 之后的帧的 GOP
+func (s *DVRSpill) after(seq uint32) (gop dvrGOP, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.gops {
+		if int32(g.LastSeq-seq) > 0 {
+			return *g, true
+		}
+	}
+	return
+}
+
+func (s *DVRSpill) load(gop *dvrGOP) (data []byte, err error) {
+	if gop.data != nil {
+		return gop.data, nil
+	}
+	f, err := os.Open(gop.segment.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	data = make([]byte, gop.size)
+	_, err = f.ReadAt(data, gop.offset)
+	return
+}
+
+// Close 停止写入并删除所有分片文件
+func (s *DVRSpill) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.gops = nil
+	close(s.frames)
+	s.mu.Unlock()
+	close(s.notify)
+	os.RemoveAll(s.Dir)
+}
+
+// DVRCursor 按顺序读取磁盘上的帧
+type DVRCursor struct {
+	spill   *DVRSpill
+	frames  []*AVFrame
+	lastSeq uint32
+}
+
+// Next 读取下一帧，磁盘上没有更新的帧时返回 nil
+func (c *DVRCursor) Next() *AVFrame {
+	for len(c.frames) == 0 {
+		gop, ok := c.spill.after(c.lastSeq)
+		if !ok {
+			return nil
+		}
+		data, err := c.spill.load(&gop)
+		if err == nil {
+			c.frames, err = decodeDVRFrames(data)
+		}
+		if err != nil {
+			c.spill.Warn("dvr spill read", zap.Uint32("seq", gop.FirstSeq), zap.Error(err))
+			c.lastSeq = gop.LastSeq
+			continue
+		}
+		// 跳过已经读过的帧
+		for len(c.frames) > 0 && int32(c.frames[0].Sequence-c.lastSeq) <= 0 {
+			c.frames = c.frames[1:]
+		}
+	}
+	frame := c.frames[0]
+	c.frames = c.frames[1:]
+	c.lastSeq = frame.Sequence
+	return frame
+}
+
+func writeDVRUint64(b *util.Buffer, v uint64) {
+	b.WriteUint32(uint32(v >> 32))
+	b.WriteUint32(uint32(v))
+}
+
+// encodeDVRFrame 序列化一帧，保存裸数据、AVCC 和 RTP，读取时不需要再用发布者的轨道补完
+func encodeDVRFrame(b *util.Buffer, frame *AVFrame) {
+	b.WriteUint32(frame.Sequence)
+	b.WriteByte(util.Conditoinal[byte](frame.IFrame, 1, 0))
+	writeDVRUint64(b, uint64(frame.WriteTime.UnixNano()))
+	writeDVRUint64(b, uint64(frame.Timestamp))
+	writeDVRUint64(b, uint64(frame.PTS))
+	writeDVRUint64(b, uint64(frame.DTS))
+	b.WriteUint32(frame.DeltaTime)
+	b.WriteUint16(uint16(frame.AUList.Length))
+	frame.AUList.Range(func(au *util.BLL) bool {
+		b.WriteUint32(uint32(au.ByteLength))
+		au.Range(func(item util.Buffer) bool {
+			b.Write(item)
+			return true
+		})
+		return true
+	})
+	b.WriteUint32(uint32(frame.AVCC.ByteLength))
+	frame.AVCC.Range(func(item util.Buffer) bool {
+		b.Write(item)
+		return true
+	})
+	var packets [][]byte
+	frame.RTP.Range(func(item RTPFrame) bool {
+		if raw, err := item.Marshal(); err == nil {
+			packets = append(packets, raw)
+		}
+		return true
+	})
+	b.WriteUint16(uint16(len(packets)))
+	for _, raw := range packets {
+		b.WriteUint32(uint32(len(raw)))
+		b.Write(raw)
+	}
+}
+
+var errDVRCorrupt = errors.New("dvr spill data corrupt")
+
+func decodeDVRFrames(data util.Buffer) (frames []*AVFrame, err error) {
+	for data.CanRead() {
+		if !data.CanReadN(43) {
+			return nil, errDVRCorrupt
+		}
+		frame := &AVFrame{}
+		frame.Sequence = data.ReadUint32()
+		frame.IFrame = data.ReadByte() == 1
+		frame.WriteTime = time.Unix(0, int64(data.ReadUint64()))
+		frame.Timestamp = time.Duration(data.ReadUint64())
+		frame.PTS = time.Duration(data.ReadUint64())
+		frame.DTS = time.Duration(data.ReadUint64())
+		frame.DeltaTime = data.ReadUint32()
+		for n := data.ReadUint16(); n > 0; n-- {
+			if !data.CanReadN(4) {
+				return nil, errDVRCorrupt
+			}
+			l := int(data.ReadUint32())
+			if !data.CanReadN(l) {
+				return nil, errDVRCorrupt
+			}
+			var au util.BLL
+			au.Push(&util.ListItem[util.Buffer]{Value: data.ReadN(l)})
+			frame.AUList.PushValue(&au)
+		}
+		if !data.CanReadN(4) {
+			return nil, errDVRCorrupt
+		}
+		l := int(data.ReadUint32())
+		if !data.CanReadN(l) {
+			return nil, errDVRCorrupt
+		}
+		if l > 0 {
+			frame.AVCC.Push(&util.ListItem[util.Buffer]{Value: data.ReadN(l)})
+		}
+		if !data.CanReadN(2) {
+			return nil, errDVRCorrupt
+		}
+		for n := data.ReadUint16(); n > 0; n-- {
+			if !data.CanReadN(4) {
+				return nil, errDVRCorrupt
+			}
+			l := int(data.ReadUint32())
+			if !data.CanReadN(l) {
+				return nil, errDVRCorrupt
+			}
+			var packet RTPFrame
+			if packet.Unmarshal(data.ReadN(l)) == nil {
+				return nil, errDVRCorrupt
+			}
+			frame.RTP.PushValue(packet)
+		}
+		frames = append(frames, frame)
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package track
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/util"
+)
+
+func TestDVRSpill(t *testing.T) {
+	spill, err := newDVRSpill(t.TempDir()+"/dvr", time.Minute, log.Logger{}.Lang(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	base := time.Now()
+	var seq uint32
+	for g := 0; g < 3; g++ {
+		var b util.Buffer
+		first := seq + 1
+		for i := 0; i < 5; i++ {
+			seq++
+			var frame AVFrame
+			frame.Sequence = seq
+			frame.IFrame = i == 0
+			frame.WriteTime = base.Add(time.Duration(seq) * time.Second)
+			frame.DTS = time.Duration(seq) * 3000
+			var au util.BLL
+			au.Push(&util.ListItem[util.Buffer]{Value: []byte{byte(seq), 1, 2}})
+			frame.AUList.PushValue(&au)
+			frame.RTP.PushValue(RTPFrame{Packet: &rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: uint16(seq), Timestamp: seq * 3000, Marker: true}, Payload: []byte{byte(seq)}}})
+			encodeDVRFrame(&b, &frame)
+		}
+		spill.Append(base.Add(time.Duration(first)*time.Second), first, seq, b)
+	}
+	if start, count := spill.Range(); count != 3 || !start.Equal(base.Add(time.Second)) {
+		t.Fatalf("range: %v %d", start, count)
+	}
+	cursor := spill.Seek(base.Add(8 * time.Second))
+	for want := uint32(6); want <= seq; want++ {
+		frame := cursor.Next()
+		if frame == nil {
+			t.Fatalf("expect frame %d", want)
+		}
+		if frame.Sequence != want || frame.IFrame != (want%5 == 1) || frame.DTS != time.Duration(want)*3000 || frame.AUList.Length != 1 {
+			t.Fatalf("frame %d mismatch: %+v", want, frame)
+		}
+		if au := frame.AUList.ToBytes(); au[0] != byte(want) {
+			t.Fatalf("frame %d payload %v", want, au)
+		}
+		// 落盘的帧也要能给 RTP 订阅者使用
+		if frame.RTP.Length != 1 {
+			t.Fatalf("frame %d rtp count %d", want, frame.RTP.Length)
+		}
+		if packet := frame.RTP.Next.Value; packet.SequenceNumber != uint16(want) || packet.Timestamp != want*3000 || !packet.Marker || packet.Payload[0] != byte(want) {
+			t.Fatalf("frame %d rtp mismatch: %v", want, packet.Packet)
+		}
+	}
+	if cursor.Next() != nil {
+		t.Fatal("expect end of spill")
+	}
+}
+
+func TestDVRSpillAppendGOP(t *testing.T) {
+	spill, err := newDVRSpill(t.TempDir()+"/dvr", time.Minute, log.Logger{}.Lang(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	var frames []*AVFrame
+	for seq := uint32(1); seq <= 3; seq++ {
+		frame := &AVFrame{IFrame: seq == 1}
+		frame.Sequence = seq
+		var au util.BLL
+		au.Push(&util.ListItem[util.Buffer]{Value: []byte{byte(seq)}})
+		frame.AUList.PushValue(&au)
+		frame.ReaderEnter()
+		frames = append(frames, frame)
+	}
+	spill.AppendGOP(frames)
+	for i := 0; ; i++ {
+		if _, count := spill.Range(); count == 1 {
+			break
+		} else if i == 100 {
+			t.Fatal("gop not spilled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 编码完成后释放读锁，环形缓冲可以复用这些帧
+	for _, frame := range frames {
+		if !frame.StartWrite() {
+			t.Fatalf("frame %d still locked", frame.Sequence)
+		}
+	}
+	cursor := spill.Seek(time.Now())
+	for want := uint32(1); want <= 3; want++ {
+		if frame := cursor.Next(); frame == nil || frame.Sequence != want || frame.AUList.ToBytes()[0] != byte(want) {
+			t.Fatalf("frame %d mismatch: %+v", want, frame)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package track
+
+import (
+	"github.com/pkg/errors"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*G722)(nil)
+
+// NewG722 实际采样率为16000，但 RTP 时钟频率按照 RFC 3551 为8000，这里 SampleRate 记录的是 RTP 时钟频率
+func NewG722(puber IPuber, stuff ...any) (g722 *G722) {
+	g722 = &G722{}
+	g722.CodecID = codec.CodecID_G722
+	g722.SampleSize = 16
+	g722.Channels = 1
+	g722.SetStuff(uint32(8000), byte(9), g722, stuff, puber)
+	if g722.BytesPool == nil {
+		g722.BytesPool = make(util.BytesPool, 17)
+	}
+	return
+}
+
+type G722 struct {
+	Audio
+}
+
+func (g722 *G722) WriteAVCC(ts uint32, frame *util.BLL) error {
+	return errors.New("g722 not support WriteAVCC")
+}
+
+func (g722 *G722) WriteRTPFrame(rtpItem *LIRTP) {
+	frame := &rtpItem.Value
+	g722.Value.RTP.Push(rtpItem)
+	g722.generateTimestamp(uint32(uint64(frame.Timestamp) * 90000 / uint64(g722.SampleRate)))
+	g722.AppendAuBytes(frame.Payload)
+	g722.Flush()
+}
+
+// CompleteAVCC FLV 中没有 G.722
+func (g722 *G722) CompleteAVCC(value *AVFrame) {
+}
+
+func (g722 *G722) CompleteRTP(value *AVFrame) {
+	if value.AUList.ByteLength > RTPMTU {
+		var packets [][][]byte
+		r := value.AUList.NewReader()
+		for bufs := r.ReadN(RTPMTU); len(bufs) > 0; bufs = r.ReadN(RTPMTU) {
+			packets = append(packets, bufs)
+		}
+		g722.PacketizeRTP(packets...)
+	} else {
+		g722.Audio.CompleteRTP(value)
+	}
+}
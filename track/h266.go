@@ -0,0 +1,261 @@
+package track
+
+import (
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*H266)(nil)
+
+type H266 struct {
+	Video
+	VPS        []byte `json:"-" yaml:"-"`
+	MaxDONDiff int    `json:"-" yaml:"-"` // SDP 中的 sprop-max-don-diff，由 RTP 发布者设置，大于0时负载中带有 DONL/DOND
+}
+
+func NewH266(puber IPuber, stuff ...any) (vt *H266) {
+	vt = &H266{}
+	vt.Video.CodecID = codec.CodecID_H266
+	vt.SetStuff("h266", byte(96), uint32(90000), vt, stuff, puber)
+	if vt.BytesPool == nil {
+		vt.BytesPool = make(util.BytesPool, 17)
+	}
+	vt.nalulenSize = 4
+	vt.dtsEst = util.NewDTSEstimator()
+	return
+}
+
+// updateParamaterSets VPS 是可选的，只收集存在的参数集
+func (vt *H266) updateParamaterSets() {
+	paramaterSets := make(ParamaterSets, 0, 3)
+	for _, ps := range [][]byte{vt.VPS, vt.SPS, vt.PPS} {
+		if ps != nil {
+			paramaterSets = append(paramaterSets, ps)
+		}
+	}
+	vt.ParamaterSets = paramaterSets
+}
+
+func (vt *H266) WriteSliceBytes(slice []byte) {
+	if len(slice) < 2 {
+		vt.Error("H266 WriteSliceBytes got short slice", zap.Int("len", len(slice)))
+		return
+	}
+	t := codec.ParseH266NALUType(slice[1])
+	if log.Trace {
+		vt.Trace("naluType", zap.Uint8("naluType", byte(t)))
+	}
+	switch t {
+	case codec.H266_NAL_VPS:
+		vt.VPS = slice
+	case codec.H266_NAL_SPS:
+		vt.SPS = slice
+		var record codec.VVCDecoderConfigurationRecord
+		spsInfo, _ := record.ParseSps(slice)
+		if spsInfo.Width != vt.SPSInfo.Width || spsInfo.Height != vt.SPSInfo.Height {
+			vt.Debug("SPS", zap.Any("SPSInfo", spsInfo))
+		}
+		vt.SPSInfo = spsInfo
+	case codec.H266_NAL_PPS:
+		vt.PPS = slice
+		if vt.SPS != nil {
+			extraData, err := codec.BuildH266SeqHeaderFromVpsSpsPps(vt.VPS, vt.SPS, vt.PPS)
+			if err == nil {
+				vt.updateParamaterSets()
+				vt.nalulenSize = 4
+				vt.Video.WriteSequenceHead(extraData)
+			} else {
+				vt.Error("H266 BuildH266SeqHeaderFromVpsSpsPps", zap.Error(err))
+			}
+		}
+	case codec.H266_NAL_IDR_W_RADL, codec.H266_NAL_IDR_N_LP, codec.H266_NAL_CRA:
+		vt.Value.IFrame = true
+		vt.AppendAuBytes(slice)
+	case codec.H266_NAL_TRAIL, codec.H266_NAL_STSA, codec.H266_NAL_RADL, codec.H266_NAL_RASL, codec.H266_NAL_GDR:
+		vt.Value.IFrame = false
+		vt.AppendAuBytes(slice)
+	case codec.H266_NAL_PREFIX_APS, codec.H266_NAL_SUFFIX_APS, codec.H266_NAL_PH,
+		codec.H266_NAL_PREFIX_SEI, codec.H266_NAL_SUFFIX_SEI, codec.H266_NAL_OPI, codec.H266_NAL_DCI:
+		vt.AppendAuBytes(slice)
+	case codec.H266_NAL_AUD, codec.H266_NAL_EOS, codec.H266_NAL_EOB, codec.H266_NAL_FD:
+	default:
+		vt.Warn("nalu type not supported", zap.Uint("type", uint(t)))
+	}
+}
+
+func (vt *H266) WriteSequenceHead(head []byte) (err error) {
+	var record codec.VVCDecoderConfigurationRecord
+	if len(head) <= 5 {
+		err = codec.ErrVvc
+	} else if err = record.Unmarshal(head[5:]); err == nil {
+		for _, nalu := range record.NALUs {
+			if len(nalu) < 2 {
+				continue
+			}
+			switch codec.ParseH266NALUType(nalu[1]) {
+			case codec.H266_NAL_VPS:
+				vt.VPS = nalu
+			case codec.H266_NAL_SPS:
+				vt.SPS = nalu
+				vt.SPSInfo, _ = record.ParseSps(nalu)
+			case codec.H266_NAL_PPS:
+				vt.PPS = nalu
+			}
+		}
+		if vt.SPS == nil || vt.PPS == nil {
+			err = codec.ErrVvc
+		}
+	}
+	if err != nil {
+		vt.Error("H266 parse VVCDecoderConfigurationRecord error")
+		vt.Publisher.Stop(zap.Error(err))
+		return
+	}
+	vt.updateParamaterSets()
+	vt.nalulenSize = int(record.LengthSizeMinusOne) + 1
+	vt.Video.WriteSequenceHead(head)
+	return
+}
+
+// WriteRTPFrame RFC 9328
+func (vt *H266) WriteRTPFrame(rtpItem *LIRTP) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			vt.Error("WriteRTPFrame panic", zap.Any("err", err))
+			vt.Publisher.Stop(zap.Any("err", err))
+		}
+	}()
+	frame := &rtpItem.Value
+	rv := vt.Value
+	rv.RTP.Push(rtpItem)
+	if len(frame.Payload) < 2 {
+		return
+	}
+	usingDonlField := vt.MaxDONDiff > 0
+	var buffer = util.Buffer(frame.Payload)
+	switch codec.ParseH266NALUType(frame.Payload[1]) {
+	case codec.H266_NAL_RTP_AP:
+		buffer.ReadUint16()
+		// 第一个聚合单元前是 DONL，之后每个聚合单元前是 DOND
+		donSize := 0
+		if usingDonlField {
+			donSize = 2
+		}
+		for buffer.CanRead() {
+			if !buffer.CanReadN(donSize + 2) {
+				return
+			}
+			buffer.ReadN(donSize)
+			if usingDonlField {
+				donSize = 1
+			}
+			l := int(buffer.ReadUint16())
+			if buffer.CanReadN(l) {
+				vt.WriteSliceBytes(buffer.ReadN(l))
+			} else {
+				return
+			}
+		}
+	case codec.H266_NAL_RTP_FU:
+		if !buffer.CanReadN(3) {
+			return
+		}
+		first3 := buffer.ReadN(3)
+		fuHeader := first3[2]
+		// DONL 只在第一个分片中
+		start := util.Bit1(fuHeader, 0)
+		if usingDonlField && start {
+			if !buffer.CanReadN(2) {
+				return
+			}
+			buffer.ReadUint16()
+		}
+		if naluType := fuHeader & 0b00011111; start {
+			vt.WriteSliceByte(first3[0], naluType<<3|first3[1]&0b111)
+		}
+		if rv.AUList.Pre != nil {
+			rv.AUList.Pre.Value.Push(vt.BytesPool.GetShell(buffer))
+		}
+	default:
+		if usingDonlField {
+			// 去掉负载头后面的 DONL，RTP 包原样保留给订阅者
+			if len(frame.Payload) < 4 {
+				return
+			}
+			vt.WriteSliceBytes(append([]byte{frame.Payload[0], frame.Payload[1]}, frame.Payload[4:]...))
+		} else {
+			vt.WriteSliceBytes(frame.Payload)
+		}
+	}
+	if frame.Marker {
+		vt.generateTimestamp(frame.Timestamp)
+		if !vt.dcChanged && rv.IFrame {
+			vt.insertDCRtp()
+		}
+		vt.Flush()
+	}
+}
+
+func (vt *H266) CompleteAVCC(rv *AVFrame) {
+	mem := vt.BytesPool.Get(8)
+	b := mem.Value
+	if rv.IFrame {
+		b[0] = 0b1001_0000 | byte(codec.PacketTypeCodedFrames)
+	} else {
+		b[0] = 0b1010_0000 | byte(codec.PacketTypeCodedFrames)
+	}
+	util.BigEndian.PutUint32(b[1:], codec.FourCC_H266_32)
+	// 写入CTS
+	util.PutBE(b[5:8], (rv.PTS-rv.DTS)/90)
+	rv.AVCC.Push(mem)
+	rv.AUList.Range(func(au *util.BLL) bool {
+		mem = vt.BytesPool.Get(4)
+		util.PutBE(mem.Value, uint32(au.ByteLength))
+		rv.AVCC.Push(mem)
+		au.Range(func(slice util.Buffer) bool {
+			rv.AVCC.Push(vt.BytesPool.GetShell(slice))
+			return true
+		})
+		return true
+	})
+}
+
+// RTP格式补完
+func (vt *H266) CompleteRTP(value *AVFrame) {
+	var out [][][]byte
+	if value.IFrame {
+		for _, ps := range vt.ParamaterSets {
+			out = append(out, [][]byte{ps})
+		}
+	}
+	vt.Value.AUList.Range(func(au *util.BLL) bool {
+		if au.ByteLength < RTPMTU {
+			out = append(out, au.ToBuffers())
+		} else {
+			startIndex := len(out)
+			r := au.NewReader()
+			b0, _ := r.ReadByte()
+			b1, _ := r.ReadByte()
+			naluType := codec.ParseH266NALUType(b1)
+			b1 = byte(codec.H266_NAL_RTP_FU)<<3 | b1&0b111
+			for bufs := r.ReadN(RTPMTU); len(bufs) > 0; bufs = r.ReadN(RTPMTU) {
+				out = append(out, append([][]byte{{b0, b1, byte(naluType)}}, bufs...))
+			}
+			out[startIndex][0][2] |= 1 << 7 // set start bit
+			out[len(out)-1][0][2] |= 1 << 6 // set end bit
+		}
+		return true
+	})
+	vt.PacketizeRTP(out...)
+}
+
+func (vt *H266) GetNALU_SEI() (item util.LIBP) {
+	item = vt.BytesPool.Get(2)
+	item.Value[0] = 0
+	item.Value[1] = byte(codec.H266_NAL_PREFIX_SEI)<<3 | 1
+	return
+}
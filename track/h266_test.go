@@ -0,0 +1,46 @@
+package track
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+	. "m7s.live/engine/v4/common"
+)
+
+func TestH266RTPDONL(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		maxDONDiff int
+		payloads   [][]byte
+		want       [][]byte
+	}{
+		{"single nal", 0, [][]byte{{0x00, 0x01, 1, 2}}, [][]byte{{0x00, 0x01, 1, 2}}},
+		{"single nal with donl", 1, [][]byte{{0x00, 0x01, 0, 5, 1, 2}}, [][]byte{{0x00, 0x01, 1, 2}}},
+		{"ap", 0, [][]byte{{0x00, 0xE1, 0, 3, 0x00, 0x39, 1, 0, 3, 0x00, 0x01, 2}}, [][]byte{{0x00, 0x39, 1}, {0x00, 0x01, 2}}},
+		// 第一个聚合单元前是 DONL，之后是 DOND
+		{"ap with donl", 1, [][]byte{{0x00, 0xE1, 0, 5, 0, 3, 0x00, 0x39, 1, 1, 0, 3, 0x00, 0x01, 2}}, [][]byte{{0x00, 0x39, 1}, {0x00, 0x01, 2}}},
+		{"fu", 0, [][]byte{{0x00, 0xE9, 0x80, 1}, {0x00, 0xE9, 0x40, 2}}, [][]byte{{0x00, 0x01, 1, 2}}},
+		// DONL 只在第一个分片中
+		{"fu with donl", 1, [][]byte{{0x00, 0xE9, 0x80, 0, 5, 1}, {0x00, 0xE9, 0x40, 2}}, [][]byte{{0x00, 0x01, 1, 2}}},
+	} {
+		vt := NewH266(nil)
+		vt.Init(8, NewAVFrame)
+		vt.MaxDONDiff = tt.maxDONDiff
+		for i, payload := range tt.payloads {
+			vt.WriteRTPFrame(&LIRTP{Value: RTPFrame{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i)}, Payload: payload}}})
+		}
+		var got [][]byte
+		for _, au := range vt.Value.AUList.ToList() {
+			got = append(got, bytes.Join(au, nil))
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %x, want %x", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], tt.want[i]) {
+				t.Errorf("%s: nalu %d got %x, want %x", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
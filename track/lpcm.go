@@ -0,0 +1,135 @@
+package track
+
+import (
+	"io"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*LPCM)(nil)
+
+// NewLPCM 线性 PCM（L16、L24），轨道内统一以大端存储，littleEndian 表示 WriteRawBytes 写入的数据是否为小端（如 wav 文件）
+func NewLPCM(puber IPuber, sampleSize byte, littleEndian bool, stuff ...any) (pcm *LPCM) {
+	pcm = &LPCM{littleEndian: littleEndian}
+	if sampleSize == 24 {
+		pcm.CodecID = codec.CodecID_L24
+		pcm.PayloadType = 96
+	} else {
+		sampleSize = 16
+		pcm.CodecID = codec.CodecID_L16
+		pcm.PayloadType = 10
+	}
+	pcm.SampleSize = sampleSize
+	pcm.Channels = 2
+	pcm.SetStuff(uint32(44100), pcm, stuff, puber)
+	if pcm.BytesPool == nil {
+		pcm.BytesPool = make(util.BytesPool, 17)
+	}
+	return
+}
+
+type LPCM struct {
+	Audio
+	littleEndian bool
+}
+
+// swapEndian 就地转换每个采样的字节序
+func swapEndian(b []byte, sampleBytes int) []byte {
+	for i := 0; i+sampleBytes <= len(b); i += sampleBytes {
+		b[i], b[i+sampleBytes-1] = b[i+sampleBytes-1], b[i]
+	}
+	return b
+}
+
+func (pcm *LPCM) sampleBytes() int {
+	return int(pcm.SampleSize / 8)
+}
+
+// WriteAVCC FLV 中的 Linear PCM 为小端，只支持16位
+func (pcm *LPCM) WriteAVCC(ts uint32, frame *util.BLL) error {
+	if l := frame.ByteLength; l < 3 {
+		pcm.Error("AVCC data too short", zap.Int("len", l))
+		return io.ErrShortWrite
+	}
+	data := frame.ToBytes()[1:]
+	pcm.Value.AUList.Push(pcm.BytesPool.GetShell(swapEndian(data, 2)))
+	pcm.Audio.WriteAVCC(ts, frame)
+	return nil
+}
+
+func (pcm *LPCM) WriteRawBytes(pts uint32, raw util.IBytes) {
+	if !pcm.littleEndian {
+		pcm.Audio.WriteRawBytes(pts, raw)
+		return
+	}
+	item := pcm.BytesPool.Get(raw.Len())
+	copy(item.Value, raw.Bytes())
+	pcm.Value.BytesIn += raw.Len()
+	pcm.Value.AUList.Push(item)
+	swapEndian(item.Value, pcm.sampleBytes())
+	pcm.generateTimestamp(pts)
+	pcm.Flush()
+}
+
+func (pcm *LPCM) WriteRTPFrame(rtpItem *LIRTP) {
+	frame := &rtpItem.Value
+	pcm.Value.RTP.Push(rtpItem)
+	if pcm.SampleRate != 90000 {
+		pcm.generateTimestamp(uint32(uint64(frame.Timestamp) * 90000 / uint64(pcm.SampleRate)))
+	}
+	pcm.AppendAuBytes(frame.Payload)
+	pcm.Flush()
+}
+
+// CompleteAVCC 转换为 FLV 的16位小端 Linear PCM，L24 只保留高16位
+func (pcm *LPCM) CompleteAVCC(value *AVFrame) {
+	if pcm.AVCCHead == nil {
+		var rate byte = 3
+		switch {
+		case pcm.SampleRate < 11025:
+			rate = 0
+		case pcm.SampleRate < 22050:
+			rate = 1
+		case pcm.SampleRate < 44100:
+			rate = 2
+		}
+		pcm.AVCCHead = []byte{(byte(codec.CodecID_L16) << 4) | (rate << 2) | (1 << 1)}
+		if pcm.Channels > 1 {
+			pcm.AVCCHead[0] |= 1
+		}
+	}
+	data := value.AUList.ToBytes()
+	if n := pcm.sampleBytes(); n == 3 {
+		j := 0
+		for i := 0; i+3 <= len(data); i += 3 {
+			data[j], data[j+1] = data[i+1], data[i]
+			j += 2
+		}
+		data = data[:j]
+	} else {
+		swapEndian(data, 2)
+	}
+	value.AVCC.Push(pcm.BytesPool.GetShell(pcm.AVCCHead))
+	value.AVCC.Push(pcm.BytesPool.GetShell(data))
+}
+
+// CompleteRTP 按照采样对齐分包
+func (pcm *LPCM) CompleteRTP(value *AVFrame) {
+	frameSize := pcm.sampleBytes() * int(pcm.Channels)
+	if frameSize == 0 {
+		frameSize = pcm.sampleBytes()
+	}
+	if size := RTPMTU - RTPMTU%frameSize; value.AUList.ByteLength > size {
+		var packets [][][]byte
+		r := value.AUList.NewReader()
+		for bufs := r.ReadN(size); len(bufs) > 0; bufs = r.ReadN(size) {
+			packets = append(packets, bufs)
+		}
+		pcm.PacketizeRTP(packets...)
+	} else {
+		pcm.Audio.CompleteRTP(value)
+	}
+}
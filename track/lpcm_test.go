@@ -0,0 +1,81 @@
+package track
+
+import (
+	"bytes"
+	"testing"
+
+	. "m7s.live/engine/v4/common"
+)
+
+func TestSwapEndian(t *testing.T) {
+	for _, tt := range []struct {
+		sampleBytes int
+		in, want    []byte
+	}{
+		{2, []byte{1, 2, 3, 4}, []byte{2, 1, 4, 3}},
+		{3, []byte{1, 2, 3, 4, 5, 6}, []byte{3, 2, 1, 6, 5, 4}},
+		// 不足一个采样的尾部保持不变
+		{2, []byte{1, 2, 3}, []byte{2, 1, 3}},
+	} {
+		if got := swapEndian(append([]byte(nil), tt.in...), tt.sampleBytes); !bytes.Equal(got, tt.want) {
+			t.Errorf("%d bytes %x: got %x, want %x", tt.sampleBytes, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLPCMCompleteAVCC(t *testing.T) {
+	pcm := NewLPCM(nil, 24, false)
+	pcm.Init(8, NewAVFrame)
+	pcm.SampleRate, pcm.Channels = 48000, 2
+	// 大端 24 位采样，FLV 中为小端 16 位，只保留高16位
+	pcm.AppendAuBytes([]byte{0x12, 0x34, 0x56, 0xab, 0xcd, 0xef})
+	pcm.CompleteAVCC(pcm.Value)
+	want := []byte{0x3f, 0x34, 0x12, 0xcd, 0xab}
+	if got := pcm.Value.AVCC.ToBytes(); !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
+
+func TestLPCMCompleteRTP(t *testing.T) {
+	pcm := NewLPCM(nil, 16, false)
+	pcm.Init(8, NewAVFrame)
+	// 多个 AU 的总长度超过 MTU，需要按照采样对齐拆包并且包含所有 AU
+	var want []byte
+	for i := 0; i < 3; i++ {
+		au := bytes.Repeat([]byte{byte(i + 1)}, 600)
+		want = append(want, au...)
+		pcm.AppendAuBytes(au)
+	}
+	pcm.CompleteRTP(pcm.Value)
+	var got []byte
+	pcm.Value.RTP.Range(func(packet RTPFrame) bool {
+		if len(packet.Payload)%4 != 0 || len(packet.Payload) > RTPMTU {
+			t.Errorf("payload size %d", len(packet.Payload))
+		}
+		got = append(got, packet.Payload...)
+		return true
+	})
+	if pcm.Value.RTP.Length < 2 || !bytes.Equal(got, want) {
+		t.Fatalf("packets %d, payload %d bytes", pcm.Value.RTP.Length, len(got))
+	}
+}
+
+func TestG722CompleteRTP(t *testing.T) {
+	g722 := NewG722(nil)
+	g722.Init(8, NewAVFrame)
+	// RTP 时钟频率为8000，1秒对应8000
+	g722.Value.PTS = 90000
+	g722.AppendAuBytes(bytes.Repeat([]byte{1}, 1000), bytes.Repeat([]byte{2}, 1000))
+	g722.CompleteRTP(g722.Value)
+	var size int
+	g722.Value.RTP.Range(func(packet RTPFrame) bool {
+		if packet.Timestamp != 8000 || packet.PayloadType != 9 {
+			t.Errorf("timestamp %d payload type %d", packet.Timestamp, packet.PayloadType)
+		}
+		size += len(packet.Payload)
+		return true
+	})
+	if size != 2000 {
+		t.Fatalf("payload %d bytes", size)
+	}
+}
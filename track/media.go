@@ -1,6 +1,9 @@
 package track
 
 import (
+	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -75,18 +78,39 @@ type IDRingList struct {
 	IDRList     util.List[*util.Ring[*AVFrame]]
 	IDRing      *util.Ring[*AVFrame]
 	HistoryRing *util.Ring[*AVFrame]
+	idrLock     sync.RWMutex // 发布者修改 IDRList，订阅者查找时光回溯的起点
 }
 
 func (p *IDRingList) AddIDR(IDRing *util.Ring[*AVFrame]) {
+	p.idrLock.Lock()
+	defer p.idrLock.Unlock()
 	p.IDRList.PushValue(IDRing)
 	p.IDRing = IDRing
 }
 
 func (p *IDRingList) ShiftIDR() {
+	p.idrLock.Lock()
+	defer p.idrLock.Unlock()
 	p.IDRList.Shift()
 	p.HistoryRing = p.IDRList.Next.Value
 }
 
+// rangeIDR 在读锁内遍历关键帧，供订阅者协程使用
+func (p *IDRingList) rangeIDR(f func(*util.Ring[*AVFrame]) bool) {
+	p.idrLock.RLock()
+	defer p.idrLock.RUnlock()
+	p.IDRList.Range(f)
+}
+
+// DVRWindow 时光回溯可用的范围
+type DVRWindow struct {
+	Start     time.Time     // 最早的关键帧写入时间
+	End       time.Time     // 最新帧的写入时间
+	Duration  time.Duration // 可回溯的时长
+	Keyframes int           // 可定位的关键帧数量
+	Spilled   int           // 其中已落盘的关键帧数量
+}
+
 // Media 基础媒体Track类
 type Media struct {
 	Base[any, *AVFrame]
@@ -101,6 +125,10 @@ type Media struct {
 	SequenceHeadSeq int
 	RTPDemuxer
 	SpesificTrack  `json:"-" yaml:"-"`
+	DVR            *DVRWindow `json:",omitempty" yaml:",omitempty"` //时光回溯范围，仅在配置了缓冲时间时有效
+	DVRSpill       *DVRSpill  `json:"-" yaml:"-"`                   //时光回溯落盘
+	dvrPath        string
+	dvrTime        time.Duration
 	deltaTs        time.Duration //用于接续发布后时间戳连续
 	iframeReceived bool
 	流速控制
@@ -144,6 +172,80 @@ func (av *Media) SnapForJson() {
 			av.RawPart = append(av.RawPart, int(b))
 		}
 	}
+	if h := av.HistoryRing; av.BufferTime > 0 && h != nil {
+		if av.DVR == nil {
+			av.DVR = &DVRWindow{}
+		}
+		av.DVR.Start = h.Value.WriteTime
+		av.DVR.End = v.WriteTime
+		av.DVR.Duration = deltaTS(v.Timestamp, h.Value.Timestamp)
+		av.DVR.Keyframes = av.IDRList.Length
+		if av.DVRSpill != nil {
+			if start, count := av.DVRSpill.Range(); count > 0 {
+				av.DVR.Start = start
+				av.DVR.Duration = v.WriteTime.Sub(start)
+				av.DVR.Keyframes += count
+				av.DVR.Spilled = count
+			}
+		}
+	}
+}
+
+// seekSequence 查找序号在 seq 之后的第一个关键帧，用于从磁盘读取追上内存缓冲
+func (av *Media) seekSequence(seq uint32) (ring *util.Ring[*AVFrame]) {
+	av.rangeIDR(func(idr *util.Ring[*AVFrame]) bool {
+		ring = idr
+		return int32(idr.Value.Sequence-seq) <= 0
+	})
+	return
+}
+
+// spillGOP 将即将移出缓冲的最早的 GOP 交给落盘协程，这里只给帧加读锁，不做编码
+func (av *Media) spillGOP() {
+	if av.DVRSpill == nil {
+		var streamPath string
+		if av.Publisher != nil && av.Publisher.GetStream() != nil {
+			streamPath = av.Publisher.GetStream().GetPath()
+		}
+		dir := filepath.Join(av.dvrPath, streamPath, fmt.Sprintf("%s_%d", av.Name, time.Now().UnixMilli()))
+		spill, err := newDVRSpill(dir, av.dvrTime, av.Zap)
+		if err != nil {
+			av.Error("dvr spill", zap.Error(err))
+			av.dvrPath = ""
+			return
+		}
+		av.DVRSpill = spill
+		av.Info("dvr spill", zap.String("dir", dir))
+	}
+	from, to := av.IDRList.Next.Value, av.IDRList.Next.Next.Value
+	var frames []*AVFrame
+	for r := from; r != to; r = r.Next() {
+		r.Value.ReaderEnter()
+		frames = append(frames, r.Value)
+	}
+	av.DVRSpill.AppendGOP(frames)
+}
+
+func (av *Media) Dispose() {
+	av.Base.Dispose()
+	if av.DVRSpill != nil {
+		av.DVRSpill.Close()
+	}
+}
+
+// SeekIDR 查找写入时间在 t 之前最近的关键帧，t 早于缓冲范围时返回最早的关键帧，未配置缓冲时间时返回 nil
+func (av *Media) SeekIDR(t time.Time) (ring *util.Ring[*AVFrame]) {
+	if av.BufferTime == 0 {
+		return
+	}
+	av.rangeIDR(func(idr *util.Ring[*AVFrame]) bool {
+		if ring != nil && idr.Value.WriteTime.After(t) {
+			return false
+		}
+		ring = idr
+		return true
+	})
+	return
 }
 
 func (av *Media) SetSpeedLimit(value time.Duration) {
@@ -157,6 +259,7 @@ func (av *Media) SetStuff(stuff ...any) {
 		case IPuber:
 			pubConf := v.GetConfig()
 			av.BufferTime = pubConf.BufferTime
+			av.dvrPath, av.dvrTime = pubConf.DVRPath, pubConf.DVRTime
 			av.Base.SetStuff(v)
 			av.Init(256, NewAVFrame)
 			av.SSRC = uint32(uintptr(unsafe.Pointer(av)))
@@ -278,6 +381,9 @@ func (av *Media) Flush() {
 	}
 	bufferTime := av.BufferTime
 	if bufferTime > 0 && av.IDRingList.IDRList.Length > 1 && deltaTS(curValue.Timestamp, av.IDRingList.IDRList.Next.Next.Value.Value.Timestamp) > bufferTime {
+		if av.dvrPath != "" {
+			av.spillGOP()
+		}
 		av.ShiftIDR()
 		if canReduce := int(curValue.Sequence-av.HistoryRing.Value.Sequence) - 5; canReduce > 0 {
 			av.narrow(canReduce)
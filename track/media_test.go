@@ -0,0 +1,68 @@
+package track
+
+import (
+	"testing"
+	"time"
+
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+func TestSeekIDR(t *testing.T) {
+	var m Media
+	if m.SeekIDR(time.Now()) != nil {
+		t.Fatal("expect nil without keyframes")
+	}
+	base := time.Now()
+	for i := 0; i < 3; i++ {
+		var frame AVFrame
+		frame.WriteTime = base.Add(time.Duration(i) * 10 * time.Second)
+		m.IDRingList.AddIDR(&util.Ring[*AVFrame]{Value: &frame})
+	}
+	if m.SeekIDR(base.Add(15*time.Second)) != nil {
+		t.Fatal("expect nil without bufferTime")
+	}
+	m.BufferTime = time.Minute
+	for _, c := range []struct {
+		seek time.Duration
+		want time.Duration
+	}{
+		{-5 * time.Second, 0}, // 早于缓冲范围时从最早的关键帧开始
+		{0, 0},
+		{15 * time.Second, 10 * time.Second},
+		{20 * time.Second, 20 * time.Second},
+		{time.Minute, 20 * time.Second},
+	} {
+		if got := m.SeekIDR(base.Add(c.seek)).Value.WriteTime.Sub(base); got != c.want {
+			t.Errorf("seek %v: got %v, want %v", c.seek, got, c.want)
+		}
+	}
+}
+
+// TestSeekIDRConcurrent 发布者增删关键帧的同时订阅者查找，配合 -race 检查
+func TestSeekIDRConcurrent(t *testing.T) {
+	var m Media
+	m.BufferTime = time.Minute
+	base := time.Now()
+	for i := 0; i < 3; i++ {
+		var frame AVFrame
+		frame.WriteTime = base.Add(time.Duration(i) * time.Second)
+		m.IDRingList.AddIDR(&util.Ring[*AVFrame]{Value: &frame})
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 3; i < 1000; i++ {
+			var frame AVFrame
+			frame.WriteTime = base.Add(time.Duration(i) * time.Second)
+			m.IDRingList.AddIDR(&util.Ring[*AVFrame]{Value: &frame})
+			m.ShiftIDR()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if m.SeekIDR(base.Add(time.Duration(i)*time.Second)) == nil {
+			t.Fatal("expect keyframe")
+		}
+	}
+	<-done
+}
@@ -0,0 +1,168 @@
+package track
+
+import (
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*MPA)(nil)
+
+// NewMPA MPEG-1/2 音频（MP2、MP3），编码类型和声道数以收到的帧头为准
+// RTP 时钟频率按照 RFC 3551 为90000，这里 SampleRate 记录的是 RTP 时钟频率，实际采样率见 Header.SampleRate
+func NewMPA(puber IPuber, stuff ...any) (mpa *MPA) {
+	mpa = &MPA{}
+	mpa.CodecID = codec.CodecID_MP3
+	mpa.SampleSize = 16
+	mpa.Channels = 2
+	mpa.AVCCHead = []byte{(byte(codec.CodecID_MP3) << 4) | (3 << 2) | (1 << 1) | 1}
+	mpa.SetStuff(uint32(90000), byte(14), mpa, stuff, puber)
+	if mpa.BytesPool == nil {
+		mpa.BytesPool = make(util.BytesPool, 17)
+	}
+	return
+}
+
+type MPA struct {
+	Audio
+	Header    codec.MPEGAudioHeader
+	fragments []byte // RFC 2250 中被分片的帧
+}
+
+// parseHeader 解析帧头，更新编码类型、声道数以及 FLV 的音频头
+func (mpa *MPA) parseHeader(b []byte) error {
+	h, err := codec.ParseMPEGAudioHeader(b)
+	if err != nil {
+		return err
+	}
+	if h.Layer == 3 {
+		mpa.CodecID = codec.CodecID_MP3
+	} else {
+		mpa.CodecID = codec.CodecID_MP2
+	}
+	mpa.Header = h
+	mpa.Channels = h.Channels
+	// FLV 只有 MP3 一种格式，MP2 也沿用
+	var rate byte = 3
+	switch {
+	case h.SampleRate < 16000:
+		rate = 1
+	case h.SampleRate < 32000:
+		rate = 2
+	}
+	mpa.AVCCHead = []byte{(byte(codec.CodecID_MP3) << 4) | (rate << 2) | (1 << 1) | (h.Channels - 1)}
+	return nil
+}
+
+func (mpa *MPA) WriteAVCC(ts uint32, frame *util.BLL) error {
+	if l := frame.ByteLength; l < 5 {
+		mpa.Error("AVCC data too short", zap.Int("len", l))
+		return io.ErrShortWrite
+	}
+	if err := mpa.parseHeader([]byte{frame.GetByte(1), frame.GetByte(2), frame.GetByte(3), frame.GetByte(4)}); err != nil {
+		mpa.Error("mpeg audio header error", zap.Error(err))
+		return err
+	}
+	i := 0
+	frame.Range(func(v util.Buffer) bool {
+		if i == 0 {
+			v = v.SubBuf(1, v.Len()-1)
+		}
+		mpa.Value.AUList.Push(mpa.BytesPool.GetShell(v))
+		i++
+		return true
+	})
+	mpa.Audio.WriteAVCC(ts, frame)
+	return nil
+}
+
+// WriteRawBytes 一个 PES 中可能包含多个帧，按帧切分后作为一个 AVFrame 写入
+func (mpa *MPA) WriteRawBytes(pts uint32, raw util.IBytes) {
+	data := raw.Bytes()
+	if err := mpa.parseHeader(data); err != nil {
+		mpa.Error("mpeg audio header error", zap.Error(err))
+		return
+	}
+	mpa.Value.BytesIn += len(data)
+	for _, frame := range codec.SplitMPEGAudioFrames(data) {
+		mpa.AppendAuBytes(frame)
+	}
+	mpa.generateTimestamp(pts)
+	mpa.Flush()
+}
+
+// WriteRTPFrame RFC 2250，负载前4个字节中后两个字节为分片偏移，时钟固定为90000
+func (mpa *MPA) WriteRTPFrame(rtpItem *LIRTP) {
+	frame := &rtpItem.Value
+	mpa.Value.RTP.Push(rtpItem)
+	if len(frame.Payload) <= 4 {
+		return
+	}
+	offset := int(util.ReadBE[uint16](frame.Payload[2:4]))
+	payload := frame.Payload[4:]
+	if offset == 0 {
+		mpa.fragments = nil
+		if err := mpa.parseHeader(payload); err != nil {
+			mpa.Warn("mpeg audio header error", zap.Error(err))
+			return
+		}
+		if mpa.Header.FrameLength == 0 || len(payload) >= mpa.Header.FrameLength {
+			for _, f := range codec.SplitMPEGAudioFrames(payload) {
+				mpa.AppendAuBytes(f)
+			}
+		} else {
+			mpa.fragments = append([]byte(nil), payload...)
+			return
+		}
+	} else {
+		if offset != len(mpa.fragments) {
+			// 丢包导致分片不完整，丢弃整帧
+			mpa.fragments = nil
+			return
+		}
+		mpa.fragments = append(mpa.fragments, payload...)
+		if len(mpa.fragments) < mpa.Header.FrameLength {
+			return
+		}
+		mpa.AppendAuBytes(mpa.fragments)
+		mpa.fragments = nil
+	}
+	mpa.generateTimestamp(frame.Timestamp)
+	mpa.Flush()
+}
+
+// CompleteRTP 每个包只含一帧，超过 MTU 的帧分片，时间戳使用90000时钟
+func (mpa *MPA) CompleteRTP(value *AVFrame) {
+	var packets [][][]byte
+	var timestamps []uint32
+	pts := value.PTS
+	value.AUList.Range(func(au *util.BLL) bool {
+		r := au.NewReader()
+		offset := 0
+		for bufs := r.ReadN(RTPMTU); len(bufs) > 0; bufs = r.ReadN(RTPMTU) {
+			packets = append(packets, append([][]byte{{0, 0, byte(offset >> 8), byte(offset)}}, bufs...))
+			timestamps = append(timestamps, uint32(pts))
+			for _, b := range bufs {
+				offset += len(b)
+			}
+		}
+		if mpa.Header.SampleRate > 0 {
+			pts += time.Duration(mpa.Header.SamplesPerFrame * 90000 / mpa.Header.SampleRate)
+		}
+		return true
+	})
+	if len(packets) == 0 {
+		return
+	}
+	mpa.PacketizeRTP(packets...)
+	i := 0
+	value.RTP.Range(func(packet RTPFrame) bool {
+		packet.Timestamp = timestamps[i]
+		i++
+		return true
+	})
+}
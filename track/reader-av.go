@@ -7,6 +7,7 @@ import (
 	"go.uber.org/zap"
 	"m7s.live/engine/v4/common"
 	"m7s.live/engine/v4/log"
+	"m7s.live/engine/v4/util"
 )
 
 const (
@@ -38,6 +39,9 @@ type AVRingReader struct {
 	startTime  time.Time
 	AbsTime    uint32
 	Delay      uint32
+	SeekTime   time.Time //时光回溯，从该时间之前最近的关键帧开始读取
+	timeshift  bool
+	dvr        *DVRCursor //正在读取落盘的数据
 	*log.Logger
 }
 
@@ -52,13 +56,30 @@ func NewAVRingReader(t *Media) *AVRingReader {
 	}
 }
 
+// readDVR 读取落盘的数据，读完后切换到内存缓冲中的下一个关键帧
+func (r *AVRingReader) readDVR() (err error) {
+	if frame := r.dvr.Next(); frame != nil {
+		return r.Read(&util.Ring[*common.AVFrame]{Value: frame})
+	}
+	r.dvr = nil
+	ring := r.Track.seekSequence(r.Value.Sequence)
+	if ring == nil {
+		ring = r.Track.Ring
+	}
+	r.Info("dvr catch up", zap.Uint32("seq", r.Value.Sequence), zap.Uint32("next", ring.Value.Sequence))
+	return r.Read(ring)
+}
+
 func (r *AVRingReader) readFrame() (err error) {
+	if r.dvr != nil {
+		return r.readDVR()
+	}
 	err = r.ReadNext()
 	if err != nil {
 		return err
 	}
 	// 超过一半的缓冲区大小，说明Reader太慢，需要丢帧
-	if r.mode != SUBMODE_BUFFER && r.State == READSTATE_NORMAL && r.Track.LastValue.Sequence-r.Value.Sequence > uint32(r.Track.Size/2) && r.Track.IDRing != nil && r.Track.IDRing.Value.Sequence > r.Value.Sequence {
+	if r.mode != SUBMODE_BUFFER && !r.timeshift && r.State == READSTATE_NORMAL && r.Track.LastValue.Sequence-r.Value.Sequence > uint32(r.Track.Size/2) && r.Track.IDRing != nil && r.Track.IDRing.Value.Sequence > r.Value.Sequence {
 		r.Warn("reader too slow", zap.Uint32("lastSeq", r.Track.LastValue.Sequence), zap.Uint32("seq", r.Value.Sequence))
 		return r.Read(r.Track.IDRing)
 	}
@@ -99,6 +120,35 @@ func (r *AVRingReader) ReadFrame(mode int) (err error) {
 				r.State = READSTATE_WAITKEY
 			}
 		}
+		if h := r.Track.HistoryRing; !r.SeekTime.IsZero() && h != nil && r.Track.DVRSpill != nil && r.SeekTime.Before(h.Value.WriteTime) {
+			// 请求的时间早于内存缓冲，从磁盘读取
+			if r.dvr = r.Track.DVRSpill.Seek(r.SeekTime); r.dvr != nil {
+				if frame := r.dvr.Next(); frame != nil {
+					startRing = &util.Ring[*common.AVFrame]{Value: frame}
+					r.State = READSTATE_NORMAL
+					r.timeshift = true
+					r.Info("timeshift from dvr spill", zap.Time("seek", r.SeekTime), zap.Time("keyframe", frame.WriteTime))
+				} else {
+					r.dvr = nil
+				}
+			}
+		}
+		if !r.SeekTime.IsZero() && r.dvr == nil {
+			if idr := r.Track.SeekIDR(r.SeekTime); idr != nil {
+				startRing = idr
+				r.State = READSTATE_NORMAL
+				r.timeshift = true
+				if idr.Value.WriteTime.After(r.SeekTime) {
+					// 请求的时间早于缓冲范围，从最早的关键帧开始
+					r.Warn("timeshift before buffer", zap.Time("seek", r.SeekTime), zap.Time("keyframe", idr.Value.WriteTime))
+				} else {
+					r.Info("timeshift", zap.Time("seek", r.SeekTime), zap.Time("keyframe", idr.Value.WriteTime))
+				}
+			} else {
+				// 未配置缓冲时间，从实时位置开始读取
+				r.Warn("timeshift need bufferTime", zap.Time("seek", r.SeekTime), zap.Duration("bufferTime", r.Track.BufferTime))
+			}
+		}
 		if err = r.StartRead(startRing); err != nil {
 			return
 		}
@@ -131,7 +181,7 @@ func (r *AVRingReader) ReadFrame(mode int) (err error) {
 		if err = r.readFrame(); err != nil {
 			return
 		}
-		if mode == SUBMODE_NOJUMP {
+		if mode == SUBMODE_NOJUMP || r.timeshift {
 			if fast := r.Value.Timestamp - r.FirstTs - time.Since(r.startTime); fast > 0 && fast < time.Second {
 				time.Sleep(fast)
 			}
@@ -295,3 +295,32 @@ Access Unit的首个nalu是4字节起始码。
 I0(slice0)是序列第一帧（I帧）的第一个slice，是当前Access Unit的首个nalu，所以是4字节头。而I0(slice1)表示第一帧的第二个slice，所以是3字节头。P1(slice0) 、P1(slice1)同理。
 
 */
+
+// completeExtAVCC 按照 enhanced-rtmp 的格式补完 AVCC，帧数据不需要长度前缀
+func (vt *Video) completeExtAVCC(rv *AVFrame, fourCC uint32) {
+	mem := vt.BytesPool.Get(5)
+	b := mem.Value
+	if rv.IFrame {
+		b[0] = 0b1001_0000 | byte(codec.PacketTypeCodedFrames)
+	} else {
+		b[0] = 0b1010_0000 | byte(codec.PacketTypeCodedFrames)
+	}
+	util.BigEndian.PutUint32(b[1:], fourCC)
+	rv.AVCC.Push(mem)
+	rv.AUList.Range(func(au *util.BLL) bool {
+		au.Range(func(slice util.Buffer) bool {
+			rv.AVCC.Push(vt.BytesPool.GetShell(slice))
+			return true
+		})
+		return true
+	})
+}
+
+// packetizeEncoded 使用编码器生成的负载，时间戳和序号由轨道统一填写
+func (vt *Video) packetizeEncoded(packets []*rtp.Packet) {
+	payloads := make([][][]byte, len(packets))
+	for i, packet := range packets {
+		payloads[i] = [][]byte{packet.Payload}
+	}
+	vt.PacketizeRTP(payloads...)
+}
@@ -0,0 +1,108 @@
+package track
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpvp8"
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*VP8)(nil)
+
+type VP8 struct {
+	Video
+	decoder rtpvp8.Decoder
+	encoder rtpvp8.Encoder
+	record  codec.VPCodecConfigurationRecord
+}
+
+func NewVP8(puber IPuber, stuff ...any) (vt *VP8) {
+	vt = &VP8{record: codec.NewVPCodecConfigurationRecord()}
+	vt.Video.CodecID = codec.CodecID_VP8
+	vt.SetStuff("vp8", byte(96), uint32(90000), vt, stuff, puber)
+	if vt.BytesPool == nil {
+		vt.BytesPool = make(util.BytesPool, 17)
+	}
+	vt.nalulenSize = 0
+	vt.dtsEst = util.NewDTSEstimator()
+	vt.decoder.Init()
+	vt.encoder.PayloadMaxSize = RTPMTU
+	vt.encoder.Init()
+	return
+}
+
+func (vt *VP8) WriteSequenceHead(head []byte) (err error) {
+	vt.Video.WriteSequenceHead(head)
+	if len(head) > 5 {
+		err = vt.record.Unmarshal(head[5:])
+	}
+	return
+}
+
+// parseFrame 判断关键帧并从关键帧中解析分辨率，分辨率变化时重新生成序列头
+func (vt *VP8) parseFrame(frame []byte) error {
+	keyFrame, width, height, err := codec.ParseVP8Frame(frame)
+	if err != nil {
+		return err
+	}
+	vt.Value.IFrame = keyFrame
+	if keyFrame && (vt.SequenceHeadSeq == 0 || width != vt.Width || height != vt.Height) {
+		vt.Width, vt.Height = width, height
+		vt.Video.WriteSequenceHead(codec.VPSequenceHead(codec.FourCC_VP8_32, &vt.record))
+	}
+	return nil
+}
+
+func (vt *VP8) WriteRTPFrame(rtpItem *LIRTP) {
+	if vt.lastSeq != vt.lastSeq2+1 && vt.lastSeq2 != 0 {
+		vt.lostFlag = true
+		vt.Warn("lost rtp packet", zap.Uint16("lastSeq", vt.lastSeq), zap.Uint16("lastSeq2", vt.lastSeq2))
+	}
+	frame := &rtpItem.Value
+	vt.Value.RTP.Push(rtpItem)
+	data, err := vt.decoder.Decode(frame.Packet)
+	if err == rtpvp8.ErrMorePacketsNeeded {
+		return
+	}
+	if err == nil {
+		err = vt.parseFrame(data)
+	}
+	if err != nil {
+		vt.Debug("vp8 rtp decode", zap.Error(err))
+		vt.lostFlag = true
+		return
+	}
+	vt.AppendAuBytes(data)
+	vt.generateTimestamp(frame.Timestamp)
+	vt.Flush()
+}
+
+func (vt *VP8) writeAVCCFrame(ts uint32, r *util.BLLReader, frame *util.BLL) (err error) {
+	vt.Value.PTS = time.Duration(ts) * 90
+	vt.Value.DTS = time.Duration(ts) * 90
+	data := r.ReadN(frame.ByteLength)
+	if vt.Value.IFrame {
+		if err = vt.parseFrame(util.ConcatBuffers(data)); err != nil {
+			return
+		}
+	}
+	vt.AppendAuBytes(data...)
+	return
+}
+
+func (vt *VP8) CompleteAVCC(rv *AVFrame) {
+	vt.completeExtAVCC(rv, codec.FourCC_VP8_32)
+}
+
+// RTP格式补完
+func (vt *VP8) CompleteRTP(value *AVFrame) {
+	packets, err := vt.encoder.Encode(value.AUList.ToBytes())
+	if err != nil {
+		vt.Error("VP8 encoder encode error", zap.Error(err))
+		return
+	}
+	vt.packetizeEncoded(packets)
+}
@@ -0,0 +1,122 @@
+package track
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpvp9"
+	"github.com/bluenviron/mediacommon/pkg/codecs/vp9"
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+	"m7s.live/engine/v4/util"
+)
+
+var _ SpesificTrack = (*VP9)(nil)
+
+type VP9 struct {
+	Video
+	decoder rtpvp9.Decoder
+	encoder rtpvp9.Encoder
+	record  codec.VPCodecConfigurationRecord
+}
+
+func NewVP9(puber IPuber, stuff ...any) (vt *VP9) {
+	vt = &VP9{record: codec.NewVPCodecConfigurationRecord()}
+	vt.Video.CodecID = codec.CodecID_VP9
+	vt.SetStuff("vp9", byte(96), uint32(90000), vt, stuff, puber)
+	if vt.BytesPool == nil {
+		vt.BytesPool = make(util.BytesPool, 17)
+	}
+	vt.nalulenSize = 0
+	vt.dtsEst = util.NewDTSEstimator()
+	vt.decoder.Init()
+	vt.encoder.PayloadMaxSize = RTPMTU
+	vt.encoder.Init()
+	return
+}
+
+func (vt *VP9) WriteSequenceHead(head []byte) (err error) {
+	vt.Video.WriteSequenceHead(head)
+	if len(head) > 5 {
+		err = vt.record.Unmarshal(head[5:])
+	}
+	return
+}
+
+// parseFrame 解析帧头（超级帧取第一帧），关键帧中带有分辨率和色彩配置，变化时重新生成序列头
+func (vt *VP9) parseFrame(frame []byte) error {
+	var header vp9.Header
+	if err := header.Unmarshal(frame); err != nil {
+		return err
+	}
+	keyFrame := !header.ShowExistingFrame && header.FrameType == vp9.FrameTypeKeyFrame
+	vt.Value.IFrame = keyFrame
+	if !keyFrame {
+		return nil
+	}
+	width, height := uint(header.Width()), uint(header.Height())
+	record := vt.record
+	record.Profile = header.Profile
+	record.BitDepth = header.ColorConfig.BitDepth
+	record.ChromaSubsampling = header.ChromaSubsampling()
+	record.VideoFullRangeFlag = 0
+	if header.ColorConfig.ColorRange {
+		record.VideoFullRangeFlag = 1
+	}
+	if vt.SequenceHeadSeq == 0 || width != vt.Width || height != vt.Height || record != vt.record {
+		vt.Width, vt.Height, vt.record = width, height, record
+		vt.Video.WriteSequenceHead(codec.VPSequenceHead(codec.FourCC_VP9_32, &vt.record))
+	}
+	return nil
+}
+
+func (vt *VP9) WriteRTPFrame(rtpItem *LIRTP) {
+	if vt.lastSeq != vt.lastSeq2+1 && vt.lastSeq2 != 0 {
+		vt.lostFlag = true
+		vt.Warn("lost rtp packet", zap.Uint16("lastSeq", vt.lastSeq), zap.Uint16("lastSeq2", vt.lastSeq2))
+	}
+	frame := &rtpItem.Value
+	vt.Value.RTP.Push(rtpItem)
+	data, err := vt.decoder.Decode(frame.Packet)
+	if err == rtpvp9.ErrMorePacketsNeeded {
+		return
+	}
+	if err == nil {
+		err = vt.parseFrame(data)
+	}
+	if err != nil {
+		vt.Debug("vp9 rtp decode", zap.Error(err))
+		vt.lostFlag = true
+		return
+	}
+	vt.AppendAuBytes(data)
+	vt.generateTimestamp(frame.Timestamp)
+	vt.Flush()
+}
+
+func (vt *VP9) writeAVCCFrame(ts uint32, r *util.BLLReader, frame *util.BLL) (err error) {
+	vt.Value.PTS = time.Duration(ts) * 90
+	vt.Value.DTS = time.Duration(ts) * 90
+	data := r.ReadN(frame.ByteLength)
+	if vt.Value.IFrame {
+		if err = vt.parseFrame(util.ConcatBuffers(data)); err != nil {
+			return
+		}
+	}
+	vt.AppendAuBytes(data...)
+	return
+}
+
+func (vt *VP9) CompleteAVCC(rv *AVFrame) {
+	vt.completeExtAVCC(rv, codec.FourCC_VP9_32)
+}
+
+// RTP格式补完
+func (vt *VP9) CompleteRTP(value *AVFrame) {
+	packets, err := vt.encoder.Encode(value.AUList.ToBytes())
+	if err != nil {
+		vt.Error("VP9 encoder encode error", zap.Error(err))
+		return
+	}
+	vt.packetizeEncoded(packets)
+}
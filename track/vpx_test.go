@@ -0,0 +1,106 @@
+package track
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpvp8"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpvp9"
+	"github.com/pion/rtp"
+	"m7s.live/engine/v4/codec"
+	. "m7s.live/engine/v4/common"
+)
+
+// testVPFrame 在帧头后补足数据，使一帧需要拆成多个 RTP 包
+func testVPFrame(header ...byte) []byte {
+	return append(header, bytes.Repeat([]byte{0x5a}, RTPMTU*2)...)
+}
+
+func TestVP8RTPKeyFrame(t *testing.T) {
+	vt := NewVP8(nil)
+	vt.Init(8, NewAVFrame)
+	frame := testVPFrame(0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01)
+	packets, err := vt.encoder.Encode(frame)
+	if err != nil || len(packets) < 2 {
+		t.Fatalf("encode %d %v", len(packets), err)
+	}
+	// 负载描述符：第一个包设置 S 位，其余不设置
+	for i, packet := range packets {
+		if start := packet.Payload[0]&0x10 != 0; start != (i == 0) {
+			t.Fatalf("packet %d descriptor %x", i, packet.Payload[0])
+		}
+	}
+	data := decodeVPPackets(t, packets, vt.decoder.Decode, rtpvp8.ErrMorePacketsNeeded)
+	if !bytes.Equal(data, frame) {
+		t.Fatal("depacketized frame mismatch")
+	}
+	if err := vt.parseFrame(data); err != nil {
+		t.Fatal(err)
+	}
+	if !vt.Value.IFrame || vt.Width != 640 || vt.Height != 480 || vt.SequenceHeadSeq != 1 {
+		t.Fatalf("key frame %v %dx%d seq %d", vt.Value.IFrame, vt.Width, vt.Height, vt.SequenceHeadSeq)
+	}
+	// 分辨率不变时不重新生成序列头
+	vt.parseFrame(frame)
+	if err := vt.parseFrame([]byte{0x31, 0x02, 0x00}); err != nil || vt.Value.IFrame || vt.SequenceHeadSeq != 1 {
+		t.Fatalf("inter frame %v seq %d %v", vt.Value.IFrame, vt.SequenceHeadSeq, err)
+	}
+}
+
+func TestVP9RTPKeyFrame(t *testing.T) {
+	vt := NewVP9(nil)
+	vt.Init(8, NewAVFrame)
+	// profile 0 关键帧，BT.709，640x480
+	frame := testVPFrame(0x82, 0x49, 0x83, 0x42, 0x40, 0x27, 0xf0, 0x1d, 0xf0)
+	packets, err := vt.encoder.Encode(frame)
+	if err != nil || len(packets) < 2 {
+		t.Fatalf("encode %d %v", len(packets), err)
+	}
+	// 负载描述符：第一个包设置 B 位，最后一个包设置 E 位
+	for i, packet := range packets {
+		begin, end := packet.Payload[0]&0x08 != 0, packet.Payload[0]&0x04 != 0
+		if begin != (i == 0) || end != (i == len(packets)-1) {
+			t.Fatalf("packet %d descriptor %x", i, packet.Payload[0])
+		}
+	}
+	data := decodeVPPackets(t, packets, vt.decoder.Decode, rtpvp9.ErrMorePacketsNeeded)
+	if !bytes.Equal(data, frame) {
+		t.Fatal("depacketized frame mismatch")
+	}
+	if err := vt.parseFrame(data); err != nil {
+		t.Fatal(err)
+	}
+	if !vt.Value.IFrame || vt.Width != 640 || vt.Height != 480 || vt.SequenceHeadSeq != 1 {
+		t.Fatalf("key frame %v %dx%d seq %d", vt.Value.IFrame, vt.Width, vt.Height, vt.SequenceHeadSeq)
+	}
+	if vt.record.BitDepth != 8 || vt.record.ChromaSubsampling != codec.NewVPCodecConfigurationRecord().ChromaSubsampling {
+		t.Fatalf("record %+v", vt.record)
+	}
+	// 非关键帧：frame_type 为 1
+	if err := vt.parseFrame([]byte{0x86, 0x00, 0x00, 0x00}); err != nil || vt.Value.IFrame || vt.SequenceHeadSeq != 1 {
+		t.Fatalf("inter frame %v seq %d %v", vt.Value.IFrame, vt.SequenceHeadSeq, err)
+	}
+}
+
+func TestVPCompleteAVCC(t *testing.T) {
+	vt := NewVP8(nil)
+	vt.Init(8, NewAVFrame)
+	vt.Value.IFrame = true
+	vt.AppendAuBytes([]byte{1, 2, 3})
+	vt.CompleteAVCC(vt.Value)
+	want := []byte{0b1001_0000 | byte(codec.PacketTypeCodedFrames), 'v', 'p', '0', '8', 1, 2, 3}
+	if got := vt.Value.AVCC.ToBytes(); !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
+
+func decodeVPPackets(t *testing.T, packets []*rtp.Packet, decode func(*rtp.Packet) ([]byte, error), more error) (data []byte) {
+	for i, packet := range packets {
+		packet.SequenceNumber = uint16(i)
+		var err error
+		if data, err = decode(packet); i < len(packets)-1 && err != more || i == len(packets)-1 && err != nil {
+			t.Fatalf("decode packet %d: %v", i, err)
+		}
+	}
+	return
+}
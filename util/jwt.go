@@ -0,0 +1,216 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrJWTMalformed    = errors.New("jwt malformed")
+	ErrJWTAlgorithm    = errors.New("jwt algorithm not supported")
+	ErrJWTKeyNotFound  = errors.New("jwt key not found")
+	ErrJWTSignature    = errors.New("jwt signature invalid")
+	ErrJWTExpired      = errors.New("jwt expired")
+	ErrJWTNotValidYet  = errors.New("jwt not valid yet")
+	ErrJWKSUnsupported = errors.New("jwks key type not supported")
+)
+
+// JWTKeys 校验 JWT 的密钥，支持 HS256、RS256、ES256
+type JWTKeys struct {
+	Secret []byte                      // HS256 使用的密钥
+	Keys   map[string]crypto.PublicKey // RS256、ES256 使用的公钥，key 为 kid，没有 kid 的为空字符串
+}
+
+func (k *JWTKeys) addKey(kid string, key crypto.PublicKey) {
+	if k.Keys == nil {
+		k.Keys = make(map[string]crypto.PublicKey)
+	}
+	k.Keys[kid] = key
+}
+
+// LoadPEM 读取 PEM 格式的公钥或者证书，作为没有 kid 时使用的公钥
+func (k *JWTKeys) LoadPEM(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ErrJWTKeyNotFound
+	}
+	var key crypto.PublicKey
+	if block.Type == "CERTIFICATE" {
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	} else if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	if err != nil {
+		return err
+	}
+	k.addKey("", key)
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func jwtDecodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// LoadJWKS 读取本地 JWKS 文件，支持 RSA、P-256 的 EC 和 oct 类型的密钥
+func (k *JWTKeys) LoadJWKS(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	for _, key := range set.Keys {
+		switch key.Kty {
+		case "RSA":
+			var n, e *big.Int
+			if n, err = jwtDecodeInt(key.N); err != nil {
+				return err
+			}
+			if e, err = jwtDecodeInt(key.E); err != nil {
+				return err
+			}
+			k.addKey(key.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())})
+		case "EC":
+			if key.Crv != "P-256" {
+				return ErrJWKSUnsupported
+			}
+			var x, y *big.Int
+			if x, err = jwtDecodeInt(key.X); err != nil {
+				return err
+			}
+			if y, err = jwtDecodeInt(key.Y); err != nil {
+				return err
+			}
+			k.addKey(key.Kid, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+		case "oct":
+			if k.Secret, err = base64.RawURLEncoding.DecodeString(key.K); err != nil {
+				return err
+			}
+		default:
+			return ErrJWKSUnsupported
+		}
+	}
+	return nil
+}
+
+func (k *JWTKeys) publicKey(kid string) crypto.PublicKey {
+	if key, ok := k.Keys[kid]; ok {
+		return key
+	}
+	return k.Keys[""]
+}
+
+// Verify 校验签名以及 exp、nbf，校验通过后将 payload 解析到 claims 中
+func (k *JWTKeys) Verify(token string, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return ErrJWTMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrJWTMalformed
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "HS256":
+		if len(k.Secret) == 0 {
+			return ErrJWTKeyNotFound
+		}
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrJWTSignature
+		}
+	case "RS256":
+		key, ok := k.publicKey(header.Kid).(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTKeyNotFound
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return ErrJWTSignature
+		}
+	case "ES256":
+		key, ok := k.publicKey(header.Kid).(*ecdsa.PublicKey)
+		if !ok {
+			return ErrJWTKeyNotFound
+		}
+		// 签名为 r 和 s 各 32 字节拼接而成
+		if len(signature) != 64 {
+			return ErrJWTSignature
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrJWTSignature
+		}
+	default:
+		return ErrJWTAlgorithm
+	}
+	if data, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return ErrJWTMalformed
+	}
+	var times struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if json.Unmarshal(data, &times) != nil {
+		return ErrJWTMalformed
+	}
+	now := float64(time.Now().Unix())
+	if times.Exp != nil && now >= *times.Exp {
+		return ErrJWTExpired
+	}
+	if times.Nbf != nil && now < *times.Nbf {
+		return ErrJWTNotValidYet
+	}
+	if claims != nil {
+		return json.Unmarshal(data, claims)
+	}
+	return nil
+}
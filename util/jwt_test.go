@@ -0,0 +1,79 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg string, key any, payload string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"`+alg+`","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	digest := sha256.Sum256([]byte(unsigned))
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(unsigned))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := JWTKeys{Secret: []byte("secret")}
+	keys.addKey("", &rsaKey.PublicKey)
+	keys.addKey("ec", &ecKey.PublicKey)
+	future, past := time.Now().Add(time.Hour).Unix(), time.Now().Add(-time.Hour).Unix()
+	var claims struct {
+		Path string `json:"path"`
+	}
+	if err := keys.Verify(signJWT(t, "HS256", []byte("secret"), `{"path":"live/*"}`), &claims); err != nil || claims.Path != "live/*" {
+		t.Fatal("HS256", err, claims.Path)
+	}
+	if err := keys.Verify(signJWT(t, "HS256", []byte("wrong"), `{}`), nil); err != ErrJWTSignature {
+		t.Fatal("HS256 wrong secret", err)
+	}
+	if err := keys.Verify(signJWT(t, "RS256", rsaKey, `{}`), nil); err != nil {
+		t.Fatal("RS256", err)
+	}
+	// 没有 kid 时使用默认的 RSA 公钥，ES256 找不到公钥
+	if err := keys.Verify(signJWT(t, "ES256", ecKey, `{}`), nil); err != ErrJWTKeyNotFound {
+		t.Fatal("ES256 without kid", err)
+	}
+	keys.addKey("", &ecKey.PublicKey)
+	if err := keys.Verify(signJWT(t, "ES256", ecKey, `{}`), nil); err != nil {
+		t.Fatal("ES256", err)
+	}
+	if err := keys.Verify(signJWT(t, "HS256", []byte("secret"), `{"exp":`+strconv.FormatInt(past, 10)+`}`), nil); err != ErrJWTExpired {
+		t.Fatal("exp", err)
+	}
+	if err := keys.Verify(signJWT(t, "HS256", []byte("secret"), `{"nbf":`+strconv.FormatInt(future, 10)+`}`), nil); err != ErrJWTNotValidYet {
+		t.Fatal("nbf", err)
+	}
+	if err := keys.Verify("a.b", nil); err != ErrJWTMalformed {
+		t.Fatal("malformed", err)
+	}
+}
@@ -139,6 +139,22 @@ func (r *BLLsReader) ReadByte() (b byte, err error) {
 	return r.BLLReader.ReadByte()
 }
 
+// ReadN 跨越多个 BLL 读取 n 个字节
+func (r *BLLsReader) ReadN(n int) (result net.Buffers) {
+	for n > 0 && r.CanRead() {
+		for _, b := range r.BLLReader.ReadN(n) {
+			result = append(result, b)
+			n -= len(b)
+		}
+		if n > 0 {
+			if r.ListItem = r.Next; r.CanRead() {
+				r.BLLReader = *r.Value.NewReader()
+			}
+		}
+	}
+	return
+}
+
 type BLLs struct {
 	List[*BLL]
 	ByteLength int
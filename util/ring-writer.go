@@ -88,7 +88,7 @@ func (rb *RingWriter[T, F]) Reduce(size int) {
 			p.Value.Ready()
 			rb.poolSize++
 		} else {
-			p.Value.Reset()
+			// 读取者还持有该节点，不能回收它的内存
 			if pSize == 1 {
 				// last one，无法删除最后一个节点，直接返回即可（不回收）
 				return
@@ -37,6 +37,22 @@ func (w waitTrackNames) InviteTrack(suber ISubscriber) {
 		InviteTrack(w[0], suber)
 	}
 }
+// Match 检查名称是否在等待候选项中，不改变等待状态
+func (w waitTrackNames) Match(name string) bool {
+	if !w.Waiting() {
+		return false
+	}
+	if w.Waitany() {
+		return true
+	}
+	for _, n := range w {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Accept 检查名称是否在等待候选项中
 func (w *waitTrackNames) Accept(name string) bool {
 	if !w.Waiting() {
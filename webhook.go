@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"m7s.live/engine/v4/config"
+)
+
+// WebhookIO 回调中发布者或者订阅者的信息
+type WebhookIO struct {
+	ID         string `json:",omitempty"`
+	Type       string
+	RemoteAddr string `json:",omitempty"`
+}
+
+// WebhookEvent 回调请求的 JSON 内容
+type WebhookEvent struct {
+	Event      string
+	Time       time.Time
+	StreamPath string
+	Action     string     `json:",omitempty"` // 引起状态变化的动作
+	Publisher  *WebhookIO `json:",omitempty"`
+	Subscriber *WebhookIO `json:",omitempty"`
+}
+
+type webhookTask struct {
+	url  string
+	name string
+	body []byte
+}
+
+// webhookSender 在单独的协程中发送回调，队列满时丢弃，不阻塞事件循环
+// 除 QueueSize 在第一次回调时确定、修改后需要重启外，其余配置在每次发送时读取
+type webhookSender struct {
+	once   sync.Once
+	queue  chan *webhookTask
+	client http.Client
+	conf   *config.Webhook
+}
+
+var webhook webhookSender
+
+func newWebhookIO(io *IO) *WebhookIO {
+	if io == nil {
+		return nil
+	}
+	return &WebhookIO{ID: io.ID, Type: io.Type, RemoteAddr: io.RemoteAddr}
+}
+
+// webhookEvent 将事件转换为回调内容，不需要回调的事件返回 nil
+func webhookEvent(event any) *WebhookEvent {
+	var name string
+	var se StateEvent
+	switch v := event.(type) {
+	case SEcreate:
+		return &WebhookEvent{Event: "create", Time: v.Time, StreamPath: v.Target.Path}
+	case SEpublish:
+		name, se = "publish", v.StateEvent
+	case SErepublish:
+		name, se = "republish", v.StateEvent
+	case SEtrackAvaliable:
+		name, se = "trackavailable", v.StateEvent
+	case SEwaitPublish:
+		name, se = "waitpublish", v.StateEvent
+	case SEwaitClose:
+		name, se = "waitclose", v.StateEvent
+	case SEclose:
+		name, se = "close", v.StateEvent
+	case UnsubscribeEvent:
+		sub := v.Target.GetSubscriber()
+		e := &WebhookEvent{Event: "unsubscribe", Time: v.Time, Subscriber: newWebhookIO(&sub.IO)}
+		if sub.Stream != nil {
+			e.StreamPath = sub.Stream.Path
+		}
+		return e
+	case InvitePublish:
+		return &WebhookEvent{Event: "invitepublish", Time: v.Time, StreamPath: v.Target}
+	default:
+		return nil
+	}
+	e := &WebhookEvent{Event: name, Time: se.Time, StreamPath: se.Target.Path, Action: se.Action.String()}
+	if p := se.Target.publisher; p != nil {
+		e.Publisher = newWebhookIO(&p.IO)
+	}
+	return e
+}
+
+// OnEvent 由引擎的事件循环调用
+func (w *webhookSender) OnEvent(conf *config.Webhook, event any) {
+	if len(conf.URLs) == 0 {
+		return
+	}
+	e := webhookEvent(event)
+	if e == nil {
+		return
+	}
+	url := conf.GetURL(e.Event)
+	if url == "" {
+		return
+	}
+	w.once.Do(func() {
+		w.conf = conf
+		size := conf.QueueSize
+		if size <= 0 {
+			size = 1
+		}
+		w.queue = make(chan *webhookTask, size)
+		go w.run()
+	})
+	body, err := json.Marshal(e)
+	if err != nil {
+		Engine.Error("webhook marshal", zap.Error(err))
+		return
+	}
+	select {
+	case w.queue <- &webhookTask{url: url, name: e.Event, body: body}:
+	default:
+		Engine.Warn("webhook queue full", zap.String("event", e.Event), zap.String("streamPath", e.StreamPath))
+	}
+}
+
+// webhookMinRetryInterval 重试间隔的下限，避免配置为0时连续重试
+const webhookMinRetryInterval = 100 * time.Millisecond
+
+// retryInterval 首次重试的间隔
+func (w *webhookSender) retryInterval() time.Duration {
+	if w.conf.RetryInterval < webhookMinRetryInterval {
+		return webhookMinRetryInterval
+	}
+	return w.conf.RetryInterval
+}
+
+func (w *webhookSender) run() {
+	for task := range w.queue {
+		interval := w.retryInterval()
+		for i := 0; ; i++ {
+			err := w.send(task)
+			if err == nil {
+				break
+			}
+			if i >= w.conf.Retry {
+				Engine.Error("webhook", zap.String("event", task.name), zap.String("url", task.url), zap.Error(err))
+				break
+			}
+			Engine.Warn("webhook retry", zap.String("event", task.name), zap.Int("retry", i+1), zap.Error(err))
+			time.Sleep(interval)
+			interval *= 2
+		}
+	}
+}
+
+func (w *webhookSender) send(task *webhookTask) error {
+	ctx := context.Background()
+	if w.conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.conf.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.url, bytes.NewReader(task.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-M7S-Event", task.name)
+	if w.conf.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.conf.Secret))
+		mac.Write(task.body)
+		req.Header.Set("X-M7S-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"m7s.live/engine/v4/config"
+)
+
+func TestWebhookTimeoutReload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	conf := &config.Webhook{Timeout: 20 * time.Millisecond}
+	w := &webhookSender{conf: conf}
+	task := &webhookTask{url: server.URL, name: "publish", body: []byte("{}")}
+	if err := w.send(task); err == nil {
+		t.Fatal("send should time out")
+	}
+	// 修改后的超时在下一次发送时生效
+	conf.Timeout = time.Second
+	if err := w.send(task); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhookRetryInterval(t *testing.T) {
+	for _, tt := range []struct {
+		conf, want time.Duration
+	}{
+		{0, webhookMinRetryInterval},
+		{-time.Second, webhookMinRetryInterval},
+		{10 * time.Millisecond, webhookMinRetryInterval},
+		{time.Second, time.Second},
+	} {
+		w := &webhookSender{conf: &config.Webhook{RetryInterval: tt.conf}}
+		if got := w.retryInterval(); got != tt.want {
+			t.Errorf("retryInterval %v: got %v, want %v", tt.conf, got, tt.want)
+		}
+	}
+}